@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/reddtsai/goREPL/pkg/storage"
+)
+
+// Complete returns the words the last word of line, the command line up to
+// the cursor, can be completed to. The command names come first, then the
+// arguments of the command are completed from the storage, and the flags
+// and their values from the command. It's used by the interactive prompt,
+// cobra's __complete hook uses the completions of the commands directly.
+func (r *Repl) Complete(ctx context.Context, line string) []string {
+	i := strings.LastIndexFunc(line, unicode.IsSpace) + 1
+	word := line[i:]
+	args, err := r.SplitArgs(line[:i])
+	if err != nil {
+		return nil
+	}
+	if len(args) == 0 {
+		return r.completeCmdNames(word)
+	}
+	args = r.expandAlias(args)
+	cmd, args, err := r.rootCmd.Find(args)
+	if err != nil || cmd == r.rootCmd {
+		return nil
+	}
+	cmd.SetContext(ctx)
+
+	var (
+		candidates []string
+		complete   func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective)
+	)
+	name, value, hasValue := strings.Cut(word, "=")
+	flag := valueFlag(cmd, args)
+	switch {
+	case flag != nil:
+		complete, _ = cmd.GetFlagCompletionFunc(flag.Name)
+	case strings.HasPrefix(word, "-") && hasValue:
+		flag = cmd.Flags().Lookup(strings.TrimLeft(name, "-"))
+		if flag == nil {
+			return nil
+		}
+		complete, _ = cmd.GetFlagCompletionFunc(flag.Name)
+		if complete == nil {
+			return nil
+		}
+		values, _ := complete(cmd, positionalArgs(cmd, args), value)
+		for _, v := range values {
+			candidates = append(candidates, name+"="+v)
+		}
+		return candidates
+	case strings.HasPrefix(word, "-"):
+		cmd.LocalNonPersistentFlags().VisitAll(func(f *pflag.Flag) {
+			if !f.Hidden && strings.HasPrefix("--"+f.Name, word) {
+				candidates = append(candidates, "--"+f.Name)
+			}
+		})
+		return candidates
+	default:
+		complete = cmd.ValidArgsFunction
+	}
+	if complete == nil {
+		return nil
+	}
+	positional := positionalArgs(cmd, args)
+	// the word is an argument too once typed
+	positional = append(r.fillContext(cmd.Name(), len(positional)+1), positional...)
+	candidates, _ = complete(cmd, positional, word)
+	return candidates
+}
+
+// completing reports whether cobra's __complete hook is running
+func (r *Repl) completing() bool {
+	c, _, err := r.rootCmd.Find([]string{cobra.ShellCompRequestCmd})
+	return err == nil && c.Name() == cobra.ShellCompRequestCmd && c.CalledAs() != ""
+}
+
+// completeCmdNames returns the commands, the aliases and the macros starting
+// with prefix, along with exit and help handled by the loop
+func (r *Repl) completeCmdNames(prefix string) []string {
+	names := r.definitions().names(prefix)
+	for _, name := range []string{"exit", "help"} {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	for _, c := range r.rootCmd.Commands() {
+		if c.IsAvailableCommand() && c.Name() != "help" && strings.HasPrefix(c.Name(), prefix) {
+			names = append(names, c.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// valueFlag returns the flag of cmd waiting for its value after args, if any
+func valueFlag(cmd *cobra.Command, args []string) *pflag.Flag {
+	if len(args) == 0 {
+		return nil
+	}
+	last := args[len(args)-1]
+	if !strings.HasPrefix(last, "-") || strings.Contains(last, "=") {
+		return nil
+	}
+	f := cmd.Flags().Lookup(strings.TrimLeft(last, "-"))
+	if f == nil || f.NoOptDefVal != "" {
+		return nil
+	}
+	return f
+}
+
+// positionalArgs returns args without the flags of cmd and their values
+func positionalArgs(cmd *cobra.Command, args []string) []string {
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, arg)
+			continue
+		}
+		if arg == "--" {
+			return append(positional, args[i+1:]...)
+		}
+		if valueFlag(cmd, args[:i+1]) != nil {
+			// skips the value
+			i++
+		}
+	}
+	return positional
+}
+
+// completeNames returns the completion of the arguments of a command
+// naming a user, a folder of the user and a file of the folder, only the
+// first n of them already existing
+func (r *Repl) completeNames(n int) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) >= n {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		// __complete parses the flags choosing the storage only once it runs
+		if err := r.configure(); err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		if err := r.openStorage(); err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		var names []string
+		switch len(args) {
+		case 0:
+			users, err := r.store().ListUser(ctx)
+			if err != nil {
+				return nil, cobra.ShellCompDirectiveError
+			}
+			names = users
+		case 1:
+			folders, err := r.store().ListFolder(ctx, args[0], "name", "asc")
+			if err != nil {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			for _, f := range folders {
+				names = append(names, f.FolderName)
+			}
+		case 2:
+			files, err := r.store().ListFile(ctx, args[0], args[1], "name", "asc")
+			if err != nil {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			for _, f := range files {
+				names = append(names, f.FileName)
+			}
+		}
+		return filterNamePrefix(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeOrder completes the value of the --sort-name and --sort-created
+// flags
+func completeOrder(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return filterPrefix([]string{"asc", "desc"}, strings.ToLower(toComplete)), cobra.ShellCompDirectiveNoFileComp
+}
+
+func filterPrefix(words []string, prefix string) []string {
+	var filtered []string
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			filtered = append(filtered, w)
+		}
+	}
+	return filtered
+}
+
+// filterNamePrefix keeps the names starting with prefix in any case
+func filterNamePrefix(names []string, prefix string) []string {
+	var filtered []string
+	for _, n := range names {
+		if strings.HasPrefix(storage.NameKey(n), storage.NameKey(prefix)) {
+			filtered = append(filtered, n)
+		}
+	}
+	return filtered
+}
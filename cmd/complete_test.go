@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/reddtsai/goREPL/pkg/storage"
+)
+
+type TestComplete struct {
+	suite.Suite
+
+	repl *Repl
+}
+
+func TestCompleteSuite(t *testing.T) {
+	suite.Run(t, new(TestComplete))
+}
+
+func (t *TestComplete) SetupTest() {
+	s := storage.NewVirtualFileSysStorage()
+	ctx := context.Background()
+	t.Require().NoError(s.AddUser(ctx, "alice"))
+	t.Require().NoError(s.AddUser(ctx, "alan"))
+	t.Require().NoError(s.AddFolder(ctx, "alice", "docs", ""))
+	t.Require().NoError(s.AddFolder(ctx, "alice", "Downloads", ""))
+	t.Require().NoError(s.AddFile(ctx, "alice", "docs", "notes", ""))
+	t.repl = &Repl{
+		storage: s,
+		rootCmd: &cobra.Command{Use: "repl"},
+	}
+	t.repl.AddRegisterCmd()
+	t.repl.AddCreateFolderCmd()
+	t.repl.AddListFoldersCmd()
+	t.repl.AddCreateFileCmd()
+	t.repl.AddDeleteFileCmd()
+	t.repl.AddListFilesCmd()
+	t.repl.AddBeginCmd()
+	t.repl.rootCmd.SetOut(io.Discard)
+	t.repl.rootCmd.SetErr(io.Discard)
+}
+
+func (t *TestComplete) TestComplete() {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", []string{"begin", "create-file", "create-folder", "delete-file", "exit", "help", "list-files", "list-folders", "register"}},
+		{"create-f", []string{"create-file", "create-folder"}},
+		{"create-file ", []string{"alan", "alice"}},
+		{"create-file ali", []string{"alice"}},
+		{"create-file ALI", []string{"alice"}},
+		{"create-file alice ", []string{"docs", "Downloads"}},
+		{"create-file alice do", []string{"docs", "Downloads"}},
+		{"create-file 'alice' doc", []string{"docs"}},
+		{"create-file alice DOW", []string{"Downloads"}},
+		{"create-file alice docs ", nil},
+		{"create-file bob ", nil},
+		{"delete-file alice docs ", []string{"notes"}},
+		{"delete-file alice docs notes ", nil},
+		{"create-folder ", []string{"alan", "alice"}},
+		{"create-folder alice ", nil},
+		{"register ", nil},
+		{"list-folders --", []string{"--sort-created", "--sort-name"}},
+		{"list-folders alice --sort-name ", []string{"asc", "desc"}},
+		{"list-folders alice --sort-created d", []string{"desc"}},
+		{"list-folders alice --sort-name=", []string{"--sort-name=asc", "--sort-name=desc"}},
+		{"list-folders --sort-name desc a", []string{"alan", "alice"}},
+		{"list-files alice --sort-name asc ", []string{"docs", "Downloads"}},
+		{"begin ", nil},
+		{"unknown ", nil},
+		{"create-file 'ali", nil},
+	}
+	for _, tt := range tests {
+		t.Equal(tt.want, t.repl.Complete(context.Background(), tt.line), "%q", tt.line)
+	}
+}
+
+func (t *TestComplete) TestCompleteTx() {
+	err := t.repl.exec(context.Background(), t.repl.rootCmd, []string{"begin"})
+	t.Require().NoError(err)
+	err = t.repl.exec(context.Background(), t.repl.rootCmd, []string{"register", "alex"})
+	t.Require().NoError(err)
+	// the names staged in the open transaction are completed too
+	t.Equal([]string{"alan", "alex", "alice"}, t.repl.Complete(context.Background(), "list-folders al"))
+}
+
+func (t *TestComplete) TestShellComplete() {
+	var out bytes.Buffer
+	t.repl.rootCmd.SetOut(&out)
+	t.repl.rootCmd.SetArgs([]string{cobra.ShellCompRequestCmd, "create-file", "alice", ""})
+	// execute
+	err := t.repl.rootCmd.Execute()
+	// testing
+	t.NoError(err)
+	t.True(strings.HasPrefix(out.String(), "docs\nDownloads\n:4\n"), out.String())
+
+	out.Reset()
+	t.repl.rootCmd.SetArgs([]string{cobra.ShellCompRequestCmd, "list-files", "alice", "--sort-name", ""})
+	t.NoError(t.repl.rootCmd.Execute())
+	t.True(strings.HasPrefix(out.String(), "asc\ndesc\n:4\n"), out.String())
+}
@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// projectConfig is the config file in the working dir, overriding the one
+// of the user
+const projectConfig = ".goREPL.yaml"
+
+// settingNames are the settings of a config file, in the order shown
+var settingNames = []string{"data-dir", "prompt", "sort", "order", "time-format", "time-zone", "output", "names", "rc"}
+
+var defaultSettings = map[string]string{
+	"prompt":      "{context}# ",
+	"sort":        "name",
+	"order":       "asc",
+	"time-format": "2006-01-02 15:04:05",
+	"time-zone":   "Local",
+	"output":      "text",
+	"names":       "ascii",
+}
+
+// settingFlags are the flags of the root command overriding the settings,
+// but data-dir already set
+var settingFlags = map[string]string{
+	"prompt":      "the prompt, {context} {pwd} {user} and {folder} are replaced",
+	"sort":        "sort the lists by name or created by default",
+	"order":       "sort the lists in asc or desc order by default",
+	"time-format": "the layout of the times listed, as Go formats them",
+	"time-zone":   "the time zone of the times listed, e.g. Asia/Taipei",
+	"output":      "list as text or json",
+	"names":       "allow ascii names, or unicode ones of any script",
+	"rc":          "run the commands in this file at the start of the interactive loop",
+}
+
+// setting is a value of the config and where it came from
+type setting struct {
+	value  string
+	source string
+}
+
+// config holds the settings merged from the defaults, the config files and
+// the flags, a later one overriding the earlier
+type config struct {
+	settings map[string]setting
+	location *time.Location
+}
+
+func newConfig() *config {
+	c := &config{
+		settings: make(map[string]setting),
+		location: time.Local,
+	}
+	for _, name := range settingNames {
+		c.settings[name] = setting{value: defaultSettings[name], source: "default"}
+	}
+	return c
+}
+
+// get returns the value of the setting name
+func (c *config) get(name string) string {
+	return c.settings[name].value
+}
+
+// load merges the config file at path, if any. The paths in it are relative
+// to the file.
+func (c *config) load(path string) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var values map[string]string
+	err = yaml.Unmarshal(b, &values)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for name, value := range values {
+		if (name == "data-dir" || name == "rc") && value != "" && !filepath.IsAbs(value) {
+			value = filepath.Join(filepath.Dir(path), value)
+		}
+		err = c.set(name, value, path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// set checks value and sets the setting name to it
+func (c *config) set(name, value, source string) error {
+	if _, ok := c.settings[name]; !ok {
+		return fmt.Errorf("the [%s] isn't a setting", name)
+	}
+	valid := true
+	switch name {
+	case "sort":
+		valid = value == "name" || value == "created"
+	case "order":
+		valid = value == "asc" || value == "desc"
+	case "output":
+		valid = value == "text" || value == "json"
+	case "names":
+		valid = value == "ascii" || value == "unicode"
+	case "time-zone":
+		loc, err := time.LoadLocation(value)
+		if err != nil {
+			return fmt.Errorf("the [%s] invalid time-zone", value)
+		}
+		c.location = loc
+	}
+	if !valid {
+		return fmt.Errorf("the [%s] invalid %s", value, name)
+	}
+	c.settings[name] = setting{value: value, source: source}
+	return nil
+}
+
+// addSettingFlags adds the flags overriding the settings to cmd
+func addSettingFlags(cmd *cobra.Command) {
+	for _, name := range settingNames {
+		if usage, ok := settingFlags[name]; ok {
+			cmd.PersistentFlags().String(name, "", usage)
+		}
+	}
+}
+
+// configure merges the config of the user, the one of the project and the
+// flags given, unless done already
+func (r *Repl) configure() error {
+	if r.config != nil {
+		return nil
+	}
+	c := newConfig()
+	var paths []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "goREPL", "config.yaml"))
+	}
+	paths = append(paths, projectConfig)
+	for _, path := range paths {
+		err := c.load(path)
+		if err != nil {
+			return err
+		}
+	}
+	flags := r.rootCmd.PersistentFlags()
+	for _, name := range settingNames {
+		f := flags.Lookup(name)
+		if f == nil || !f.Changed {
+			continue
+		}
+		err := c.set(name, f.Value.String(), "flag --"+name)
+		if err != nil {
+			return err
+		}
+	}
+	// another storage chosen by a flag wins over the config
+	if !flags.Changed("data-dir") && r.hostDir == "" && r.remote == "" {
+		r.dataDir = c.get("data-dir")
+	}
+	r.config = c
+	return nil
+}
+
+// SetSettings configures r with settings over the defaults, in place of the
+// config files and the flags, for a Repl embedded with Run
+func (r *Repl) SetSettings(settings map[string]string) error {
+	c := newConfig()
+	for name, value := range settings {
+		err := c.set(name, value, "SetSettings")
+		if err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := settings["data-dir"]; ok {
+		r.dataDir = c.get("data-dir")
+	}
+	r.config = c
+	return nil
+}
+
+// setting returns the value of the setting name, the default one until
+// configured
+func (r *Repl) setting(name string) string {
+	if r.config == nil {
+		return defaultSettings[name]
+	}
+	return r.config.get(name)
+}
+
+// formatTime formats the unix time t as the time-format and time-zone
+// settings tell
+func (r *Repl) formatTime(t int64) string {
+	loc := time.Local
+	if r.config != nil {
+		loc = r.config.location
+	}
+	return time.Unix(t, 0).In(loc).Format(r.setting("time-format"))
+}
+
+func (r *Repl) AddConfigCmd() {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "show the settings",
+		Args:  r.ConfigValidation,
+		RunE:  r.ConfigRunner,
+	}
+	cmd.SetUsageTemplate("Usage:\n  config show")
+	show := &cobra.Command{
+		Use:   "show",
+		Short: "show the settings in effect and where they came from",
+		Args:  r.ConfigValidation,
+		RunE:  r.ConfigShowRunner,
+	}
+	show.SetUsageTemplate("Usage:\n  config show")
+	cmd.AddCommand(show)
+
+	r.addCommand(cmd, (*Repl).AddConfigCmd)
+}
+
+func (r *Repl) ConfigValidation(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	if len(args) != 0 {
+		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
+	}
+
+	return nil
+}
+
+// ConfigRunner runs for config without show
+func (r *Repl) ConfigRunner(cmd *cobra.Command, args []string) error {
+	return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
+}
+
+// ConfigShowRunner prints the settings as a config file, with where each
+// came from
+func (r *Repl) ConfigShowRunner(cmd *cobra.Command, args []string) error {
+	c := r.config
+	if c == nil {
+		c = newConfig()
+	}
+	for _, name := range settingNames {
+		s := c.settings[name]
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: %q  # %s\n", name, s.value, s.source)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/reddtsai/goREPL/pkg/storage"
+)
+
+type TestConfig struct {
+	suite.Suite
+
+	repl *Repl
+	dir  string
+}
+
+func TestConfigSuite(t *testing.T) {
+	suite.Run(t, new(TestConfig))
+}
+
+func (t *TestConfig) SetupTest() {
+	t.dir = t.T().TempDir()
+	t.T().Setenv("XDG_CONFIG_HOME", t.dir)
+	t.repl = &Repl{
+		storage: storage.NewVirtualFileSysStorage(),
+		rootCmd: &cobra.Command{Use: "repl"},
+	}
+	t.repl.rootCmd.PersistentFlags().StringVar(&t.repl.dataDir, "data-dir", "", "")
+	addSettingFlags(t.repl.rootCmd)
+	t.repl.AddRegisterCmd()
+	t.repl.AddCreateFolderCmd()
+	t.repl.AddListFoldersCmd()
+	t.repl.AddCreateFileCmd()
+	t.repl.AddListFilesCmd()
+	t.repl.AddUseCmd()
+	t.repl.AddConfigCmd()
+}
+
+// write writes a config file at path, under the temp dir
+func (t *TestConfig) write(path, content string) string {
+	path = filepath.Join(t.dir, path)
+	t.Require().NoError(os.MkdirAll(filepath.Dir(path), 0o700))
+	t.Require().NoError(os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+// run feeds input to a session and returns what it printed
+func (t *TestConfig) run(input string) string {
+	var out bytes.Buffer
+	err := t.repl.Run(context.Background(), strings.NewReader(input), &out, &out)
+	t.Require().NoError(err)
+	return out.String()
+}
+
+func (t *TestConfig) TestLoad() {
+	user := t.write("user.yaml", "data-dir: data\nsort: created\norder: desc\n")
+	project := t.write("project/.goREPL.yaml", "order: asc\nrc: /etc/rc\n")
+	c := newConfig()
+	// execute
+	t.Require().NoError(c.load(user))
+	t.Require().NoError(c.load(project))
+	t.Require().NoError(c.load(filepath.Join(t.dir, "missing.yaml")))
+	// testing
+	t.Equal(setting{filepath.Join(t.dir, "data"), user}, c.settings["data-dir"])
+	t.Equal(setting{"created", user}, c.settings["sort"])
+	t.Equal(setting{"asc", project}, c.settings["order"])
+	t.Equal(setting{"/etc/rc", project}, c.settings["rc"])
+	t.Equal(setting{"text", "default"}, c.settings["output"])
+}
+
+func (t *TestConfig) TestLoadInvalid() {
+	tests := []struct {
+		content string
+		err     string
+	}{
+		{"colour: red\n", "the [colour] isn't a setting"},
+		{"sort: size\n", "the [size] invalid sort"},
+		{"order: up\n", "the [up] invalid order"},
+		{"output: xml\n", "the [xml] invalid output"},
+		{"time-zone: Mars/Base\n", "the [Mars/Base] invalid time-zone"},
+		{"- a\n", "cannot unmarshal"},
+	}
+	for _, tt := range tests {
+		path := t.write("bad.yaml", tt.content)
+		err := newConfig().load(path)
+		t.ErrorContains(err, tt.err, tt.content)
+		t.ErrorContains(err, path, tt.content)
+	}
+}
+
+func (t *TestConfig) TestConfigure() {
+	t.write("goREPL/config.yaml", "data-dir: /srv/data\nprompt: '{user}> '\norder: desc\n")
+	t.Require().NoError(t.repl.rootCmd.ParseFlags([]string{"--order", "asc", "--output", "json"}))
+	// execute
+	t.Require().NoError(t.repl.configure())
+	// testing
+	t.Equal("/srv/data", t.repl.dataDir)
+	t.Equal("asc", t.repl.setting("order"))
+	out := t.run("config show\n")
+	t.Contains(out, "data-dir: \"/srv/data\"  # "+filepath.Join(t.dir, "goREPL", "config.yaml")+"\n")
+	t.Contains(out, "order: \"asc\"  # flag --order\n")
+	t.Contains(out, "output: \"json\"  # flag --output\n")
+	t.Contains(out, "sort: \"name\"  # default\n")
+}
+
+func (t *TestConfig) TestConfigureFlagWins() {
+	t.write("goREPL/config.yaml", "data-dir: /srv/data\n")
+	t.Require().NoError(t.repl.rootCmd.ParseFlags([]string{"--data-dir", "/tmp/mine"}))
+	// execute
+	t.Require().NoError(t.repl.configure())
+	// testing
+	t.Equal("/tmp/mine", t.repl.dataDir)
+	t.Equal(setting{"/tmp/mine", "flag --data-dir"}, t.repl.config.settings["data-dir"])
+
+	t.repl.config = nil
+	t.Require().NoError(t.repl.rootCmd.ParseFlags([]string{"--sort", "size"}))
+	t.ErrorContains(t.repl.configure(), "the [size] invalid sort")
+}
+
+func (t *TestConfig) TestRunReadsNoConfigFile() {
+	t.write("goREPL/config.yaml", "prompt: '> '\n")
+	// execute
+	out := t.run("config show\n")
+	// testing
+	t.Contains(out, "prompt: \"{context}# \"  # default\n")
+
+	t.repl.config = nil
+	t.Require().NoError(t.repl.SetSettings(map[string]string{"prompt": "$ ", "order": "desc"}))
+	out = t.run("config show\n")
+	t.Contains(out, "prompt: \"$ \"  # SetSettings\n")
+	t.Contains(out, "order: \"desc\"  # SetSettings\n")
+	t.ErrorContains(t.repl.SetSettings(map[string]string{"order": "up"}), "the [up] invalid order")
+}
+
+func (t *TestConfig) TestSettings() {
+	t.write("goREPL/config.yaml", "prompt: '{user}@{folder}> '\norder: desc\ntime-format: '2006/01/02'\ntime-zone: UTC\n")
+	t.Require().NoError(t.repl.configure())
+	// execute
+	out := t.run("register alice\ncreate-folder alice a\ncreate-folder alice b\nuse alice\nlist-folders alice\nlist-folders --sort-name asc\n")
+	// testing
+	day := time.Now().UTC().Format("2006/01/02")
+	t.Contains(out, "@> Use [alice] successfully\nalice@> ")
+	t.Contains(out, "alice@> b  "+day+" alice\na  "+day+" alice\n")
+	// a flag of the command wins over the settings
+	t.Contains(out, "alice@> a  "+day+" alice\nb  "+day+" alice\n")
+}
+
+func (t *TestConfig) TestJSONOutput() {
+	t.Require().NoError(t.repl.rootCmd.ParseFlags([]string{"--output", "json", "--time-zone", "UTC"}))
+	t.Require().NoError(t.repl.configure())
+	s := t.repl.storage
+	ctx := context.Background()
+	t.Require().NoError(s.AddUser(ctx, "alice"))
+	t.Require().NoError(s.AddFolder(ctx, "alice", "docs", "my docs"))
+	// execute
+	var out bytes.Buffer
+	t.repl.rootCmd.SetOut(&out)
+	t.repl.rootCmd.SetArgs([]string{"list-files", "alice", "docs"})
+	t.Require().NoError(t.repl.rootCmd.Execute())
+	t.Equal("[]\n", out.String())
+	t.Require().NoError(s.AddFile(ctx, "alice", "docs", "notes", ""))
+	out.Reset()
+	t.repl.rootCmd.SetArgs([]string{"list-folders", "alice"})
+	t.Require().NoError(t.repl.rootCmd.Execute())
+	// testing
+	created := time.Now().UTC().Format("2006-01-02")
+	t.Contains(out.String(), `"name": "docs",`)
+	t.Contains(out.String(), `"description": "my docs",`)
+	t.Contains(out.String(), `"created": "`+created)
+	t.NotContains(out.String(), "folderName")
+	out.Reset()
+	t.repl.rootCmd.SetArgs([]string{"list-files", "alice", "docs"})
+	t.Require().NoError(t.repl.rootCmd.Execute())
+	t.Contains(out.String(), `"folderName": "docs",`)
+}
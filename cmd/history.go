@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/reddtsai/goREPL/pkg/lineedit"
+)
+
+// historySize is how many commands the history keeps
+const historySize = 1000
+
+func (r *Repl) AddHistoryCmd() {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "list the commands entered",
+		Args:  r.HistoryValidation,
+		RunE:  r.HistoryRunner,
+	}
+	cmd.SetUsageTemplate("Usage:\n  history")
+
+	r.addCommand(cmd, (*Repl).AddHistoryCmd)
+}
+
+func (r *Repl) HistoryValidation(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	if len(args) != 0 {
+		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
+	}
+
+	return nil
+}
+
+func (r *Repl) HistoryRunner(cmd *cobra.Command, args []string) error {
+	if r.history == nil {
+		return nil
+	}
+	for i := 0; i < r.history.Len(); i++ {
+		fmt.Fprintf(cmd.OutOrStdout(), "%5d  %s\n", i+1, r.history.Entry(i))
+	}
+	return nil
+}
+
+// openHistory returns the history of the interactive loop. On a terminal
+// it's kept in the config dir, otherwise in memory only.
+func (r *Repl) openHistory(terminal bool, errOut io.Writer) *lineedit.History {
+	if !terminal {
+		return lineedit.NewHistory(historySize)
+	}
+	dir, err := os.UserConfigDir()
+	if err == nil {
+		var h *lineedit.History
+		h, err = lineedit.LoadHistory(filepath.Join(dir, "goREPL", "history"), historySize)
+		if err == nil {
+			return h
+		}
+	}
+	fmt.Fprintln(errOut, "Warning: the history isn't kept,", err)
+	return lineedit.NewHistory(historySize)
+}
+
+// expandHistory replaces !! at the start of line with the last command, !n
+// with the nth and !-n with the nth last
+func (r *Repl) expandHistory(line string) (string, error) {
+	word, rest, _ := strings.Cut(line, " ")
+	n := r.history.Len()
+	if word != "!!" {
+		var err error
+		n, err = strconv.Atoi(word[1:])
+		if err != nil {
+			// not a history event
+			return line, nil
+		}
+		if n < 0 {
+			n += r.history.Len() + 1
+		}
+	}
+	if n < 1 || n > r.history.Len() {
+		return "", fmt.Errorf("the [%s] event not found", word)
+	}
+	expanded := r.history.Entry(n - 1)
+	if rest != "" {
+		expanded += " " + rest
+	}
+	return expanded, nil
+}
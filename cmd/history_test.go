@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/reddtsai/goREPL/pkg/storage"
+)
+
+type TestHistory struct {
+	suite.Suite
+
+	repl *Repl
+}
+
+func TestHistorySuite(t *testing.T) {
+	suite.Run(t, new(TestHistory))
+}
+
+func (t *TestHistory) SetupTest() {
+	t.repl = &Repl{
+		storage: storage.NewVirtualFileSysStorage(),
+		rootCmd: &cobra.Command{Use: "repl"},
+	}
+	t.repl.AddRegisterCmd()
+	t.repl.AddListFoldersCmd()
+	t.repl.AddHistoryCmd()
+}
+
+// run feeds input to a session and returns what it printed
+func (t *TestHistory) run(input string) string {
+	var out bytes.Buffer
+	err := t.repl.Run(context.Background(), strings.NewReader(input), &out, &out)
+	t.Require().NoError(err)
+	return out.String()
+}
+
+func (t *TestHistory) TestHistoryCmd() {
+	out := t.run("register alice\n\nlist-folders \\\nalice\nregister alice\nhistory\nhistory x\n")
+	t.Contains(out, "# "+
+		"    1  register alice\n"+
+		"    2  list-folders alice\n"+
+		"    3  register alice\n"+
+		"    4  history\n")
+	t.Contains(out, "Error: unrecognized argument\nUsage:\n  history\n")
+}
+
+func (t *TestHistory) TestExpand() {
+	out := t.run("register alice\n!!\nlist-folders alice\n!1\n!-2 --sort-name desc\n!9\n!x\nhistory\n")
+	t.Contains(out, "# register alice\nError: the [alice] has already existed\n")
+	t.Contains(out, "# list-folders alice --sort-name desc\nWarning: the [alice] doesn't have any folders\n")
+	t.Contains(out, "# Error: the [!9] event not found\n")
+	t.Contains(out, "# Error: unrecognized command.\n")
+	t.Contains(out, "# "+
+		"    1  register alice\n"+
+		"    2  list-folders alice\n"+
+		"    3  register alice\n"+
+		"    4  list-folders alice --sort-name desc\n"+
+		"    5  !x\n"+
+		"    6  history\n")
+}
+
+func (t *TestHistory) TestOpenHistory() {
+	// only a terminal keeps the history in a file
+	t.T().Setenv("XDG_CONFIG_HOME", t.T().TempDir())
+	var errOut bytes.Buffer
+	h := t.repl.openHistory(false, &errOut)
+	t.Require().NoError(h.Add("register alice"))
+	h = t.repl.openHistory(true, &errOut)
+	t.Equal(0, h.Len())
+	t.Require().NoError(h.Add("register alice"))
+	h = t.repl.openHistory(true, &errOut)
+	t.Equal(1, h.Len())
+	t.Empty(errOut.String())
+}
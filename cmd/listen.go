@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/reddtsai/goREPL/pkg/lineedit"
+)
+
+func (r *Repl) AddListenCmd() {
+	cmd := &cobra.Command{
+		Use:   "listen",
+		Short: "serve REPL sessions over TCP",
+		Args:  cobra.NoArgs,
+		RunE:  r.ListenRunner,
+	}
+	cmd.Flags().String("addr", ":2323", "listen on this address")
+	cmd.Flags().Int("max-conns", 64, "refuse connections beyond this many sessions")
+	cmd.Flags().Duration("idle-timeout", 5*time.Minute, "close a session idle for this long, 0 means never")
+	cmd.Flags().Duration("drain-timeout", 30*time.Second, "on shutdown, cancel the commands still running after this long")
+	cmd.SetUsageTemplate("Usage:\n  listen [--addr host:port] [--max-conns n] [--idle-timeout duration] [--drain-timeout duration]")
+
+	// not added to the sessions, a client can't start servers
+	r.rootCmd.AddCommand(cmd)
+}
+
+// ListenRunner serves a REPL session to every TCP client until interrupted,
+// then lets the running commands finish
+func (r *Repl) ListenRunner(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	addr, err := flags.GetString("addr")
+	if err != nil {
+		return err
+	}
+	maxConns, err := flags.GetInt("max-conns")
+	if err != nil {
+		return err
+	}
+	if maxConns < 1 {
+		return fmt.Errorf("the [%d] invalid max-conns", maxConns)
+	}
+	idleTimeout, err := flags.GetDuration("idle-timeout")
+	if err != nil {
+		return err
+	}
+	drainTimeout, err := flags.GetDuration("drain-timeout")
+	if err != nil {
+		return err
+	}
+	// the rc file runs once here, the sessions start with a copy
+	if r.defs == nil {
+		r.openRC(cmd, lineedit.IsTerminal(cmd.InOrStdin()))
+	}
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Listening on %s\n", ln.Addr())
+	srv := &sessionServer{
+		repl:         r,
+		maxConns:     maxConns,
+		idleTimeout:  idleTimeout,
+		drainTimeout: drainTimeout,
+	}
+	err = srv.serve(ctx, ln)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), "Server stopped")
+	return nil
+}
+
+// sessionServer runs a session of repl for every connection, all sharing
+// its storage.
+type sessionServer struct {
+	repl         *Repl
+	maxConns     int
+	idleTimeout  time.Duration
+	drainTimeout time.Duration
+
+	mu       sync.Mutex
+	conns    map[*sessionConn]struct{}
+	draining bool
+	wg       sync.WaitGroup
+}
+
+// serve accepts connections on ln until ctx is done, then drains the
+// sessions: idle ones end at once, the others after their running command.
+// Commands still running after drainTimeout are canceled.
+func (s *sessionServer) serve(ctx context.Context, ln net.Listener) error {
+	s.conns = make(map[*sessionConn]struct{})
+	// canceled only once draining takes too long
+	sessionCtx, cancelSessions := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelSessions()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	sem := make(chan struct{}, s.maxConns)
+	var err error
+	for {
+		var conn net.Conn
+		conn, err = ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				err = nil
+			}
+			break
+		}
+		select {
+		case sem <- struct{}{}:
+		default:
+			fmt.Fprintln(conn, "Error: too many sessions, try again later")
+			conn.Close()
+			continue
+		}
+		s.wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				s.wg.Done()
+			}()
+			s.handle(sessionCtx, conn)
+		}()
+	}
+	ln.Close()
+
+	s.mu.Lock()
+	s.draining = true
+	for c := range s.conns {
+		c.drain()
+	}
+	s.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(s.drainTimeout):
+		cancelSessions()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			// stuck writing to a client that doesn't read
+			s.mu.Lock()
+			for c := range s.conns {
+				c.Close()
+			}
+			s.mu.Unlock()
+			<-done
+		}
+	}
+	return err
+}
+
+// handle runs a session on conn and closes it
+func (s *sessionServer) handle(ctx context.Context, conn net.Conn) {
+	c := &sessionConn{
+		Conn:        conn,
+		idleTimeout: s.idleTimeout,
+	}
+	defer conn.Close()
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		return
+	}
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+	}()
+
+	// ends with an error once idle, told to the client below
+	_ = s.repl.Run(ctx, c, c, c)
+
+	switch c.state() {
+	case connDraining:
+		fmt.Fprintln(c, "\nWarning: the server is shutting down, goodbye!")
+	case connIdle:
+		fmt.Fprintln(c, "\nWarning: the session was idle for too long, goodbye!")
+	}
+}
+
+const (
+	connOpen = iota
+	connIdle
+	connDraining
+)
+
+// sessionConn times out reads after idleTimeout, and ends them once the
+// server drains
+type sessionConn struct {
+	net.Conn
+	idleTimeout time.Duration
+
+	mu       sync.Mutex
+	idle     bool
+	draining bool
+}
+
+func (c *sessionConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	if c.draining {
+		c.mu.Unlock()
+		return 0, io.EOF
+	}
+	if c.idleTimeout > 0 {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
+	}
+	c.mu.Unlock()
+
+	n, err := c.Conn.Read(p)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		c.mu.Lock()
+		c.idle = !c.draining
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+// drain ends the pending read, if any, and every read after it
+func (c *sessionConn) drain() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.draining = true
+	_ = c.Conn.SetReadDeadline(time.Now())
+}
+
+func (c *sessionConn) state() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case c.draining:
+		return connDraining
+	case c.idle:
+		return connIdle
+	}
+	return connOpen
+}
@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/reddtsai/goREPL/pkg/storage"
+)
+
+type TestListen struct {
+	suite.Suite
+
+	storage storage.IStorage
+	addr    string
+	cancel  context.CancelFunc
+	done    chan error
+}
+
+func TestListenSuite(t *testing.T) {
+	suite.Run(t, new(TestListen))
+}
+
+func (t *TestListen) SetupTest() {
+	t.storage = storage.NewVirtualFileSysStorage()
+}
+
+func (t *TestListen) TearDownTest() {
+	if t.cancel != nil {
+		t.stop()
+	}
+}
+
+// start serves sessions on a random port
+func (t *TestListen) start(srv *sessionServer) {
+	repl := &Repl{
+		storage: t.storage,
+		rootCmd: &cobra.Command{Use: "repl"},
+	}
+	repl.AddRegisterCmd()
+	repl.AddCreateFolderCmd()
+	repl.AddListFoldersCmd()
+	repl.AddBeginCmd()
+	repl.AddCommitCmd()
+	repl.AddRollbackCmd()
+	srv.repl = repl
+	if srv.maxConns == 0 {
+		srv.maxConns = 8
+	}
+	if srv.drainTimeout == 0 {
+		srv.drainTimeout = time.Minute
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	t.Require().NoError(err)
+	t.addr = ln.Addr().String()
+	var ctx context.Context
+	ctx, t.cancel = context.WithCancel(context.Background())
+	t.done = make(chan error, 1)
+	go func() {
+		t.done <- srv.serve(ctx, ln)
+	}()
+}
+
+// stop shuts the server down and waits for it
+func (t *TestListen) stop() {
+	t.cancel()
+	t.cancel = nil
+	select {
+	case err := <-t.done:
+		t.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fail("the server didn't stop")
+	}
+}
+
+type testClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dial connects and reads up to the first prompt
+func (t *TestListen) dial() *testClient {
+	conn, err := net.Dial("tcp", t.addr)
+	t.Require().NoError(err)
+	t.T().Cleanup(func() {
+		conn.Close()
+	})
+	c := &testClient{conn: conn, r: bufio.NewReader(conn)}
+	t.Contains(t.prompt(c), "Please Enter Your Command")
+	return c
+}
+
+// prompt reads up to the next prompt
+func (t *TestListen) prompt(c *testClient) string {
+	var b strings.Builder
+	for !strings.HasSuffix(b.String(), "# ") {
+		r, _, err := c.r.ReadRune()
+		t.Require().NoError(err, b.String())
+		b.WriteRune(r)
+	}
+	return strings.TrimSuffix(b.String(), "# ")
+}
+
+// send runs line and returns its output
+func (t *TestListen) send(c *testClient, line string) string {
+	_, err := io.WriteString(c.conn, line+"\r\n")
+	t.Require().NoError(err)
+	return t.prompt(c)
+}
+
+// rest reads everything until the server closes the connection
+func (t *TestListen) rest(c *testClient) string {
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b, err := io.ReadAll(c.r)
+	t.NoError(err)
+	return string(b)
+}
+
+func (t *TestListen) TestSessions() {
+	t.start(&sessionServer{})
+	a, b := t.dial(), t.dial()
+
+	t.Equal("Add [alice] successfully\n", t.send(a, "register alice"))
+	t.Equal("Error: the [alice] has already existed\n", t.send(b, "register alice"))
+	t.Equal("Begin a transaction\n", t.send(a, "begin"))
+	t.Equal("Create [docs] successfully\n", t.send(a, "create-folder alice docs"))
+	t.Equal("Warning: the [alice] doesn't have any folders\n", t.send(b, "list-folders alice"))
+	t.Equal("Commit 1 changes successfully\n", t.send(a, "commit"))
+	t.Contains(t.send(b, "list-folders alice"), "docs")
+
+	_, err := io.WriteString(a.conn, "exit\n")
+	t.Require().NoError(err)
+	t.Equal("Goodbye!\n", t.rest(a))
+	t.Contains(t.send(b, "list-folders alice"), "docs")
+}
+
+func (t *TestListen) TestSessionFlags() {
+	ctx := context.Background()
+	t.Require().NoError(t.storage.AddUser(ctx, "alice"))
+	for _, name := range []string{"b", "a", "c"} {
+		t.Require().NoError(t.storage.AddFolder(ctx, "alice", name, ""))
+	}
+	t.start(&sessionServer{})
+
+	// each session runs its own flags at the same time as the other
+	run := func(c *testClient, line, first string, done chan<- bool) {
+		ok := true
+		for i := 0; i < 50; i++ {
+			ok = ok && strings.HasPrefix(t.send(c, line), first)
+		}
+		done <- ok
+	}
+	done := make(chan bool)
+	go run(t.dial(), "list-folders alice --sort-name desc", "c ", done)
+	go run(t.dial(), "list-folders alice", "a ", done)
+	t.True(<-done)
+	t.True(<-done)
+}
+
+func (t *TestListen) TestMaxConns() {
+	t.start(&sessionServer{maxConns: 1})
+	a := t.dial()
+
+	conn, err := net.Dial("tcp", t.addr)
+	t.Require().NoError(err)
+	defer conn.Close()
+	b, err := io.ReadAll(conn)
+	t.NoError(err)
+	t.Equal("Error: too many sessions, try again later\n", string(b))
+
+	t.Equal("Add [alice] successfully\n", t.send(a, "register alice"))
+	_, err = io.WriteString(a.conn, "exit\n")
+	t.Require().NoError(err)
+	t.rest(a)
+	// the slot is freed once the session ends
+	t.Eventually(func() bool {
+		conn, err := net.Dial("tcp", t.addr)
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		return strings.HasPrefix(line, "=====")
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func (t *TestListen) TestIdleTimeout() {
+	t.start(&sessionServer{idleTimeout: 100 * time.Millisecond})
+	a := t.dial()
+	t.Equal("Begin a transaction\n", t.send(a, "begin"))
+	t.Equal("Warning: the open transaction was rolled back\n\nWarning: the session was idle for too long, goodbye!\n", t.rest(a))
+}
+
+func (t *TestListen) TestDrain() {
+	blocking := &blockingStorage{
+		IStorage: t.storage,
+		started:  make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	t.storage = blocking
+	t.start(&sessionServer{})
+	a, b := t.dial(), t.dial()
+
+	_, err := io.WriteString(a.conn, "register alice\n")
+	t.Require().NoError(err)
+	<-blocking.started
+	t.cancel()
+	// new connections are refused while draining
+	t.Eventually(func() bool {
+		conn, err := net.Dial("tcp", t.addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	t.Equal("\nWarning: the server is shutting down, goodbye!\n", t.rest(b))
+
+	close(blocking.release)
+	t.Equal("Add [alice] successfully\n# \nWarning: the server is shutting down, goodbye!\n", t.rest(a))
+	t.cancel = func() {}
+	t.stop()
+	t.True(t.storage.IsExistUser(context.Background(), "alice"))
+}
+
+func (t *TestListen) TestDrainTimeout() {
+	blocking := &blockingStorage{
+		IStorage: t.storage,
+		started:  make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	t.storage = blocking
+	t.start(&sessionServer{drainTimeout: 50 * time.Millisecond})
+	a := t.dial()
+
+	_, err := io.WriteString(a.conn, "register alice\n")
+	t.Require().NoError(err)
+	<-blocking.started
+	t.stop()
+	t.Equal("Error: the command was canceled\n# \nWarning: the server is shutting down, goodbye!\n", t.rest(a))
+}
+
+// blockingStorage blocks AddUser until released or canceled
+type blockingStorage struct {
+	storage.IStorage
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStorage) AddUser(ctx context.Context, userName string) error {
+	close(s.started)
+	select {
+	case <-s.release:
+		return s.IStorage.AddUser(ctx, userName)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,539 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/reddtsai/goREPL/pkg/policy"
+)
+
+// maxMacroDepth is how deep macros may run each other
+const maxMacroDepth = 16
+
+var (
+	cmdNamePolicy = policy.New(
+		policy.Length(1, 100, policy.Bytes),
+		policy.Charset("a-zA-Z0-9", "-_"),
+		policy.ForbiddenPrefixes("-", "_", "0", "1", "2", "3", "4", "5", "6", "7", "8", "9"),
+	)
+	paramRe = regexp.MustCompile(`\$([1-9][0-9]*|@)`)
+	// plainArgRe matches the arguments kept as they are by quoteArgs
+	plainArgRe = regexp.MustCompile(`^[a-zA-Z0-9\.\-\~\_\=\:\/\@\$\%\+\,]+$`)
+)
+
+// definitions holds the aliases and the macros of a Repl, the sessions of
+// Run start with a copy of them. Once opened from an rc file, it's
+// rewritten with them on every change.
+type definitions struct {
+	mu sync.Mutex
+	// aliases hold the words an alias stands for, macros the command
+	// lines they run
+	aliases map[string][]string
+	macros  map[string][]string
+	rc      string
+	// loading is set while the rc file runs, its lines are in it already
+	loading bool
+}
+
+func newDefinitions() *definitions {
+	return &definitions{
+		aliases: make(map[string][]string),
+		macros:  make(map[string][]string),
+	}
+}
+
+func (d *definitions) alias(name string) ([]string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	words, ok := d.aliases[name]
+	return words, ok
+}
+
+func (d *definitions) macro(name string) ([]string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lines, ok := d.macros[name]
+	return lines, ok
+}
+
+// names returns the aliases and the macros starting with prefix
+func (d *definitions) names(prefix string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var names []string
+	for _, m := range []map[string][]string{d.aliases, d.macros} {
+		for name := range m {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// of returns the aliases for the alias kind, the macros for macro, and the
+// other kind
+func (d *definitions) of(kind string) (m, other map[string][]string) {
+	if kind == "alias" {
+		return d.aliases, d.macros
+	}
+	return d.macros, d.aliases
+}
+
+// set defines name as a kind, alias or macro, or removes it for nil words,
+// and rewrites the rc file with the definitions then, before they change.
+// A name is either an alias or a macro.
+func (d *definitions) set(kind, name string, words []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	m, other := d.of(kind)
+	next := make(map[string][]string, len(m)+1)
+	for n, w := range m {
+		next[n] = w
+	}
+	if words == nil {
+		if _, ok := m[name]; !ok {
+			return fmt.Errorf("the [%s] doesn't exist", name)
+		}
+		delete(next, name)
+	} else {
+		if _, ok := other[name]; ok {
+			return fmt.Errorf("the [%s] has already existed", name)
+		}
+		next[name] = words
+	}
+	aliases, macros := next, other
+	if kind != "alias" {
+		aliases, macros = other, next
+	}
+	if d.rc != "" && !d.loading {
+		lines := append(defineLines("alias", aliases), defineLines("macro", macros)...)
+		err := writeFileAtomic(d.rc, []byte(strings.Join(append(lines, ""), "\n")))
+		if err != nil {
+			return err
+		}
+	}
+	d.aliases, d.macros = aliases, macros
+	return nil
+}
+
+// writeFileAtomic writes data to a temp file next to path, then renames it
+// over path, so a crash leaves either the old file or the new one
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// copy returns the aliases and the macros of d, a nil d has none, for a
+// session of its own. The changes to the copy aren't kept in the rc file.
+func (d *definitions) copy() *definitions {
+	c := newDefinitions()
+	if d == nil {
+		return c
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for name, words := range d.aliases {
+		c.aliases[name] = words
+	}
+	for name, lines := range d.macros {
+		c.macros[name] = lines
+	}
+	return c
+}
+
+// list returns the commands defining the aliases or the macros, by name
+func (d *definitions) list(kind string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	m, _ := d.of(kind)
+	return defineLines(kind, m)
+}
+
+// defineLines returns the commands defining m of kind, by name
+func defineLines(kind string, m map[string][]string) []string {
+	lines := make([]string, 0, len(m))
+	for name, words := range m {
+		lines = append(lines, quoteArgs(append([]string{kind, name}, words...)))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// definitions returns the aliases and the macros of r, empty ones until
+// opened
+func (r *Repl) definitions() *definitions {
+	if r.defs == nil {
+		r.defs = newDefinitions()
+	}
+	return r.defs
+}
+
+// openRC runs the rc file set, or on a terminal the one in the config dir,
+// keeping the aliases and the macros defined later in it. Only the
+// interactive loop and listen open it, a script and a one-shot command
+// don't depend on it.
+func (r *Repl) openRC(cmd *cobra.Command, terminal bool) {
+	r.defs = newDefinitions()
+	path := r.setting("rc")
+	if path == "" && !terminal {
+		return
+	}
+	var err error
+	if path == "" {
+		var dir string
+		dir, err = os.UserConfigDir()
+		path = filepath.Join(dir, "goREPL", "rc")
+	}
+	if err == nil {
+		err = r.runRC(cmd, path)
+	}
+	if err != nil && !errors.Is(err, errCommandsFailed) {
+		fmt.Fprintln(cmd.ErrOrStderr(), "Warning: the aliases and macros aren't kept,", err)
+	}
+}
+
+// runRC runs the commands in the rc file at path, if any, then keeps the
+// aliases and the macros defined in it
+func (r *Repl) runRC(cmd *cobra.Command, path string) error {
+	defs := r.definitions()
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		defs.rc = path
+		return os.MkdirAll(filepath.Dir(path), 0o700)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	defs.loading = true
+	err = r.runLines(cmd, f, "rc line", true)
+	defs.loading = false
+	defs.rc = path
+	return err
+}
+
+// expandAlias replaces an alias at the start of args with the words it
+// stands for, again while they start with another alias
+func (r *Repl) expandAlias(args []string) []string {
+	seen := make(map[string]bool)
+	for len(args) > 0 && !seen[args[0]] {
+		words, ok := r.definitions().alias(args[0])
+		if !ok {
+			break
+		}
+		seen[args[0]] = true
+		args = append(append([]string(nil), words...), args[1:]...)
+	}
+	return args
+}
+
+// macroError is returned for a macro that can't run, it isn't printed by
+// a command
+type macroError struct {
+	err error
+}
+
+func (e *macroError) Error() string {
+	return e.err.Error()
+}
+
+// runMacro runs the command lines of the macro name with params in place
+// of $1, $2... and $@, stopping at the first failing one
+func (r *Repl) runMacro(ctx context.Context, cmd *cobra.Command, name string, lines, params []string) error {
+	if r.depth >= maxMacroDepth {
+		return &macroError{fmt.Errorf("the [%s] runs more than %d macros deep", name, maxMacroDepth)}
+	}
+	if n := macroParams(lines); len(params) < n {
+		return &macroError{fmt.Errorf("the [%s] needs %d arguments", name, n)}
+	}
+	r.depth++
+	defer func() {
+		r.depth--
+	}()
+	for _, line := range lines {
+		words, err := r.SplitArgs(line)
+		if err != nil {
+			return &macroError{fmt.Errorf("the [%s]: %w", name, err)}
+		}
+		args := substituteParams(words, params)
+		if len(args) == 0 {
+			continue
+		}
+		err = r.exec(ctx, cmd, args)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// macroParams returns the highest $n in lines
+func macroParams(lines []string) int {
+	n := 0
+	for _, line := range lines {
+		for _, m := range paramRe.FindAllStringSubmatch(line, -1) {
+			if i, err := strconv.Atoi(m[1]); err == nil {
+				n = max(n, i)
+			}
+		}
+	}
+	return n
+}
+
+// substituteParams replaces $n in words with the nth of params and $@ with
+// all of them, a word of $@ alone with a word each
+func substituteParams(words, params []string) []string {
+	var args []string
+	for _, w := range words {
+		if w == "$@" {
+			args = append(args, params...)
+			continue
+		}
+		args = append(args, paramRe.ReplaceAllStringFunc(w, func(p string) string {
+			if p == "$@" {
+				return strings.Join(params, " ")
+			}
+			i, _ := strconv.Atoi(p[1:])
+			return params[i-1]
+		}))
+	}
+	return args
+}
+
+// quoteArgs joins args into a line SplitArgs splits into args again
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if plainArgRe.MatchString(arg) {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// validateCmdName checks the name of a new alias or macro
+func (r *Repl) validateCmdName(name string) error {
+	if err := cmdNamePolicy.Check(name); err != nil {
+		return err
+	}
+	if c, _, err := r.rootCmd.Find([]string{name}); (err == nil && c != r.rootCmd) || name == "exit" || name == "help" {
+		return fmt.Errorf("the [%s] is a command", name)
+	}
+	return nil
+}
+
+func (r *Repl) AddAliasCmd() {
+	cmd := &cobra.Command{
+		Use:   "alias",
+		Short: "define a name for a command",
+		RunE:  r.AliasRunner,
+		// the flags belong to the command aliased
+		DisableFlagParsing: true,
+	}
+	cmd.SetUsageTemplate("Usage:\n  alias [name]? [command]?")
+
+	r.addCommand(cmd, (*Repl).AddAliasCmd)
+}
+
+// AliasRunner lists the aliases, shows one, or defines it as the rest of
+// the arguments
+func (r *Repl) AliasRunner(cmd *cobra.Command, args []string) error {
+	defs := r.definitions()
+	out := cmd.OutOrStdout()
+	switch len(args) {
+	case 0:
+		printLines(out, defs.list("alias"))
+		return nil
+	case 1:
+		words, ok := defs.alias(args[0])
+		if !ok {
+			return fmt.Errorf("the [%s] doesn't exist", args[0])
+		}
+		fmt.Fprintln(out, quoteArgs(append([]string{"alias", args[0]}, words...)))
+		return nil
+	}
+	err := r.validateCmdName(args[0])
+	if err != nil {
+		return err
+	}
+	err = defs.set("alias", args[0], args[1:])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Define [%s] successfully\n", args[0])
+	return nil
+}
+
+func (r *Repl) AddUnaliasCmd() {
+	cmd := &cobra.Command{
+		Use:   "unalias",
+		Short: "remove an alias",
+		Args:  r.UndefineValidation,
+		RunE:  r.UnaliasRunner,
+	}
+	cmd.SetUsageTemplate("Usage:\n  unalias [name]")
+
+	r.addCommand(cmd, (*Repl).AddUnaliasCmd)
+}
+
+func (r *Repl) UndefineValidation(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	if len(args) != 1 {
+		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
+	}
+
+	return nil
+}
+
+func (r *Repl) UnaliasRunner(cmd *cobra.Command, args []string) error {
+	err := r.definitions().set("alias", args[0], nil)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Remove [%s] successfully\n", args[0])
+	return nil
+}
+
+func (r *Repl) AddMacroCmd() {
+	cmd := &cobra.Command{
+		Use:   "macro",
+		Short: "define a name for command lines",
+		Args:  r.MacroValidation,
+		RunE:  r.MacroRunner,
+		// the flags belong to the command lines
+		DisableFlagParsing: true,
+	}
+	cmd.SetUsageTemplate("Usage:\n  macro [name] [command-line]...?")
+
+	r.addCommand(cmd, (*Repl).AddMacroCmd)
+}
+
+func (r *Repl) MacroValidation(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	if len(args) == 0 {
+		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
+	}
+
+	return nil
+}
+
+// MacroRunner shows a macro, or defines it as the command lines in the rest
+// of the arguments
+func (r *Repl) MacroRunner(cmd *cobra.Command, args []string) error {
+	defs := r.definitions()
+	out := cmd.OutOrStdout()
+	if len(args) == 1 {
+		lines, ok := defs.macro(args[0])
+		if !ok {
+			return fmt.Errorf("the [%s] doesn't exist", args[0])
+		}
+		fmt.Fprintln(out, quoteArgs(append([]string{"macro", args[0]}, lines...)))
+		return nil
+	}
+	err := r.validateCmdName(args[0])
+	if err != nil {
+		return err
+	}
+	for _, line := range args[1:] {
+		if _, err := r.SplitArgs(line); err != nil {
+			return fmt.Errorf("the [%s]: %w", line, err)
+		}
+	}
+	err = defs.set("macro", args[0], args[1:])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Define [%s] successfully\n", args[0])
+	return nil
+}
+
+func (r *Repl) AddMacrosCmd() {
+	cmd := &cobra.Command{
+		Use:   "macros",
+		Short: "list the macros",
+		Args:  r.MacrosValidation,
+		RunE:  r.MacrosRunner,
+	}
+	cmd.SetUsageTemplate("Usage:\n  macros")
+
+	r.addCommand(cmd, (*Repl).AddMacrosCmd)
+}
+
+func (r *Repl) MacrosValidation(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	if len(args) != 0 {
+		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
+	}
+
+	return nil
+}
+
+func (r *Repl) MacrosRunner(cmd *cobra.Command, args []string) error {
+	printLines(cmd.OutOrStdout(), r.definitions().list("macro"))
+	return nil
+}
+
+func (r *Repl) AddUnmacroCmd() {
+	cmd := &cobra.Command{
+		Use:   "unmacro",
+		Short: "remove a macro",
+		Args:  r.UndefineValidation,
+		RunE:  r.UnmacroRunner,
+	}
+	cmd.SetUsageTemplate("Usage:\n  unmacro [name]")
+
+	r.addCommand(cmd, (*Repl).AddUnmacroCmd)
+}
+
+func (r *Repl) UnmacroRunner(cmd *cobra.Command, args []string) error {
+	err := r.definitions().set("macro", args[0], nil)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Remove [%s] successfully\n", args[0])
+	return nil
+}
+
+func printLines(out io.Writer, lines []string) {
+	for _, line := range lines {
+		fmt.Fprintln(out, line)
+	}
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/reddtsai/goREPL/pkg/storage"
+)
+
+type TestMacro struct {
+	suite.Suite
+
+	repl    *Repl
+	storage storage.IStorage
+}
+
+func TestMacroSuite(t *testing.T) {
+	suite.Run(t, new(TestMacro))
+}
+
+func (t *TestMacro) SetupTest() {
+	t.storage = storage.NewVirtualFileSysStorage()
+	t.repl = &Repl{
+		storage: t.storage,
+		rootCmd: &cobra.Command{Use: "repl"},
+	}
+	t.repl.AddRegisterCmd()
+	t.repl.AddCreateFolderCmd()
+	t.repl.AddListFoldersCmd()
+	t.repl.AddCreateFileCmd()
+	t.repl.AddListFilesCmd()
+	t.repl.AddAliasCmd()
+	t.repl.AddUnaliasCmd()
+	t.repl.AddMacroCmd()
+	t.repl.AddMacrosCmd()
+	t.repl.AddUnmacroCmd()
+}
+
+// run feeds input to a session and returns what it printed
+func (t *TestMacro) run(input string) string {
+	var out bytes.Buffer
+	err := t.repl.Run(context.Background(), strings.NewReader(input), &out, &out)
+	t.Require().NoError(err)
+	return out.String()
+}
+
+func (t *TestMacro) TestAlias() {
+	out := t.run("alias reg register\nalias lf list-folders --sort-name desc\nreg alice\ncreate-folder alice a\ncreate-folder alice b\n" +
+		"lf alice\nalias\nalias lf\nunalias reg\nreg bob\nunalias reg\nalias x\n")
+	t.Contains(out, "# Define [reg] successfully\n")
+	t.Contains(out, "# Add [alice] successfully\n")
+	t.Contains(out, "# b  ")
+	t.Less(strings.Index(out, "# b  "), strings.Index(out, "\na  "))
+	t.Contains(out, "# alias lf list-folders --sort-name desc\nalias reg register\n")
+	t.Contains(out, "# alias lf list-folders --sort-name desc\n# Remove [reg] successfully\n")
+	t.Contains(out, "# Error: unrecognized command.\n# Error: the [reg] doesn't exist\n")
+	t.Contains(out, "# Error: the [x] doesn't exist\n")
+}
+
+func (t *TestMacro) TestAliasName() {
+	out := t.run("alias register list-folders\nalias 1x register\nalias help register\nalias a a\na\nmacro a register $1\n")
+	t.Contains(out, "# Error: the [register] is a command\n")
+	t.Contains(out, "# Error: the [1x] can't start with [1]\n")
+	t.Contains(out, "# Error: the [help] is a command\n")
+	// an alias of itself isn't expanded again
+	t.Contains(out, "# Define [a] successfully\n# Error: unrecognized command.\n")
+	t.Contains(out, "# Error: the [a] has already existed\n")
+}
+
+func (t *TestMacro) TestMacro() {
+	out := t.run("register alice\n" +
+		"macro project 'create-folder $1 $2' 'create-file $1 $2 readme \"$3\"' 'create-file $1 $2 $4 \"all: $@\"'\n" +
+		"project alice\nproject alice work 'the readme' todo\nlist-files alice work\nmacros\nmacro project\nunmacro project\nproject alice\n")
+	t.Contains(out, "# Define [project] successfully\n")
+	t.Contains(out, "# Error: the [project] needs 4 arguments\n")
+	t.Contains(out, "# Create [work] successfully\n"+
+		"Create [readme] in [alice]/[work] successfully\n"+
+		"Create [todo] in [alice]/[work] successfully\n")
+	t.Contains(out, "readme the readme ")
+	t.Contains(out, "todo all: alice work the readme todo ")
+	t.Contains(out, "# macro project 'create-folder $1 $2' 'create-file $1 $2 readme \"$3\"' 'create-file $1 $2 $4 \"all: $@\"'\n# macro project")
+	t.Contains(out, "# Remove [project] successfully\n# Error: unrecognized command.\n")
+}
+
+func (t *TestMacro) TestMacroStops() {
+	out := t.run("macro twice 'register $1' 'register $1' 'create-folder $1 never'\ntwice alice\n" +
+		"macro loop loop\nloop\n")
+	t.Contains(out, "# Add [alice] successfully\nError: the [alice] has already existed\n#")
+	t.False(t.storage.IsExistFolder(context.Background(), "alice", "never"))
+	t.Contains(out, "# Error: the [loop] runs more than 16 macros deep\n")
+}
+
+func (t *TestMacro) TestSubstituteParams() {
+	params := []string{"a b", "c"}
+	t.Equal([]string{"x", "a b", "c", "y"}, substituteParams([]string{"x", "$@", "y"}, params))
+	t.Equal([]string{"a b-c", "[a b c]", "$0"}, substituteParams([]string{"$1-$2", "[$@]", "$0"}, params))
+	t.Equal(3, macroParams([]string{"a $1", "b $3 $@"}))
+}
+
+func (t *TestMacro) TestQuoteArgs() {
+	args := []string{"list-files", "--sort-name", "it's", "", "a b", "$1"}
+	line := quoteArgs(args)
+	t.Equal(`list-files --sort-name 'it'\''s' '' 'a b' $1`, line)
+	split, err := t.repl.SplitArgs(line)
+	t.NoError(err)
+	t.Equal(args, split)
+}
+
+func (t *TestMacro) TestRC() {
+	rc := filepath.Join(t.T().TempDir(), "goREPL", "rc")
+	var out bytes.Buffer
+	t.repl.rootCmd.SetOut(&out)
+	t.repl.rootCmd.SetErr(&out)
+	t.repl.rootCmd.SetContext(context.Background())
+	// execute
+	t.Require().NoError(t.repl.runRC(t.repl.rootCmd, rc))
+	err := t.repl.exec(context.Background(), t.repl.rootCmd, []string{"alias", "lf", "list-folders", "--sort-name", "desc"})
+	t.Require().NoError(err)
+	err = t.repl.exec(context.Background(), t.repl.rootCmd, []string{"macro", "reg2", "register $1", "register $2"})
+	t.Require().NoError(err)
+	err = t.repl.exec(context.Background(), t.repl.rootCmd, []string{"unalias", "lf"})
+	t.Require().NoError(err)
+	b, err := os.ReadFile(rc)
+	t.Require().NoError(err)
+	t.Equal("macro reg2 'register $1' 'register $2'\n", string(b))
+	// testing
+	t.Require().NoError(os.WriteFile(rc, append(b, "bad\n"...), 0o600))
+	t.repl.defs = nil
+	err = t.repl.runRC(t.repl.rootCmd, rc)
+	t.ErrorIs(err, errCommandsFailed)
+	t.Contains(out.String(), "Error: rc line 2: unrecognized command\n")
+	_, ok := t.repl.definitions().alias("lf")
+	t.False(ok)
+	_, ok = t.repl.definitions().macro("reg2")
+	t.True(ok)
+	// the rc file isn't added to while it runs
+	after, err := os.ReadFile(rc)
+	t.Require().NoError(err)
+	t.Equal(append(b, "bad\n"...), after)
+	// a change the rc file can't keep isn't made
+	t.repl.defs.rc = filepath.Join(t.T().TempDir(), "missing", "rc")
+	err = t.repl.exec(context.Background(), t.repl.rootCmd, []string{"unmacro", "reg2"})
+	t.Error(err)
+	_, ok = t.repl.definitions().macro("reg2")
+	t.True(ok)
+}
+
+func (t *TestMacro) TestSessionDefinitions() {
+	rc := filepath.Join(t.T().TempDir(), "rc")
+	t.Require().NoError(os.WriteFile(rc, []byte("alias reg register\n"), 0o600))
+	t.repl.rootCmd.SetOut(&bytes.Buffer{})
+	t.repl.rootCmd.SetContext(context.Background())
+	t.Require().NoError(t.repl.runRC(t.repl.rootCmd, rc))
+	// each session starts with the rc file and keeps its changes to itself
+	out := t.run("reg alice\nalias lf list-folders\nunalias reg\nmacro m 'register $1'\n")
+	t.Contains(out, "# Add [alice] successfully\n")
+	t.Contains(out, "# Remove [reg] successfully\n")
+	out = t.run("reg bob\nlf bob\nm carol\n")
+	t.Contains(out, "# Add [bob] successfully\n")
+	t.Contains(out, "# Error: unrecognized command.\n")
+	t.NotContains(out, "carol")
+	b, err := os.ReadFile(rc)
+	t.Require().NoError(err)
+	t.Equal("alias reg register\n", string(b))
+}
+
+func (t *TestMacro) TestComplete() {
+	t.Require().NoError(t.storage.AddUser(context.Background(), "alice"))
+	t.Require().NoError(t.repl.definitions().set("alias", "lf", []string{"list-folders"}))
+	t.Equal([]string{"lf", "list-files", "list-folders"}, t.repl.Complete(context.Background(), "l"))
+	t.Equal([]string{"alice"}, t.repl.Complete(context.Background(), "lf "))
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"context"
+	"sync"
+	"unicode"
+
+	"github.com/reddtsai/goREPL/pkg/norm"
+	"github.com/reddtsai/goREPL/pkg/policy"
+	"github.com/reddtsai/goREPL/pkg/storage"
+)
+
+// nameTables are the runes of the names in the Unicode mode besides the
+// chars of the policies, the letters, marks and digits of any script
+var nameTables = []*unicode.RangeTable{unicode.L, unicode.M, unicode.Nd}
+
+var (
+	// unicodeUserNamePolicy and unicodeNamePolicy take the place of
+	// userNamePolicy and namePolicy in the Unicode mode, lengths counted in
+	// runes
+	unicodeUserNamePolicy = userNamePolicy.
+				With(policy.Length(3, 20, policy.Runes)).
+				With(policy.UnicodeCharset(nameTables, ""))
+	unicodeNamePolicy = namePolicy.
+				With(policy.Length(1, 100, policy.Runes)).
+				With(policy.UnicodeCharset(nameTables, ".-~_=:"))
+)
+
+// naming tells how names are checked, as the names setting tells: ASCII
+// names by default, or in the Unicode mode the names of any script, kept in
+// NFC and not confusable with their siblings
+type naming struct {
+	unicode bool
+}
+
+// naming returns the naming of the names setting
+func (r *Repl) naming() naming {
+	return naming{unicode: r.setting("names") == "unicode"}
+}
+
+// normalize returns name as it's kept, in NFC in the Unicode mode
+func (n naming) normalize(name string) string {
+	if !n.unicode {
+		return name
+	}
+	return norm.NFC(name)
+}
+
+// checkUser checks a user name, normalized
+func (n naming) checkUser(userName string) error {
+	if n.unicode {
+		return unicodeUserNamePolicy.Check(n.normalize(userName))
+	}
+	return userNamePolicy.Check(userName)
+}
+
+// checkName checks a folder or file name, normalized
+func (n naming) checkName(name string) error {
+	if n.unicode {
+		return unicodeNamePolicy.Check(n.normalize(name))
+	}
+	return namePolicy.Check(name)
+}
+
+// addSibling runs add, adding name, unless in the Unicode mode name is
+// confusable with one of the names list returns, those of its siblings
+// under parent. The check and add are done under the lock of parent, so two
+// sessions of the process can't both add confusable names. Another process
+// sharing the storage, or a transaction committed later, isn't held off.
+// list isn't called in the ASCII mode.
+func (n naming) addSibling(parent, name string, list func() ([]string, error), add func() error) error {
+	if !n.unicode {
+		return add()
+	}
+	unlock := lockSiblings(parent)
+	defer unlock()
+
+	names, err := list()
+	if err != nil {
+		return err
+	}
+	err = policy.New(policy.Confusable(names...)).Check(name)
+	if err != nil {
+		return err
+	}
+	return add()
+}
+
+// siblingLocks hold a lock per parent in use, the users, a user or a folder
+var siblingLocks = struct {
+	mu    sync.Mutex
+	locks map[string]*siblingLock
+}{locks: make(map[string]*siblingLock)}
+
+type siblingLock struct {
+	sync.Mutex
+	// refs counts the holders and the waiters
+	refs int
+}
+
+// parentKey returns the parent of the names under the user and the folder,
+// "" for the users
+func parentKey(userName, folderName string) string {
+	if userName == "" {
+		return ""
+	}
+	return storage.NameKey(userName) + "/" + storage.NameKey(folderName)
+}
+
+// lockSiblings takes the lock of parent, and returns a func releasing it
+func lockSiblings(parent string) func() {
+	siblingLocks.mu.Lock()
+	l, ok := siblingLocks.locks[parent]
+	if !ok {
+		l = &siblingLock{}
+		siblingLocks.locks[parent] = l
+	}
+	l.refs++
+	siblingLocks.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		siblingLocks.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(siblingLocks.locks, parent)
+		}
+		siblingLocks.mu.Unlock()
+	}
+}
+
+// userNames lists the users of s
+func userNames(ctx context.Context, s storage.IStorage) func() ([]string, error) {
+	return func() ([]string, error) {
+		return s.ListUser(ctx)
+	}
+}
+
+// folderNames lists the folders of the user but the one named except
+func folderNames(ctx context.Context, s storage.IStorage, userName, except string) func() ([]string, error) {
+	return func() ([]string, error) {
+		folders, err := s.ListFolder(ctx, userName, "name", "asc")
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(folders))
+		for _, f := range folders {
+			if storage.NameKey(f.FolderName) != storage.NameKey(except) {
+				names = append(names, f.FolderName)
+			}
+		}
+		return names, nil
+	}
+}
+
+// fileNames lists the files of the folder of the user
+func fileNames(ctx context.Context, s storage.IStorage, userName, folderName string) func() ([]string, error) {
+	return func() ([]string, error) {
+		files, err := s.ListFile(ctx, userName, folderName, "name", "asc")
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(files))
+		for _, f := range files {
+			names = append(names, f.FileName)
+		}
+		return names, nil
+	}
+}
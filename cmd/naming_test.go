@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/reddtsai/goREPL/pkg/storage"
+)
+
+type TestNaming struct {
+	suite.Suite
+
+	repl    *Repl
+	storage storage.IStorage
+}
+
+func TestNamingSuite(t *testing.T) {
+	suite.Run(t, new(TestNaming))
+}
+
+func (t *TestNaming) SetupTest() {
+	t.storage = storage.NewVirtualFileSysStorage()
+	t.repl = &Repl{
+		storage: t.storage,
+		rootCmd: &cobra.Command{Use: "repl"},
+		config:  newConfig(),
+	}
+	t.Require().NoError(t.repl.config.set("names", "unicode", "test"))
+	t.repl.AddRegisterCmd()
+	t.repl.AddCreateFolderCmd()
+	t.repl.AddListFoldersCmd()
+	t.repl.AddRenameFolderCmd()
+	t.repl.AddCreateFileCmd()
+	t.repl.AddListFilesCmd()
+}
+
+// run feeds input to a session and returns what it printed
+func (t *TestNaming) run(input string) string {
+	var out bytes.Buffer
+	err := t.repl.Run(context.Background(), strings.NewReader(input), &out, &out)
+	t.Require().NoError(err)
+	return out.String()
+}
+
+func (t *TestNaming) TestUnicode() {
+	out := t.run("register Ђорђе\ncreate-folder ђорђе Cafe\u0301\ncreate-folder ЂОРЂЕ CAFÉ\n" +
+		"create-file ђорђе café 東京.txt\nlist-files ђорђе CAFE\u0301\nlist-folders ђорђе\n")
+	t.Contains(out, "Add [Ђорђе] successfully\n")
+	// kept in NFC
+	t.Contains(out, "Create [Café] successfully\n")
+	t.Contains(out, "Error: the [CAFÉ] has already existed\n")
+	t.Contains(out, "Create [東京.txt] in [ђорђе]/[café] successfully\n")
+	t.Contains(out, "東京.txt  ")
+	t.Contains(out, "Café  ")
+}
+
+func (t *TestNaming) TestLength() {
+	// the lengths are counted in runes
+	out := t.run("register Ωμέγα\nregister Ωμ\ncreate-folder Ωμέγα " + strings.Repeat("é", 100) + "\n" +
+		"create-folder Ωμέγα " + strings.Repeat("é", 101) + "\n")
+	t.Contains(out, "Add [Ωμέγα] successfully\n")
+	t.Contains(out, "Error: the [Ωμ] invalid length\n")
+	t.Contains(out, "Create ["+strings.Repeat("é", 100)+"] successfully\n")
+	t.Contains(out, "Error: the ["+strings.Repeat("é", 101)+"] invalid length\n")
+}
+
+func (t *TestNaming) TestConfusable() {
+	// with a Cyrillic a, \u0430, a Greek o, \u03bf, and a Cyrillic
+	// palochka, \u04cf
+	out := t.run("register alice\nregister \u0430lice\ncreate-folder alice paypal\ncreate-folder alice p\u0430ypal\n" +
+		"create-file alice paypal Notes\ncreate-file alice paypal N\u03bftes\n" +
+		"create-folder alice other\nrename-folder alice other p\u0430yp\u0430l\nrename-folder alice paypal PAYP\u0410L\n" +
+		"create-folder alice \u043f\u0430\u0443\u0440\u0430\u04cf\n")
+	t.Contains(out, "Error: the [\u0430lice] looks like [alice]\n")
+	t.Contains(out, "Error: the [p\u0430ypal] looks like [paypal]\n")
+	t.Contains(out, "Error: the [N\u03bftes] looks like [Notes]\n")
+	t.Contains(out, "Error: the [p\u0430yp\u0430l] looks like [paypal]\n")
+	// a folder may look like itself
+	t.Contains(out, "Rename [paypal] to [PAYP\u0410L] successfully\n")
+	// a name of a single script is fine
+	t.Contains(out, "Create [\u043f\u0430\u0443\u0440\u0430\u04cf] successfully\n")
+}
+
+// slowList widens the window between the check of a name and its adding
+type slowList struct {
+	storage.IStorage
+}
+
+func (s slowList) ListUser(ctx context.Context) ([]string, error) {
+	users, err := s.IStorage.ListUser(ctx)
+	time.Sleep(10 * time.Millisecond)
+	return users, err
+}
+
+func (t *TestNaming) TestConfusableConcurrent() {
+	t.repl.storage = slowList{t.storage}
+	// alice with a Cyrillic a, i and e
+	names := []string{"alice", "\u0430lice", "al\u0456ce", "alic\u0435"}
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			var out bytes.Buffer
+			_ = t.repl.Run(context.Background(), strings.NewReader("register "+name+"\n"), &out, &out)
+		}(name)
+	}
+	wg.Wait()
+	users, err := t.storage.ListUser(context.Background())
+	t.Require().NoError(err)
+	t.Len(users, 1)
+}
+
+func (t *TestNaming) TestASCII() {
+	t.Require().NoError(t.repl.config.set("names", "ascii", "test"))
+	out := t.run("register Ђорђе\nregister alice\ncreate-folder alice Café\ncreate-folder alice paypal\n")
+	t.Contains(out, "Error: the [Ђорђе] contain invalid chars\n")
+	t.Contains(out, "Error: the [Café] contain invalid chars\n")
+	t.Contains(out, "Create [paypal] successfully\n")
+	t.Error(t.repl.config.set("names", "latin", "test"))
+}
+
+func (t *TestNaming) TestServer() {
+	srv := httptest.NewServer(newHandler(t.storage, 0, naming{unicode: true}))
+	defer srv.Close()
+
+	location := ""
+	post := func(path, name string) (int, APIError) {
+		b, err := json.Marshal(APIRequest{Name: name})
+		t.Require().NoError(err)
+		resp, err := http.Post(srv.URL+path, "application/json", bytes.NewReader(b))
+		t.Require().NoError(err)
+		defer resp.Body.Close()
+		location = resp.Header.Get("Location")
+		var e APIError
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return resp.StatusCode, e
+	}
+	status, _ := post("/users", "Ђорђе")
+	t.Equal(http.StatusCreated, status)
+	t.Equal("/users/%D0%82%D0%BE%D1%80%D1%92%D0%B5", location)
+	status, _ = post("/users/ђорђе/folders", "Cafe\u0301")
+	t.Equal(http.StatusCreated, status)
+	t.Equal("/users/%D1%92%D0%BE%D1%80%D1%92%D0%B5/folders/Caf%C3%A9", location)
+	status, _ = post("/users/ђорђе/folders/café/files", "東京.txt")
+	t.Equal(http.StatusCreated, status)
+	t.Equal("/users/%D1%92%D0%BE%D1%80%D1%92%D0%B5/folders/caf%C3%A9/files/%E6%9D%B1%E4%BA%AC.txt", location)
+	folders, err := t.storage.ListFolder(context.Background(), "ђорђе", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal("Café", folders[0].FolderName)
+	status, _ = post("/users/ђорђе/folders", "Paypal")
+	t.Equal(http.StatusCreated, status)
+	status, e := post("/users/ђорђе/folders", "P\u0430ypal")
+	t.Equal(http.StatusBadRequest, status)
+	t.Equal(APIError{Code: CodeInvalidArgument, Message: "the [P\u0430ypal] looks like [Paypal]"}, e)
+	status, e = post("/users/nobody/folders", "docs")
+	t.Equal(http.StatusNotFound, status)
+	t.Equal(CodeUserNotFound, e.Code)
+}
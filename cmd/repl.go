@@ -1,134 +1,468 @@
 package cmd
 
 import (
-	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"regexp"
+	"os/signal"
 	"strings"
+	"sync"
 	"time"
-	"unicode"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
+	"github.com/reddtsai/goREPL/pkg/lineedit"
+	"github.com/reddtsai/goREPL/pkg/policy"
 	"github.com/reddtsai/goREPL/pkg/storage"
 )
 
+const defaultRemoteTimeout = 30 * time.Second
+
 type Repl struct {
-	storage           storage.IStorage
-	rootCmd           *cobra.Command
-	folderSortName    string
-	folderSortCreated string
-	fileSortName      string
-	fileSortCreated   string
+	storage storage.IStorage
+	tx      *storage.Tx
+	rootCmd *cobra.Command
+	// mu guards opening the storage
+	mu      sync.Mutex
+	dataDir string
+	hostDir string
+	remote  string
+	timeout time.Duration
+	// script is the file of commands to run instead of the interactive loop
+	script          string
+	continueOnError bool
+	// history holds the commands of the interactive loop
+	history *lineedit.History
+	// adders replay the Add*Cmd calls to build the commands of a session
+	adders []func(*Repl)
+	// detached sessions aren't attached to the terminal, Ctrl-C doesn't
+	// cancel their commands
+	detached bool
+	// user and folder are the working context set by use and cd
+	user   string
+	folder string
+	// defs holds the aliases and the macros, depth how deep the running
+	// macros are
+	defs  *definitions
+	depth int
+	// config holds the settings, the defaults until configured
+	config *config
 }
 
 // New returns a new Repl
 func New() *Repl {
-	repl := &Repl{
-		storage: storage.NewVirtualFileSysStorage(),
-	}
+	repl := &Repl{}
 	repl.rootCmd = &cobra.Command{
 		Use:     "repl",
 		Version: "1.0.0",
 		Short:   "virtual file system (REPL)",
-		Run:     repl.RootCmdRunner,
+		RunE:    repl.RootCmdRunner,
+		// the config is read and the storage opened once the flags are
+		// parsed
+		PersistentPreRunE: repl.initStorage,
 	}
-
+	repl.rootCmd.PersistentFlags().StringVar(&repl.dataDir, "data-dir", "", "persist the file system in this directory")
+	repl.rootCmd.PersistentFlags().StringVar(&repl.hostDir, "host-dir", "", "keep the file system as real directories and files in this directory")
+	repl.rootCmd.PersistentFlags().StringVar(&repl.remote, "remote", "", "use the file system served by goREPL serve at this URL")
+	repl.rootCmd.PersistentFlags().DurationVar(&repl.timeout, "timeout", 0, "cancel a command running longer than this, 0 means no limit")
+	addSettingFlags(repl.rootCmd)
+	repl.rootCmd.Flags().StringVarP(&repl.script, "file", "f", "", "run the commands in this file instead, - reads them from stdin")
+	repl.rootCmd.Flags().BoolVar(&repl.continueOnError, "continue-on-error", false, "run the rest of the file after a command fails")
 	return repl
 }
 
+// newSession returns a Repl sharing the storage and the commands of r, with
+// its own command tree, flags, transaction, and copy of the aliases and the
+// macros. It reads commands from in and
+// writes to out and errOut.
+func (r *Repl) newSession(in io.Reader, out, errOut io.Writer) *Repl {
+	s := &Repl{
+		storage: r.storage,
+		timeout: r.timeout,
+		defs:    r.defs.copy(),
+		config:  r.config,
+	}
+	s.rootCmd = &cobra.Command{
+		Use:  r.rootCmd.Use,
+		RunE: s.RootCmdRunner,
+	}
+	s.rootCmd.SetIn(in)
+	s.rootCmd.SetOut(out)
+	s.rootCmd.SetErr(errOut)
+	for _, add := range r.adders {
+		add(s)
+	}
+	return s
+}
+
+// addCommand adds cmd, made by add, to the command tree. Its arguments are
+// checked once configured, as the settings tell how names are checked.
+func (r *Repl) addCommand(cmd *cobra.Command, add func(*Repl)) {
+	if validate := cmd.Args; validate != nil {
+		cmd.Args = func(cmd *cobra.Command, args []string) error {
+			err := r.configure()
+			if err != nil {
+				return err
+			}
+			return validate(cmd, args)
+		}
+	}
+	r.rootCmd.AddCommand(cmd)
+	r.adders = append(r.adders, add)
+}
+
+// initStorage reads the config and opens the storage before a command runs
+func (r *Repl) initStorage(cmd *cobra.Command, args []string) error {
+	// __complete parses the flags only once it runs,
+	// the completions open the storage then
+	if r.completing() {
+		return nil
+	}
+	err := r.configure()
+	if err != nil {
+		return err
+	}
+	return r.openStorage()
+}
+
+// openStorage opens the storage chosen by the flags, unless one is set
+func (r *Repl) openStorage() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.storage != nil {
+		return nil
+	}
+	var (
+		s   storage.IStorage
+		err error
+	)
+	set := 0
+	for _, v := range []string{r.dataDir, r.hostDir, r.remote} {
+		if v != "" {
+			set++
+		}
+	}
+	switch {
+	case set > 1:
+		err = fmt.Errorf("only one of --data-dir, --host-dir and --remote can be used")
+	case r.dataDir != "":
+		s, err = storage.NewFileSysStorage(r.dataDir)
+	case r.hostDir != "":
+		s, err = storage.NewHostDirStorage(r.hostDir)
+	case r.remote != "":
+		// a server gone silent mustn't hang the REPL without --timeout
+		timeout := r.timeout
+		if timeout <= 0 {
+			timeout = defaultRemoteTimeout
+		}
+		s, err = storage.NewRemoteStorage(r.remote, timeout)
+	default:
+		s = storage.NewVirtualFileSysStorage()
+	}
+	if err != nil {
+		return err
+	}
+	r.storage = s
+	return nil
+}
+
+// SetStorage makes r use s instead of the storage chosen by the flags
+func (r *Repl) SetStorage(s storage.IStorage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.storage = s
+}
+
 // Execute runs the REPL
 func (r *Repl) Execute() error {
-	return r.rootCmd.Execute()
+	return r.ExecuteContext(context.Background())
+}
+
+// ExecuteContext runs the REPL, commands are canceled once ctx is done
+func (r *Repl) ExecuteContext(ctx context.Context) error {
+	return r.rootCmd.ExecuteContext(ctx)
 }
 
-func (r *Repl) RootCmdRunner(cmd *cobra.Command, args []string) {
-	scanner := bufio.NewScanner(os.Stdin)
-	fmt.Println("======== Virtual File System 1.0.0 ========")
-	fmt.Println("Please Enter Your Command")
+// Run reads commands from in until exit or the end of in, writing their
+// output to out and the errors to errOut. Every Run is a session of its own,
+// with its own transaction, so several may share r at once. A session starts
+// with the aliases and the macros of r, its own changes to them aren't kept. Commands are
+// canceled once ctx is done, and Run returns before reading the next one.
+// Run reads no config file, the settings are the ones of SetSettings, or
+// the defaults.
+func (r *Repl) Run(ctx context.Context, in io.Reader, out, errOut io.Writer) error {
+	r.mu.Lock()
+	if r.config == nil {
+		r.config = newConfig()
+	}
+	r.mu.Unlock()
+	err := r.openStorage()
+	if err != nil {
+		return err
+	}
+	session := r.newSession(in, out, errOut)
+	session.detached = true
+	session.rootCmd.SetContext(ctx)
+	return session.loop(session.rootCmd)
+}
 
+// Close releases the storage, if it holds any resources
+func (r *Repl) Close() error {
+	if c, ok := r.storage.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (r *Repl) RootCmdRunner(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	if r.script != "" {
+		return r.runScript(cmd, r.script)
+	}
+	return r.loop(cmd)
+}
+
+// loop runs the commands read from the input of cmd until exit, the end of
+// the input or the context of cmd is done
+func (r *Repl) loop(cmd *cobra.Command) error {
+	ctx := cmd.Context()
+	in := cmd.InOrStdin()
+	out, errOut := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	terminal := lineedit.IsTerminal(in)
+	if r.history == nil {
+		r.history = r.openHistory(terminal, errOut)
+	}
+	editor := lineedit.New(in, out, r.history)
+	editor.SetCompleter(func(line string) []string {
+		return r.Complete(ctx, line)
+	})
+	fmt.Fprintln(out, "======== Virtual File System 1.0.0 ========")
+	fmt.Fprintln(out, "Please Enter Your Command")
+	if r.defs == nil {
+		r.openRC(cmd, terminal)
+	}
+
+	// pending holds the lines continued with a backslash so far
+	pending := ""
+	var readErr error
 	for {
-		fmt.Print("# ")
-		if !scanner.Scan() {
+		prompt := r.prompt()
+		if pending != "" {
+			prompt = "> "
+		}
+		text, err := editor.ReadLine(prompt)
+		if errors.Is(err, lineedit.ErrInterrupt) {
+			pending = ""
+			continue
+		}
+		if err != nil || ctx.Err() != nil {
+			if err != io.EOF {
+				readErr = err
+			}
 			break
 		}
-		line := scanner.Text()
+		// sent by telnet and the like
+		line := pending + strings.TrimSuffix(text, "\r")
+		if pending == "" && strings.HasPrefix(line, "!") {
+			expanded, err := r.expandHistory(line)
+			if err != nil {
+				fmt.Fprintln(errOut, "Error:", err)
+				continue
+			}
+			if expanded != line {
+				line = expanded
+				fmt.Fprintln(out, line)
+			}
+		}
+		args, err := r.SplitArgs(line)
+		if errors.Is(err, errLineContinued) {
+			pending = line + "\n"
+			continue
+		}
+		pending = ""
+		// kept as a single line, like shells do
+		_ = r.history.Add(strings.ReplaceAll(line, "\\\n", ""))
+
 		switch line {
 		case "exit":
-			fmt.Println("Goodbye!")
-			return
+			r.rollbackOpenTx(out)
+			fmt.Fprintln(out, "Goodbye!")
+			return nil
 		case "help":
 			r.HelpCmd()
-		default:
-			args := r.SplitArgs(line)
-			if len(args) > 0 {
-				foundCmd, _, err := cmd.Find(args)
-				if err != nil || foundCmd == r.rootCmd {
-					fmt.Fprintln(os.Stderr, "Error: unrecognized command.")
-					continue
-				}
-				err = foundCmd.ParseFlags(args)
-				if err != nil {
-					fmt.Println(foundCmd.UsageString())
-					continue
-				}
-
-				cmd.SetArgs(args)
-				_ = cmd.Execute()
-			}
+			continue
+		}
+		if err != nil {
+			fmt.Fprintln(errOut, "Error:", err)
+			continue
 		}
+		if len(args) == 0 {
+			continue
+		}
+		// the command prints its own errors
+		err = r.exec(ctx, cmd, args)
+		var (
+			usageErr *usageError
+			macroErr *macroError
+		)
+		switch {
+		case errors.Is(err, errUnrecognizedCmd):
+			fmt.Fprintln(errOut, "Error: unrecognized command.")
+		case errors.As(err, &usageErr):
+			fmt.Fprintln(out, usageErr.usage)
+		case errors.As(err, &macroErr):
+			fmt.Fprintln(errOut, "Error:", err)
+		}
+	}
+	r.rollbackOpenTx(out)
+	if err := ctx.Err(); err != nil {
+		return err
 	}
+	return readErr
 }
 
-func (r *Repl) HelpCmd() {
-	fmt.Println("Usage:")
-	fmt.Println("  register [username]")
-	fmt.Println("  create-folder [username] [foldername] [description]?")
-	fmt.Println("  delete-folder [username] [foldername]")
-	fmt.Println("  list-folders [username] [--sort-name|--sort-created] [asc|desc]")
-	fmt.Println("  rename-folder [username] [foldername] [new-foldername]")
-	fmt.Println("  create-file [username] [foldername] [filename] [description]?")
-	fmt.Println("  delete-file [username] [foldername] [filename]")
-	fmt.Println("  list-files [username] [foldername] [--sort-name|--sort-created] [asc|desc]")
-}
-
-func (r *Repl) SplitArgs(line string) []string {
-	var args []string
-	var currentArg string
-	var inQuote bool
-
-	for _, r := range line {
-		switch {
-		case unicode.IsSpace(r) && !inQuote:
-			if currentArg != "" {
-				args = append(args, currentArg)
-				currentArg = ""
-			}
-		case r == '\'' || r == '"':
-			inQuote = !inQuote
-		default:
-			currentArg += string(r)
-		}
+var errUnrecognizedCmd = errors.New("unrecognized command")
+
+// usageError is returned for flags a command doesn't know
+type usageError struct {
+	err   error
+	usage string
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+// exec runs the command line args with cmd, the root of the tree, canceled
+// once ctx is done. Aliases and macros are resolved before the commands. A
+// failed command rolls the open transaction back.
+func (r *Repl) exec(ctx context.Context, cmd *cobra.Command, args []string) error {
+	args = r.expandAlias(args)
+	if lines, ok := r.definitions().macro(args[0]); ok {
+		return r.runMacro(ctx, cmd, args[0], lines, args[1:])
+	}
+	foundCmd, _, err := cmd.Find(args)
+	if err != nil || foundCmd == r.rootCmd {
+		return errUnrecognizedCmd
+	}
+	resetFlags(foundCmd)
+	err = foundCmd.ParseFlags(args)
+	if err != nil {
+		return &usageError{err: err, usage: foundCmd.UsageString()}
+	}
+	if names := r.fillContext(foundCmd.Name(), len(foundCmd.Flags().Args())-1); names != nil {
+		args = append(append([]string{args[0]}, names...), args[1:]...)
+	}
+
+	cmdCtx, cancel := r.commandContext(ctx)
+	defer cancel()
+	// cobra only hands the context down to a subcommand
+	// that has none yet, so set it for every run
+	foundCmd.SetContext(cmdCtx)
+	cmd.SetArgs(args)
+	err = cmd.ExecuteContext(cmdCtx)
+	// not left with the context of a finished command
+	cmd.SetContext(ctx)
+	// a failed step fails the whole transaction
+	if err != nil && r.tx != nil && !errors.Is(err, errTxOpen) {
+		_ = r.tx.Rollback()
+		r.tx = nil
+		fmt.Fprintln(cmd.OutOrStdout(), "Warning: the transaction was rolled back")
+	}
+	return err
+}
+
+// rollbackOpenTx rolls back the transaction left open, if any
+func (r *Repl) rollbackOpenTx(out io.Writer) {
+	if r.tx == nil {
+		return
+	}
+	_ = r.tx.Rollback()
+	r.tx = nil
+	fmt.Fprintln(out, "Warning: the open transaction was rolled back")
+}
+
+// commandContext derives the context of a single command from ctx. It
+// carries a new trace ID, is canceled by Ctrl-C and times out after --timeout.
+func (r *Repl) commandContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = storage.WithTraceID(ctx, newTraceID())
+	stop := context.CancelFunc(func() {})
+	if !r.detached {
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt)
 	}
+	if r.timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+func newTraceID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
 
-	if currentArg != "" {
-		args = append(args, currentArg)
+// store returns the open transaction, if any, so commands are staged in it
+func (r *Repl) store() storage.IStorage {
+	if r.tx != nil {
+		return r.tx
 	}
+	return r.storage
+}
 
-	return args
+func (r *Repl) HelpCmd() {
+	out := r.rootCmd.OutOrStdout()
+	fmt.Fprintln(out, "Usage:")
+	fmt.Fprintln(out, "  register [username]")
+	fmt.Fprintln(out, "  create-folder [username] [foldername] [description]?")
+	fmt.Fprintln(out, "  delete-folder [username] [foldername]")
+	fmt.Fprintln(out, "  list-folders [username] [--sort-name|--sort-created] [asc|desc]")
+	fmt.Fprintln(out, "  rename-folder [username] [foldername] [new-foldername]")
+	fmt.Fprintln(out, "  create-file [username] [foldername] [filename] [description]?")
+	fmt.Fprintln(out, "  delete-file [username] [foldername] [filename]")
+	fmt.Fprintln(out, "  list-files [username] [foldername] [--sort-name|--sort-created] [asc|desc]")
+	fmt.Fprintln(out, "  begin")
+	fmt.Fprintln(out, "  commit")
+	fmt.Fprintln(out, "  rollback")
+	fmt.Fprintln(out, "  history")
+	fmt.Fprintln(out, "  use [username]")
+	fmt.Fprintln(out, "  cd [foldername|..]?")
+	fmt.Fprintln(out, "  pwd")
+	fmt.Fprintln(out, "  alias [name]? [command]?")
+	fmt.Fprintln(out, "  unalias [name]")
+	fmt.Fprintln(out, "  macro [name] [command-line]...?")
+	fmt.Fprintln(out, "  macros")
+	fmt.Fprintln(out, "  unmacro [name]")
+	fmt.Fprintln(out, "  config show")
 }
 
 func (r *Repl) AddRegisterCmd() {
 	cmd := &cobra.Command{
-		Use:   "register",
-		Short: "register a user",
-		Args:  r.RegisterValidation,
-		Run:   r.RegisterRunner,
+		Use:               "register",
+		Short:             "register a user",
+		Args:              r.RegisterValidation,
+		RunE:              r.RegisterRunner,
+		ValidArgsFunction: r.completeNames(0),
 	}
 	cmd.SetUsageTemplate("Usage:\n  register [username]")
 
-	r.rootCmd.AddCommand(cmd)
+	r.addCommand(cmd, (*Repl).AddRegisterCmd)
 }
 
 func (r *Repl) RegisterValidation(cmd *cobra.Command, args []string) error {
@@ -136,41 +470,35 @@ func (r *Repl) RegisterValidation(cmd *cobra.Command, args []string) error {
 	if len(args) != 1 {
 		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
 	}
-	// case insensitive
-	userName := strings.ToLower(args[0])
-	// input validation
-	l := len(userName)
-	if l < 3 || l > 20 {
-		return fmt.Errorf("the [%s] invalid length", userName)
-	}
-	re := regexp.MustCompile(`^[a-zA-Z0-9]+$`)
-	if !re.MatchString(userName) {
-		return fmt.Errorf("the [%s] contain invalid chars", userName)
-	}
-	exist := r.storage.IsExistUser(userName)
-	if exist {
-		return fmt.Errorf("the [%s] has already existed", userName)
-	}
-	return nil
+	userName := args[0]
+	return r.naming().checkUser(userName)
 }
 
-func (r *Repl) RegisterRunner(cmd *cobra.Command, args []string) {
-	// case insensitive
-	userName := strings.ToLower(args[0])
-	r.storage.AddUser(strings.ToLower(args[0]))
-	fmt.Printf("Add [%s] successfully\n", userName)
+func (r *Repl) RegisterRunner(cmd *cobra.Command, args []string) error {
+	n := r.naming()
+	userName := n.normalize(args[0])
+	ctx := storage.WithActor(cmd.Context(), userName)
+	err := n.addSibling(parentKey("", ""), userName, userNames(ctx, r.store()), func() error {
+		return r.store().AddUser(ctx, userName)
+	})
+	if err != nil {
+		return storageError(err, userName, "", "")
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Add [%s] successfully\n", userName)
+	return nil
 }
 
 func (r *Repl) AddCreateFolderCmd() {
 	cmd := &cobra.Command{
-		Use:   "create-folder",
-		Short: "create a folder for a user",
-		Args:  r.CreateFolderValidation,
-		Run:   r.CreateFolderRunner,
+		Use:               "create-folder",
+		Short:             "create a folder for a user",
+		Args:              r.CreateFolderValidation,
+		RunE:              r.CreateFolderRunner,
+		ValidArgsFunction: r.completeNames(1),
 	}
 	cmd.SetUsageTemplate("Usage:\n  create-folder [username] [foldername] [description]?")
 
-	r.rootCmd.AddCommand(cmd)
+	r.addCommand(cmd, (*Repl).AddCreateFolderCmd)
 }
 
 func (r *Repl) CreateFolderValidation(cmd *cobra.Command, args []string) error {
@@ -179,29 +507,6 @@ func (r *Repl) CreateFolderValidation(cmd *cobra.Command, args []string) error {
 
 	switch l {
 	case 2, 3:
-		// case insensitive
-		userName := strings.ToLower(args[0])
-		folderName := strings.ToLower(args[1])
-		// input validation
-		exist := r.storage.IsExistUser(userName)
-		if !exist {
-			return fmt.Errorf("the [%s] doesn't exist", userName)
-		}
-		fl := len(folderName)
-		if fl < 1 || fl > 100 {
-			return fmt.Errorf("the [%s] invalid length", folderName)
-		}
-		re := regexp.MustCompile(`^[a-zA-Z0-9\.\-\~\_\=\:]+$`)
-		if !re.MatchString(folderName) {
-			return fmt.Errorf("the [%s] contain invalid chars", folderName)
-		}
-		exist = r.storage.IsExistFolder(userName, folderName)
-		if exist {
-			return fmt.Errorf("the [%s] has already existed", folderName)
-		}
-		if l == 3 && len(args[2]) > 500 {
-			return fmt.Errorf("the [description] invalid length")
-		}
 	default:
 		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
 	}
@@ -209,29 +514,44 @@ func (r *Repl) CreateFolderValidation(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func (r *Repl) CreateFolderRunner(cmd *cobra.Command, args []string) {
-	// case insensitive
-	userName := strings.ToLower(args[0])
-	folderName := strings.ToLower(args[1])
+func (r *Repl) CreateFolderRunner(cmd *cobra.Command, args []string) error {
+	n := r.naming()
+	userName := args[0]
+	folderName := n.normalize(args[1])
 	desc := ""
 	if len(args) == 3 {
 		desc = args[2]
 	}
 
-	r.storage.AddFolder(userName, folderName, desc)
-	fmt.Printf("Create [%s] successfully\n", folderName)
+	ctx := storage.WithActor(cmd.Context(), userName)
+	err := r.lookupsFirst(n.checkName(folderName), r.userFound(ctx, userName))
+	if err == nil {
+		err = r.lookupsFirst(validateDesc(desc), r.userFound(ctx, userName), r.folderFree(ctx, userName, folderName))
+	}
+	if err != nil {
+		return err
+	}
+	err = n.addSibling(parentKey(userName, ""), folderName, folderNames(ctx, r.store(), userName, ""), func() error {
+		return r.store().AddFolder(ctx, userName, folderName, desc)
+	})
+	if err != nil {
+		return storageError(err, userName, folderName, "")
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Create [%s] successfully\n", folderName)
+	return nil
 }
 
 func (r *Repl) AddDeleteFolderCmd() {
 	cmd := &cobra.Command{
-		Use:   "delete-folder",
-		Short: "delete a folder for a user",
-		Args:  r.DeleteFolderValidation,
-		Run:   r.DeleteFolderRunner,
+		Use:               "delete-folder",
+		Short:             "delete a folder for a user",
+		Args:              r.DeleteFolderValidation,
+		RunE:              r.DeleteFolderRunner,
+		ValidArgsFunction: r.completeNames(2),
 	}
 	cmd.SetUsageTemplate("Usage:\n  delete-folder [username] [foldername]")
 
-	r.rootCmd.AddCommand(cmd)
+	r.addCommand(cmd, (*Repl).AddDeleteFolderCmd)
 }
 
 func (r *Repl) DeleteFolderValidation(cmd *cobra.Command, args []string) error {
@@ -240,44 +560,38 @@ func (r *Repl) DeleteFolderValidation(cmd *cobra.Command, args []string) error {
 	if l != 2 {
 		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
 	}
-	// case insensitive
-	userName := strings.ToLower(args[0])
-	folderName := strings.ToLower(args[1])
-	// input validation
-	exist := r.storage.IsExistUser(userName)
-	if !exist {
-		return fmt.Errorf("the [%s] doesn't exist", userName)
-	}
-	exist = r.storage.IsExistFolder(userName, folderName)
-	if !exist {
-		return fmt.Errorf("the [%s] doesn't exist", folderName)
-
-	}
 
 	return nil
 }
 
-func (r *Repl) DeleteFolderRunner(cmd *cobra.Command, args []string) {
-	// case insensitive
-	userName := strings.ToLower(args[0])
-	folderName := strings.ToLower(args[1])
+func (r *Repl) DeleteFolderRunner(cmd *cobra.Command, args []string) error {
+	userName := args[0]
+	folderName := args[1]
 
-	r.storage.DeleteFolder(userName, folderName)
-	fmt.Printf("Delete [%s] successfully\n", folderName)
+	ctx := storage.WithActor(cmd.Context(), userName)
+	err := r.store().DeleteFolder(ctx, userName, folderName)
+	if err != nil {
+		return storageError(err, userName, folderName, "")
+	}
+	if r.inUse(userName, folderName) {
+		r.folder = ""
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Delete [%s] successfully\n", folderName)
+	return nil
 }
 
 func (r *Repl) AddListFoldersCmd() {
 	cmd := &cobra.Command{
-		Use:   "list-folders",
-		Short: "list user folders",
-		Args:  r.ListFoldersValidation,
-		Run:   r.ListFoldersRunner,
+		Use:               "list-folders",
+		Short:             "list user folders",
+		Args:              r.ListFoldersValidation,
+		RunE:              r.ListFoldersRunner,
+		ValidArgsFunction: r.completeNames(1),
 	}
-	cmd.Flags().StringVar(&r.folderSortName, "sort-name", "", "Sort by name with asc or desc")
-	cmd.Flags().StringVar(&r.folderSortCreated, "sort-created", "", "Sort by created with asc or desc")
+	addListFlags(cmd)
 	cmd.SetUsageTemplate("Usage:\n  list-folders [username] [--sort-name|--sort-created] [asc|desc]")
 
-	r.rootCmd.AddCommand(cmd)
+	r.addCommand(cmd, (*Repl).AddListFoldersCmd)
 }
 
 func (r *Repl) ListFoldersValidation(cmd *cobra.Command, args []string) error {
@@ -287,64 +601,48 @@ func (r *Repl) ListFoldersValidation(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
 	}
 
-	// case insensitive
-	userName := strings.ToLower(args[0])
-	// input validation
-	exist := r.storage.IsExistUser(userName)
-	if !exist {
-		return fmt.Errorf("the [%s] doesn't exist", userName)
-	}
-
 	return nil
 }
 
-func (r *Repl) ListFoldersRunner(cmd *cobra.Command, args []string) {
-	defer func() {
-		r.folderSortName = ""
-		r.folderSortCreated = ""
-	}()
-
-	// case insensitive
-	userName := strings.ToLower(args[0])
-	sortName, orderBy := "", ""
-	if r.folderSortCreated != "" {
-		sortName = "create"
-		orderBy = r.folderSortCreated
-	} else if r.folderSortName != "" {
-		sortName = "name"
-		orderBy = r.folderSortName
-	} else {
-		// if neither sort-created nor sort-name
-		sortName = "name"
-		orderBy = "asc"
-	}
-	orderBy = strings.ToLower(orderBy)
-	switch orderBy {
-	case "asc", "desc":
-	default:
-		fmt.Println(cmd.UsageString())
-		return
+func (r *Repl) ListFoldersRunner(cmd *cobra.Command, args []string) error {
+	userName := args[0]
+	opts, ok := parseListOptions(cmd, r.listDefaults())
+	if !ok {
+		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
+	}
+	ctx := storage.WithActor(cmd.Context(), userName)
+	data, err := r.store().ListFolder(ctx, userName, opts.sortName, opts.orderBy)
+	if err != nil {
+		return storageError(err, userName, "", "")
+	}
+	if r.setting("output") == "json" {
+		items := make([]listItem, 0, len(data))
+		for _, v := range data {
+			items = append(items, listItem{Name: v.FolderName, Description: v.FolderDesc, Created: r.formatTime(v.FolderCreateTime), UserName: v.UserName})
+		}
+		return writeList(cmd.OutOrStdout(), items)
 	}
-	data := r.storage.ListFolder(userName, sortName, orderBy)
 	for _, v := range data {
-		tt := time.Unix(v.FolderCreateTime, 0).Format("2006-01-02 15:04:05")
-		fmt.Printf("%s %s %s %s\n", v.FolderName, v.FolderDesc, tt, v.UserName)
+		tt := r.formatTime(v.FolderCreateTime)
+		fmt.Fprintf(cmd.OutOrStdout(), "%s %s %s %s\n", v.FolderName, v.FolderDesc, tt, v.UserName)
 	}
 	if len(data) == 0 {
-		fmt.Printf("Warning: the [%s] doesn't have any folders\n", userName)
+		fmt.Fprintf(cmd.OutOrStdout(), "Warning: the [%s] doesn't have any folders\n", userName)
 	}
+	return nil
 }
 
 func (r *Repl) AddRenameFolderCmd() {
 	cmd := &cobra.Command{
-		Use:   "rename-folder",
-		Short: "rename a folder for a user",
-		Args:  r.RenameFolderValidation,
-		Run:   r.RenameFolderRunner,
+		Use:               "rename-folder",
+		Short:             "rename a folder for a user",
+		Args:              r.RenameFolderValidation,
+		RunE:              r.RenameFolderRunner,
+		ValidArgsFunction: r.completeNames(2),
 	}
 	cmd.SetUsageTemplate("Usage:\n  rename-folder [username] [foldername] [new-foldername]")
 
-	r.rootCmd.AddCommand(cmd)
+	r.addCommand(cmd, (*Repl).AddRenameFolderCmd)
 }
 
 func (r *Repl) RenameFolderValidation(cmd *cobra.Command, args []string) error {
@@ -354,54 +652,49 @@ func (r *Repl) RenameFolderValidation(cmd *cobra.Command, args []string) error {
 	if l != 3 {
 		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
 	}
-	// case insensitive
-	userName := strings.ToLower(args[0])
-	folderName := strings.ToLower(args[1])
-	newFolderName := strings.ToLower(args[2])
-	// input validation
-	exist := r.storage.IsExistUser(userName)
-	if !exist {
-		return fmt.Errorf("the [%s] doesn't exist", userName)
-	}
-	exist = r.storage.IsExistFolder(userName, folderName)
-	if !exist {
-		return fmt.Errorf("the [%s] doesn't exist", folderName)
+
+	return nil
+}
+
+func (r *Repl) RenameFolderRunner(cmd *cobra.Command, args []string) error {
+	n := r.naming()
+	userName := args[0]
+	folderName := args[1]
+	newFolderName := n.normalize(args[2])
+	ctx := storage.WithActor(cmd.Context(), userName)
+	err := r.lookupsFirst(n.checkName(newFolderName),
+		r.userFound(ctx, userName), r.folderFound(ctx, userName, folderName), r.folderFree(ctx, userName, newFolderName))
+	if err != nil {
+		return err
 	}
-	exist = r.storage.IsExistFolder(userName, newFolderName)
-	if exist {
+	err = n.addSibling(parentKey(userName, ""), newFolderName, folderNames(ctx, r.store(), userName, folderName), func() error {
+		return r.store().RenameFolder(ctx, userName, folderName, newFolderName)
+	})
+	if errors.Is(err, storage.ErrFolderExists) {
 		return fmt.Errorf("the [%s] has already existed", newFolderName)
 	}
-	fl := len(newFolderName)
-	if fl < 1 || fl > 100 {
-		return fmt.Errorf("the [%s] invalid length", newFolderName)
+	if err != nil {
+		return storageError(err, userName, folderName, "")
 	}
-	re := regexp.MustCompile(`^[a-zA-Z0-9\.\-\~\_\=\:]+$`)
-	if !re.MatchString(newFolderName) {
-		return fmt.Errorf("the [%s] contain invalid chars", newFolderName)
+	// the working context follows the folder
+	if r.inUse(userName, folderName) {
+		r.folder = newFolderName
 	}
-
+	fmt.Fprintf(cmd.OutOrStdout(), "Rename [%s] to [%s] successfully\n", folderName, newFolderName)
 	return nil
 }
 
-func (r *Repl) RenameFolderRunner(cmd *cobra.Command, args []string) {
-	// case insensitive
-	userName := strings.ToLower(args[0])
-	folderName := strings.ToLower(args[1])
-	newFolderName := strings.ToLower(args[2])
-	r.storage.RenameFolder(userName, folderName, newFolderName)
-	fmt.Printf("Rename [%s] to [%s] successfully\n", folderName, newFolderName)
-}
-
 func (r *Repl) AddCreateFileCmd() {
 	cmd := &cobra.Command{
-		Use:   "create-file",
-		Short: "create a file for a user",
-		Args:  r.CreateFileValidation,
-		Run:   r.CreateFileRunner,
+		Use:               "create-file",
+		Short:             "create a file for a user",
+		Args:              r.CreateFileValidation,
+		RunE:              r.CreateFileRunner,
+		ValidArgsFunction: r.completeNames(2),
 	}
 	cmd.SetUsageTemplate("Usage:\n  create-file [username] [foldername] [filename] [description]?")
 
-	r.rootCmd.AddCommand(cmd)
+	r.addCommand(cmd, (*Repl).AddCreateFileCmd)
 }
 
 func (r *Repl) CreateFileValidation(cmd *cobra.Command, args []string) error {
@@ -410,34 +703,6 @@ func (r *Repl) CreateFileValidation(cmd *cobra.Command, args []string) error {
 
 	switch l {
 	case 3, 4:
-		// case insensitive
-		userName := strings.ToLower(args[0])
-		folderName := strings.ToLower(args[1])
-		fileName := strings.ToLower(args[2])
-		// input validation
-		exist := r.storage.IsExistUser(userName)
-		if !exist {
-			return fmt.Errorf("the [%s] doesn't exist", userName)
-		}
-		exist = r.storage.IsExistFolder(userName, folderName)
-		if !exist {
-			return fmt.Errorf("the [%s] doesn't exist", folderName)
-		}
-		fl := len(fileName)
-		if fl < 1 || fl > 100 {
-			return fmt.Errorf("the [%s] invalid length", fileName)
-		}
-		re := regexp.MustCompile(`^[a-zA-Z0-9\.\-\~\_\=\:]+$`)
-		if !re.MatchString(fileName) {
-			return fmt.Errorf("the [%s] contain invalid chars", fileName)
-		}
-		exist = r.storage.IsExistFile(userName, folderName, fileName)
-		if exist {
-			return fmt.Errorf("the [%s] has already existed", fileName)
-		}
-		if l == 4 && len(args[3]) > 500 {
-			return fmt.Errorf("the [description] invalid length")
-		}
 	default:
 		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
 	}
@@ -445,30 +710,46 @@ func (r *Repl) CreateFileValidation(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func (r *Repl) CreateFileRunner(cmd *cobra.Command, args []string) {
-	// case insensitive
-	userName := strings.ToLower(args[0])
-	folderName := strings.ToLower(args[1])
-	fileName := strings.ToLower(args[2])
+func (r *Repl) CreateFileRunner(cmd *cobra.Command, args []string) error {
+	n := r.naming()
+	userName := args[0]
+	folderName := args[1]
+	fileName := n.normalize(args[2])
 	desc := ""
 	if len(args) == 4 {
 		desc = args[3]
 	}
 
-	r.storage.AddFile(userName, folderName, fileName, desc)
-	fmt.Printf("Create [%s] in [%s]/[%s] successfully\n", fileName, userName, folderName)
+	ctx := storage.WithActor(cmd.Context(), userName)
+	err := r.lookupsFirst(n.checkName(fileName), r.userFound(ctx, userName), r.folderFound(ctx, userName, folderName))
+	if err == nil {
+		err = r.lookupsFirst(validateDesc(desc),
+			r.userFound(ctx, userName), r.folderFound(ctx, userName, folderName), r.fileFree(ctx, userName, folderName, fileName))
+	}
+	if err != nil {
+		return err
+	}
+	err = n.addSibling(parentKey(userName, folderName), fileName, fileNames(ctx, r.store(), userName, folderName), func() error {
+		return r.store().AddFile(ctx, userName, folderName, fileName, desc)
+	})
+	if err != nil {
+		return storageError(err, userName, folderName, fileName)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Create [%s] in [%s]/[%s] successfully\n", fileName, userName, folderName)
+	return nil
 }
 
 func (r *Repl) AddDeleteFileCmd() {
 	cmd := &cobra.Command{
-		Use:   "delete-file",
-		Short: "delete a file for a user",
-		Args:  r.DeleteFileValidation,
-		Run:   r.DeleteFileRunner,
+		Use:               "delete-file",
+		Short:             "delete a file for a user",
+		Args:              r.DeleteFileValidation,
+		RunE:              r.DeleteFileRunner,
+		ValidArgsFunction: r.completeNames(3),
 	}
 	cmd.SetUsageTemplate("Usage:\n  delete-file [username] [foldername] [filename]")
 
-	r.rootCmd.AddCommand(cmd)
+	r.addCommand(cmd, (*Repl).AddDeleteFileCmd)
 }
 
 func (r *Repl) DeleteFileValidation(cmd *cobra.Command, args []string) error {
@@ -477,50 +758,36 @@ func (r *Repl) DeleteFileValidation(cmd *cobra.Command, args []string) error {
 	if l != 3 {
 		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
 	}
-	// case insensitive
-	userName := strings.ToLower(args[0])
-	folderName := strings.ToLower(args[1])
-	fileName := strings.ToLower(args[2])
-	// input validation
-	exist := r.storage.IsExistUser(userName)
-	if !exist {
-		return fmt.Errorf("the [%s] doesn't exist", userName)
-	}
-	exist = r.storage.IsExistFolder(userName, folderName)
-	if !exist {
-		return fmt.Errorf("the [%s] doesn't exist", folderName)
-
-	}
-	exist = r.storage.IsExistFile(userName, folderName, fileName)
-	if !exist {
-		return fmt.Errorf("the [%s] doesn't exist", fileName)
-	}
 
 	return nil
 }
 
-func (r *Repl) DeleteFileRunner(cmd *cobra.Command, args []string) {
-	// case insensitive
-	userName := strings.ToLower(args[0])
-	folderName := strings.ToLower(args[1])
-	fileName := strings.ToLower(args[2])
+func (r *Repl) DeleteFileRunner(cmd *cobra.Command, args []string) error {
+	userName := args[0]
+	folderName := args[1]
+	fileName := args[2]
 
-	r.storage.DeleteFile(userName, folderName, fileName)
-	fmt.Printf("Delete [%s] in [%s]/[%s] successfully\n", fileName, userName, folderName)
+	ctx := storage.WithActor(cmd.Context(), userName)
+	err := r.store().DeleteFile(ctx, userName, folderName, fileName)
+	if err != nil {
+		return storageError(err, userName, folderName, fileName)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Delete [%s] in [%s]/[%s] successfully\n", fileName, userName, folderName)
+	return nil
 }
 
 func (r *Repl) AddListFilesCmd() {
 	cmd := &cobra.Command{
-		Use:   "list-files",
-		Short: "list user files",
-		Args:  r.ListFilesValidation,
-		Run:   r.ListFilesRunner,
+		Use:               "list-files",
+		Short:             "list user files",
+		Args:              r.ListFilesValidation,
+		RunE:              r.ListFilesRunner,
+		ValidArgsFunction: r.completeNames(2),
 	}
-	cmd.Flags().StringVar(&r.fileSortName, "sort-name", "", "Sort by name with asc or desc")
-	cmd.Flags().StringVar(&r.fileSortCreated, "sort-created", "", "Sort by created with asc or desc")
+	addListFlags(cmd)
 	cmd.SetUsageTemplate("Usage:\n  list-files [username] [foldername] [--sort-name|--sort-created] [asc|desc]")
 
-	r.rootCmd.AddCommand(cmd)
+	r.addCommand(cmd, (*Repl).AddListFilesCmd)
 }
 
 func (r *Repl) ListFilesValidation(cmd *cobra.Command, args []string) error {
@@ -530,57 +797,322 @@ func (r *Repl) ListFilesValidation(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
 	}
 
-	// case insensitive
-	userName := strings.ToLower(args[0])
-	folderName := strings.ToLower(args[1])
-	// input validation
-	exist := r.storage.IsExistUser(userName)
-	if !exist {
-		return fmt.Errorf("the [%s] doesn't exist", userName)
+	return nil
+}
+
+func (r *Repl) ListFilesRunner(cmd *cobra.Command, args []string) error {
+	userName := args[0]
+	folderName := args[1]
+	opts, ok := parseListOptions(cmd, r.listDefaults())
+	if !ok {
+		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
 	}
-	exist = r.storage.IsExistFolder(userName, folderName)
-	if !exist {
-		return fmt.Errorf("the [%s] doesn't exist", folderName)
+	ctx := storage.WithActor(cmd.Context(), userName)
+	data, err := r.store().ListFile(ctx, userName, folderName, opts.sortName, opts.orderBy)
+	if err != nil {
+		return storageError(err, userName, folderName, "")
+	}
+	if r.setting("output") == "json" {
+		items := make([]listItem, 0, len(data))
+		for _, v := range data {
+			items = append(items, listItem{Name: v.FileName, Description: v.FileDesc, Created: r.formatTime(v.FileCreateTime), FolderName: folderName, UserName: userName})
+		}
+		return writeList(cmd.OutOrStdout(), items)
+	}
+	for _, v := range data {
+		tt := r.formatTime(v.FileCreateTime)
+		fmt.Fprintf(cmd.OutOrStdout(), "%s %s %s %s %s\n", v.FileName, v.FileDesc, tt, folderName, userName)
+	}
+	if len(data) == 0 {
+		fmt.Fprintf(cmd.OutOrStdout(), "Warning: the [%s] is empty\n", folderName)
+	}
+	return nil
+}
+
+// listOptions are the flags of a single list-folders or list-files run
+type listOptions struct {
+	sortName string
+	orderBy  string
+}
+
+func addListFlags(cmd *cobra.Command) {
+	cmd.Flags().String("sort-name", "", "Sort by name with asc or desc")
+	cmd.Flags().String("sort-created", "", "Sort by created with asc or desc")
+	_ = cmd.RegisterFlagCompletionFunc("sort-name", completeOrder)
+	_ = cmd.RegisterFlagCompletionFunc("sort-created", completeOrder)
+}
+
+// listItem is a folder or a file listed as json
+type listItem struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Created     string `json:"created"`
+	FolderName  string `json:"folderName,omitempty"`
+	UserName    string `json:"userName"`
+}
+
+func writeList(out io.Writer, items []listItem) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(items)
+}
 
+// listDefaults returns the order of the lists given no flags, set by the sort
+// and order settings
+func (r *Repl) listDefaults() listOptions {
+	opts := listOptions{sortName: "name", orderBy: r.setting("order")}
+	if r.setting("sort") == "created" {
+		opts.sortName = "create"
+	}
+	return opts
+}
+
+// parseListOptions reads the flags of cmd, sorting as def without them. It
+// reports false for an unknown order.
+func parseListOptions(cmd *cobra.Command, def listOptions) (listOptions, bool) {
+	sortName, _ := cmd.Flags().GetString("sort-name")
+	sortCreated, _ := cmd.Flags().GetString("sort-created")
+	opts := def
+	if sortCreated != "" {
+		opts = listOptions{sortName: "create", orderBy: sortCreated}
+	} else if sortName != "" {
+		opts = listOptions{sortName: "name", orderBy: sortName}
+	}
+	opts.orderBy = strings.ToLower(opts.orderBy)
+	switch opts.orderBy {
+	case "asc", "desc":
+		return opts, true
+	}
+	return opts, false
+}
+
+// resetFlags sets the local flags of cmd back to their defaults. cobra only
+// sets the flags given, so the values of the last run would be seen again.
+func resetFlags(cmd *cobra.Command) {
+	cmd.LocalNonPersistentFlags().VisitAll(func(f *pflag.Flag) {
+		_ = f.Value.Set(f.DefValue)
+		f.Changed = false
+	})
+}
+
+var (
+	errTxOpen   = errors.New("a transaction is already open")
+	errTxClosed = errors.New("no transaction is open")
+)
+
+func (r *Repl) AddBeginCmd() {
+	cmd := &cobra.Command{
+		Use:   "begin",
+		Short: "begin a transaction",
+		Long: "Begin a transaction, the following commands are staged in it until commit or rollback.\n" +
+			"Only the memory storage and --data-dir support transactions, --host-dir and --remote don't.",
+		Args: r.TxValidation,
+		RunE: r.BeginRunner,
+	}
+	cmd.SetUsageTemplate("Usage:\n  begin")
+
+	r.addCommand(cmd, (*Repl).AddBeginCmd)
+}
+
+func (r *Repl) AddCommitCmd() {
+	cmd := &cobra.Command{
+		Use:   "commit",
+		Short: "commit the open transaction",
+		Args:  r.TxValidation,
+		RunE:  r.CommitRunner,
+	}
+	cmd.SetUsageTemplate("Usage:\n  commit")
+
+	r.addCommand(cmd, (*Repl).AddCommitCmd)
+}
+
+func (r *Repl) AddRollbackCmd() {
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "roll back the open transaction",
+		Args:  r.TxValidation,
+		RunE:  r.RollbackRunner,
+	}
+	cmd.SetUsageTemplate("Usage:\n  rollback")
+
+	r.addCommand(cmd, (*Repl).AddRollbackCmd)
+}
+
+func (r *Repl) TxValidation(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	if len(args) != 0 {
+		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
 	}
 
 	return nil
 }
 
-func (r *Repl) ListFilesRunner(cmd *cobra.Command, args []string) {
-	defer func() {
-		r.fileSortName = ""
-		r.fileSortCreated = ""
-	}()
-
-	// case insensitive
-	userName := strings.ToLower(args[0])
-	folderName := strings.ToLower(args[1])
-	sortName, orderBy := "", ""
-	if r.fileSortCreated != "" {
-		sortName = "create"
-		orderBy = r.fileSortCreated
-	} else if r.fileSortName != "" {
-		sortName = "name"
-		orderBy = r.fileSortName
-	} else {
-		// if neither sort-created nor sort-name
-		sortName = "name"
-		orderBy = "asc"
-	}
-	orderBy = strings.ToLower(orderBy)
-	switch orderBy {
-	case "asc", "desc":
-	default:
-		fmt.Println(cmd.UsageString())
-		return
+func (r *Repl) BeginRunner(cmd *cobra.Command, args []string) error {
+	if r.tx != nil {
+		return errTxOpen
 	}
-	data := r.storage.ListFile(userName, folderName, sortName, orderBy)
-	for _, v := range data {
-		tt := time.Unix(v.FileCreateTime, 0).Format("2006-01-02 15:04:05")
-		fmt.Printf("%s %s %s %s %s\n", v.FileName, v.FileDesc, tt, folderName, userName)
+	tx, err := storage.Begin(cmd.Context(), r.storage)
+	if err != nil {
+		return storageError(err, "", "", "")
 	}
-	if len(data) == 0 {
-		fmt.Printf("Warning: the [%s] is empty\n", folderName)
+	r.tx = tx
+	fmt.Fprintln(cmd.OutOrStdout(), "Begin a transaction")
+	return nil
+}
+
+func (r *Repl) CommitRunner(cmd *cobra.Command, args []string) error {
+	if r.tx == nil {
+		return errTxClosed
+	}
+	tx := r.tx
+	// the transaction is done even if the commit fails
+	r.tx = nil
+	n := tx.Len()
+	err := tx.Commit(cmd.Context())
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		err = storageError(err, "", "", "")
+	}
+	if err != nil {
+		// another session changed what the transaction relied on
+		return fmt.Errorf("the transaction was rolled back: %w", err)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Commit %d changes successfully\n", n)
+	return nil
+}
+
+func (r *Repl) RollbackRunner(cmd *cobra.Command, args []string) error {
+	if r.tx == nil {
+		return errTxClosed
+	}
+	_ = r.tx.Rollback()
+	r.tx = nil
+	fmt.Fprintln(cmd.OutOrStdout(), "Rollback successfully")
+	return nil
+}
+
+var (
+	userNamePolicy = policy.New(
+		policy.Length(3, 20, policy.Bytes),
+		policy.Charset("a-zA-Z0-9", ""),
+	)
+	// namePolicy is the one of folders and files
+	namePolicy = policy.New(
+		policy.Length(1, 100, policy.Bytes),
+		policy.Charset("a-zA-Z0-9", ".-~_=:"),
+	)
+	descPolicy = policy.New(
+		policy.Length(0, 500, policy.Bytes),
+	).Labeled("description")
+)
+
+// lookupsFirst returns err, an invalid argument, unless one of lookups
+// fails first, so a missing user or folder, or a name already taken, is
+// reported before the argument as it always was. The lookups only run for
+// an invalid argument, a valid one is checked by the storage, under its
+// lock.
+func (r *Repl) lookupsFirst(err error, lookups ...func() error) error {
+	if err == nil {
+		return nil
+	}
+	for _, lookup := range lookups {
+		if lerr := lookup(); lerr != nil {
+			return lerr
+		}
+	}
+	return err
+}
+
+// lookupError returns the error of a lookup that failed with err, the one
+// of ctx if it's done, as the lookups can't tell it apart from a miss
+func lookupError(ctx context.Context, err error, userName, folderName, fileName string) error {
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return storageError(err, userName, folderName, fileName)
+}
+
+// userFound looks the user up
+func (r *Repl) userFound(ctx context.Context, userName string) func() error {
+	return func() error {
+		if !r.store().IsExistUser(ctx, userName) {
+			return lookupError(ctx, storage.ErrUserNotFound, userName, "", "")
+		}
+		return nil
+	}
+}
+
+// folderFound looks the folder of the user up
+func (r *Repl) folderFound(ctx context.Context, userName, folderName string) func() error {
+	return func() error {
+		if !r.store().IsExistFolder(ctx, userName, folderName) {
+			return lookupError(ctx, storage.ErrFolderNotFound, userName, folderName, "")
+		}
+		return nil
+	}
+}
+
+// folderFree makes sure the user has no folder named folderName
+func (r *Repl) folderFree(ctx context.Context, userName, folderName string) func() error {
+	return func() error {
+		if r.store().IsExistFolder(ctx, userName, folderName) {
+			return storageError(storage.ErrFolderExists, userName, folderName, "")
+		}
+		if err := ctx.Err(); err != nil {
+			return storageError(err, userName, folderName, "")
+		}
+		return nil
+	}
+}
+
+// fileFree makes sure the folder has no file named fileName
+func (r *Repl) fileFree(ctx context.Context, userName, folderName, fileName string) func() error {
+	return func() error {
+		if r.store().IsExistFile(ctx, userName, folderName, fileName) {
+			return storageError(storage.ErrFileExists, userName, folderName, fileName)
+		}
+		if err := ctx.Err(); err != nil {
+			return storageError(err, userName, folderName, fileName)
+		}
+		return nil
+	}
+}
+
+func validateDesc(desc string) error {
+	return descPolicy.Check(desc)
+}
+
+// storageError maps an error of the storage to the message shown to the user
+func storageError(err error, userName, folderName, fileName string) error {
+	switch {
+	case errors.Is(err, storage.ErrUserNotFound):
+		return fmt.Errorf("the [%s] doesn't exist", userName)
+	case errors.Is(err, storage.ErrUserExists):
+		return fmt.Errorf("the [%s] has already existed", userName)
+	case errors.Is(err, storage.ErrFolderNotFound):
+		return fmt.Errorf("the [%s] doesn't exist", folderName)
+	case errors.Is(err, storage.ErrFolderExists):
+		return fmt.Errorf("the [%s] has already existed", folderName)
+	case errors.Is(err, storage.ErrFileNotFound):
+		return fmt.Errorf("the [%s] doesn't exist", fileName)
+	case errors.Is(err, storage.ErrFileExists):
+		return fmt.Errorf("the [%s] has already existed", fileName)
+	case errors.Is(err, storage.ErrInvalidName):
+		// the name the storage reports, else the last one given
+		name := userName
+		for _, n := range []string{folderName, fileName} {
+			if n != "" {
+				name = n
+			}
+		}
+		var nameErr *storage.InvalidNameError
+		if errors.As(err, &nameErr) {
+			name = nameErr.Name
+		}
+		return fmt.Errorf("the [%s] contain invalid chars", name)
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("the command was canceled")
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("the command timed out")
 	}
+	return err
 }
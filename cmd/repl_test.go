@@ -2,11 +2,12 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/spf13/cobra"
@@ -38,7 +39,7 @@ func (t *TestRepl) SetupSuite() {
 	rootCmd := &cobra.Command{
 		Use:     "repl",
 		Version: "test",
-		Run:     t.repl.RootCmdRunner,
+		RunE:    t.repl.RootCmdRunner,
 	}
 	t.repl.rootCmd = rootCmd
 	t.repl.AddRegisterCmd()
@@ -49,6 +50,13 @@ func (t *TestRepl) SetupSuite() {
 	t.repl.AddCreateFileCmd()
 	t.repl.AddDeleteFileCmd()
 	t.repl.AddListFilesCmd()
+	t.repl.AddBeginCmd()
+	t.repl.AddCommitCmd()
+	t.repl.AddRollbackCmd()
+	t.repl.rootCmd.SetArgs([]string{})
+	t.repl.rootCmd.SetIn(strings.NewReader(""))
+	t.repl.rootCmd.SetOut(io.Discard)
+	t.repl.rootCmd.SetErr(io.Discard)
 	t.repl.Execute()
 }
 
@@ -57,25 +65,25 @@ func (t *TestRepl) TearDownSuite() {
 }
 
 func (t *TestRepl) Execute(args []string) (string, error) {
-	sout := os.Stdout
-	r, w, _ := os.Pipe()
-	os.Stdout = w
+	var out bytes.Buffer
+	t.repl.rootCmd.SetOut(&out)
+	t.repl.rootCmd.SetErr(io.Discard)
+	// like the interactive loop, a run doesn't see the flags or the
+	// context of the last one
+	if cmd, _, err := t.repl.rootCmd.Find(args); err == nil {
+		resetFlags(cmd)
+		cmd.SetContext(context.Background())
+	}
 	t.repl.rootCmd.SetArgs(args)
 	err := t.repl.rootCmd.Execute()
-	w.Close()
-	os.Stdout = sout
-	var buf bytes.Buffer
-	io.Copy(&buf, r)
-	r.Close()
 
-	return buf.String(), err
+	return out.String(), err
 }
 
 func (t *TestRepl) TestRegisterCmdSuccess() {
 	userName := "test"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(false)
-	t.mockStorage.EXPECT().AddUser(userName)
+	t.mockStorage.EXPECT().AddUser(gomock.Any(), userName).Return(nil)
 	// execute
 	out, err := t.Execute([]string{"register", userName})
 	// testing
@@ -97,7 +105,7 @@ func (t *TestRepl) TestRegisterCmdUnrecognizedArgs() {
 func (t *TestRepl) TestRegisterCmdUserNameExist() {
 	userName := "test"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
+	t.mockStorage.EXPECT().AddUser(gomock.Any(), userName).Return(storage.ErrUserExists)
 	// execute
 	_, err := t.Execute([]string{"register", userName})
 	// testing
@@ -131,9 +139,7 @@ func (t *TestRepl) TestCreateFolderCmdSuccess() {
 	folderName := "folder"
 	folderDesc := "desc"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(false)
-	t.mockStorage.EXPECT().AddFolder(userName, folderName, folderDesc)
+	t.mockStorage.EXPECT().AddFolder(gomock.Any(), userName, folderName, folderDesc).Return(nil)
 	// execute
 	out, err := t.Execute([]string{"create-folder", userName, folderName, folderDesc})
 	// testing
@@ -157,7 +163,7 @@ func (t *TestRepl) TestCreateFolderCmdUserNameNotExist() {
 	folderName := "folder"
 	folderDesc := "desc"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(false)
+	t.mockStorage.EXPECT().AddFolder(gomock.Any(), userName, folderName, folderDesc).Return(storage.ErrUserNotFound)
 	// execute
 	_, err := t.Execute([]string{"create-folder", userName, folderName, folderDesc})
 	// testing
@@ -171,7 +177,7 @@ func (t *TestRepl) TestCreateFolderCmdFolderNameInvalidLength() {
 	folderName := "f12345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890"
 	folderDesc := "desc"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
+	t.mockStorage.EXPECT().IsExistUser(gomock.Any(), userName).Return(true)
 	// execute
 	_, err := t.Execute([]string{"create-folder", userName, folderName, folderDesc})
 	// testing
@@ -185,7 +191,7 @@ func (t *TestRepl) TestCreateFolderCmdFolderNameInvalidChar() {
 	folderName := "folder@123"
 	folderDesc := "desc"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
+	t.mockStorage.EXPECT().IsExistUser(gomock.Any(), userName).Return(true)
 	// execute
 	_, err := t.Execute([]string{"create-folder", userName, folderName, folderDesc})
 	// testing
@@ -199,8 +205,7 @@ func (t *TestRepl) TestCreateFolderCmdFolderNameExist() {
 	folderName := "folder"
 	folderDesc := "desc"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(true)
+	t.mockStorage.EXPECT().AddFolder(gomock.Any(), userName, folderName, folderDesc).Return(storage.ErrFolderExists)
 	// execute
 	_, err := t.Execute([]string{"create-folder", userName, folderName, folderDesc})
 	// testing
@@ -214,8 +219,8 @@ func (t *TestRepl) TestCreateFolderCmdFolderDescInvalidLength() {
 	folderName := "folder"
 	folderDesc := "desc1234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(false)
+	t.mockStorage.EXPECT().IsExistUser(gomock.Any(), userName).Return(true)
+	t.mockStorage.EXPECT().IsExistFolder(gomock.Any(), userName, folderName).Return(false)
 	// execute
 	_, err := t.Execute([]string{"create-folder", userName, folderName, folderDesc})
 	// testing
@@ -227,9 +232,7 @@ func (t *TestRepl) TestDeleteFolderCmdSuccess() {
 	userName := "test"
 	folderName := "folder"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(true)
-	t.mockStorage.EXPECT().DeleteFolder(userName, folderName)
+	t.mockStorage.EXPECT().DeleteFolder(gomock.Any(), userName, folderName).Return(nil)
 	// execute
 	out, err := t.Execute([]string{"delete-folder", userName, folderName})
 	// testing
@@ -252,7 +255,7 @@ func (t *TestRepl) TestDeleteFolderCmdUserNameNotExist() {
 	userName := "test"
 	folderName := "folder"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(false)
+	t.mockStorage.EXPECT().DeleteFolder(gomock.Any(), userName, folderName).Return(storage.ErrUserNotFound)
 	// execute
 	_, err := t.Execute([]string{"delete-folder", userName, folderName})
 	// testing
@@ -265,8 +268,7 @@ func (t *TestRepl) TestDeleteFolderCmdFolderNameNotExist() {
 	userName := "test"
 	folderName := "folder"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(false)
+	t.mockStorage.EXPECT().DeleteFolder(gomock.Any(), userName, folderName).Return(storage.ErrFolderNotFound)
 	// execute
 	_, err := t.Execute([]string{"delete-folder", userName, folderName})
 	// testing
@@ -283,8 +285,7 @@ func (t *TestRepl) TestListFoldersCmdSuccess() {
 		{UserName: "test", FolderName: "folder3", FolderCreateTime: 1719797050, FolderDesc: "desc3"},
 	}
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().ListFolder(userName, "name", "asc").Return(folders)
+	t.mockStorage.EXPECT().ListFolder(gomock.Any(), userName, "name", "asc").Return(folders, nil)
 	// execute
 	out, err := t.Execute([]string{"list-folders", userName})
 	// testing
@@ -302,8 +303,7 @@ func (t *TestRepl) TestListFoldersCmdByNameSuccess() {
 		{UserName: "test", FolderName: "folder1", FolderCreateTime: 1719797050, FolderDesc: "desc1"},
 	}
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().ListFolder(userName, "name", "desc").Return(folders)
+	t.mockStorage.EXPECT().ListFolder(gomock.Any(), userName, "name", "desc").Return(folders, nil)
 	// execute
 	out, err := t.Execute([]string{"list-folders", userName, "--sort-name", "desc"})
 	// testing
@@ -321,8 +321,7 @@ func (t *TestRepl) TestListFoldersCmdByCreateSuccess() {
 		{UserName: "test", FolderName: "folder1", FolderCreateTime: 1719797051, FolderDesc: "desc1"},
 	}
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().ListFolder(userName, "create", "desc").Return(folders)
+	t.mockStorage.EXPECT().ListFolder(gomock.Any(), userName, "create", "desc").Return(folders, nil)
 	// execute
 	out, err := t.Execute([]string{"list-folders", userName, "--sort-created", "desc"})
 	// testing
@@ -332,11 +331,50 @@ func (t *TestRepl) TestListFoldersCmdByCreateSuccess() {
 	assert.Contains(t.T(), list[0], "folder3")
 }
 
+func (t *TestRepl) TestListFoldersCmdFlagsNotKept() {
+	userName := "test"
+	// mock data
+	gomock.InOrder(
+		t.mockStorage.EXPECT().ListFolder(gomock.Any(), userName, "create", "desc").Return(nil, nil),
+		t.mockStorage.EXPECT().ListFolder(gomock.Any(), userName, "name", "asc").Return(nil, nil).Times(2),
+	)
+	// execute
+	out := t.Interact("list-folders test --sort-created desc\n" +
+		"list-folders test\n" +
+		"list-folders test --sort-name desc --unknown\n" +
+		"list-folders test\n" +
+		"exit\n")
+	// testing
+	assert.Contains(t.T(), out, "# Usage:\n  list-folders")
+}
+
+func (t *TestRepl) TestParseListOptions() {
+	cmd := &cobra.Command{}
+	addListFlags(cmd)
+	tests := []struct {
+		args []string
+		want listOptions
+		ok   bool
+	}{
+		{nil, listOptions{"name", "asc"}, true},
+		{[]string{"--sort-name", "DESC"}, listOptions{"name", "desc"}, true},
+		{[]string{"--sort-created", "asc"}, listOptions{"create", "asc"}, true},
+		{[]string{"--sort-name", "asc", "--sort-created", "desc"}, listOptions{"create", "desc"}, true},
+		{[]string{"--sort-name", "up"}, listOptions{"name", "up"}, false},
+	}
+	for _, tt := range tests {
+		resetFlags(cmd)
+		assert.NoError(t.T(), cmd.ParseFlags(tt.args))
+		opts, ok := parseListOptions(cmd, listOptions{"name", "asc"})
+		assert.Equal(t.T(), tt.want, opts, tt.args)
+		assert.Equal(t.T(), tt.ok, ok, tt.args)
+	}
+}
+
 func (t *TestRepl) TestListFoldersCmdNoData() {
 	userName := "test"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().ListFolder(userName, "name", "asc").Return([]storage.VirtualFileSysEntity{})
+	t.mockStorage.EXPECT().ListFolder(gomock.Any(), userName, "name", "asc").Return([]storage.VirtualFileSysEntity{}, nil)
 	// execute
 	out, err := t.Execute([]string{"list-folders", userName})
 	// testing
@@ -358,7 +396,7 @@ func (t *TestRepl) TestListFoldersCmdUnrecognizedArgs() {
 func (t *TestRepl) TestListFoldersCmdUserNameNotExist() {
 	userName := "test"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(false)
+	t.mockStorage.EXPECT().ListFolder(gomock.Any(), userName, "name", "asc").Return(nil, storage.ErrUserNotFound)
 	// execute
 	_, err := t.Execute([]string{"list-folders", userName})
 	// testing
@@ -372,10 +410,7 @@ func (t *TestRepl) TestRenameFolderCmdSuccess() {
 	folderName := "folder"
 	newFolderName := "newfolder"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(true).Times(1)
-	t.mockStorage.EXPECT().IsExistFolder(userName, newFolderName).Return(false).Times(1)
-	t.mockStorage.EXPECT().RenameFolder(userName, folderName, newFolderName)
+	t.mockStorage.EXPECT().RenameFolder(gomock.Any(), userName, folderName, newFolderName).Return(nil)
 	// execute
 	out, err := t.Execute([]string{"rename-folder", userName, folderName, newFolderName})
 	// testing
@@ -384,6 +419,20 @@ func (t *TestRepl) TestRenameFolderCmdSuccess() {
 	assert.Equal(t.T(), expected, out)
 }
 
+func (t *TestRepl) TestRenameFolderCmdStorageInvalidName() {
+	userName := "test"
+	folderName := "folder"
+	newFolderName := ".goREPL"
+	// mock data
+	t.mockStorage.EXPECT().RenameFolder(gomock.Any(), userName, folderName, newFolderName).Return(&storage.InvalidNameError{Name: newFolderName})
+	// execute
+	_, err := t.Execute([]string{"rename-folder", userName, folderName, newFolderName})
+	// testing
+	assert.NotNil(t.T(), err)
+	expected := fmt.Sprintf("the [%s] contain invalid chars", newFolderName)
+	assert.Equal(t.T(), expected, err.Error())
+}
+
 func (t *TestRepl) TestRenameFolderCmdUnrecognizedArgs() {
 	// execute
 	_, err := t.Execute([]string{"rename-folder"})
@@ -399,7 +448,7 @@ func (t *TestRepl) TestRenameFolderCmdUserNameNotExist() {
 	folderName := "folder"
 	newFolderName := "newFolder"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(false)
+	t.mockStorage.EXPECT().RenameFolder(gomock.Any(), userName, folderName, newFolderName).Return(storage.ErrUserNotFound)
 	// execute
 	_, err := t.Execute([]string{"rename-folder", userName, folderName, newFolderName})
 	// testing
@@ -413,8 +462,7 @@ func (t *TestRepl) TestRenameFolderCmdFolderNameNotExist() {
 	folderName := "folder"
 	newFolderName := "newfolder"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(false)
+	t.mockStorage.EXPECT().RenameFolder(gomock.Any(), userName, folderName, newFolderName).Return(storage.ErrFolderNotFound)
 	// execute
 	_, err := t.Execute([]string{"rename-folder", userName, folderName, newFolderName})
 	// testing
@@ -428,9 +476,7 @@ func (t *TestRepl) TestRenameFolderCmdNewFolderNameExist() {
 	folderName := "folder"
 	newFolderName := "newfolder"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, newFolderName).Return(true)
+	t.mockStorage.EXPECT().RenameFolder(gomock.Any(), userName, folderName, newFolderName).Return(storage.ErrFolderExists)
 	// execute
 	_, err := t.Execute([]string{"rename-folder", userName, folderName, newFolderName})
 	// testing
@@ -444,9 +490,9 @@ func (t *TestRepl) TestRenameFolderCmdNewFolderNameInvalidLength() {
 	folderName := "folder"
 	newFolderName := "newfolder12345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, newFolderName).Return(false)
+	t.mockStorage.EXPECT().IsExistUser(gomock.Any(), userName).Return(true)
+	t.mockStorage.EXPECT().IsExistFolder(gomock.Any(), userName, folderName).Return(true)
+	t.mockStorage.EXPECT().IsExistFolder(gomock.Any(), userName, newFolderName).Return(false)
 	// execute
 	_, err := t.Execute([]string{"rename-folder", userName, folderName, newFolderName})
 	// testing
@@ -460,9 +506,9 @@ func (t *TestRepl) TestRenameFolderCmdNewFolderNameInvalidChar() {
 	folderName := "folder"
 	newFolderName := "newfolder@123"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, newFolderName).Return(false)
+	t.mockStorage.EXPECT().IsExistUser(gomock.Any(), userName).Return(true)
+	t.mockStorage.EXPECT().IsExistFolder(gomock.Any(), userName, folderName).Return(true)
+	t.mockStorage.EXPECT().IsExistFolder(gomock.Any(), userName, newFolderName).Return(false)
 	// execute
 	_, err := t.Execute([]string{"rename-folder", userName, folderName, newFolderName})
 	// testing
@@ -477,10 +523,7 @@ func (t *TestRepl) TestCreateFileCmdSuccess() {
 	fileName := "file"
 	desc := "desc"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(true)
-	t.mockStorage.EXPECT().IsExistFile(userName, folderName, fileName).Return(false)
-	t.mockStorage.EXPECT().AddFile(userName, folderName, fileName, desc)
+	t.mockStorage.EXPECT().AddFile(gomock.Any(), userName, folderName, fileName, desc).Return(nil)
 	// execute
 	out, err := t.Execute([]string{"create-file", userName, folderName, fileName, desc})
 	// testing
@@ -505,7 +548,7 @@ func (t *TestRepl) TestCreateFileCmdUserNameNotExist() {
 	fileName := "file"
 	desc := "desc"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(false)
+	t.mockStorage.EXPECT().AddFile(gomock.Any(), userName, folderName, fileName, desc).Return(storage.ErrUserNotFound)
 	// execute
 	_, err := t.Execute([]string{"create-file", userName, folderName, fileName, desc})
 	// testing
@@ -520,8 +563,7 @@ func (t *TestRepl) TestCreateFileCmdFolderNameNotExist() {
 	fileName := "file"
 	desc := "desc"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(false)
+	t.mockStorage.EXPECT().AddFile(gomock.Any(), userName, folderName, fileName, desc).Return(storage.ErrFolderNotFound)
 	// execute
 	_, err := t.Execute([]string{"create-file", userName, folderName, fileName, desc})
 	// testing
@@ -535,8 +577,8 @@ func (t *TestRepl) TestCreateFileCmdFileNameInvalidLength() {
 	folderName := "folder"
 	fileName := "f12345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(true)
+	t.mockStorage.EXPECT().IsExistUser(gomock.Any(), userName).Return(true)
+	t.mockStorage.EXPECT().IsExistFolder(gomock.Any(), userName, folderName).Return(true)
 	// execute
 	_, err := t.Execute([]string{"create-file", userName, folderName, fileName})
 	// testing
@@ -551,8 +593,8 @@ func (t *TestRepl) TestCreateFileCmdFileNameInvalidChar() {
 	fileName := "file@123"
 	desc := "desc"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(true)
+	t.mockStorage.EXPECT().IsExistUser(gomock.Any(), userName).Return(true)
+	t.mockStorage.EXPECT().IsExistFolder(gomock.Any(), userName, folderName).Return(true)
 	// execute
 	_, err := t.Execute([]string{"create-file", userName, folderName, fileName, desc})
 	// testing
@@ -567,9 +609,7 @@ func (t *TestRepl) TestCreateFileCmdFileNameExist() {
 	fileName := "file"
 	desc := "desc"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(true)
-	t.mockStorage.EXPECT().IsExistFile(userName, folderName, fileName).Return(true)
+	t.mockStorage.EXPECT().AddFile(gomock.Any(), userName, folderName, fileName, desc).Return(storage.ErrFileExists)
 	// execute
 	_, err := t.Execute([]string{"create-file", userName, folderName, fileName, desc})
 	// testing
@@ -584,9 +624,9 @@ func (t *TestRepl) TestCreateFileCmdFileDescInvalidLength() {
 	fileName := "file"
 	desc := "desc1234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(true)
-	t.mockStorage.EXPECT().IsExistFile(userName, folderName, fileName).Return(false)
+	t.mockStorage.EXPECT().IsExistUser(gomock.Any(), userName).Return(true)
+	t.mockStorage.EXPECT().IsExistFolder(gomock.Any(), userName, folderName).Return(true)
+	t.mockStorage.EXPECT().IsExistFile(gomock.Any(), userName, folderName, fileName).Return(false)
 	// execute
 	_, err := t.Execute([]string{"create-file", userName, folderName, fileName, desc})
 	// testing
@@ -599,10 +639,7 @@ func (t *TestRepl) TestDeleteFileCmdSuccess() {
 	folderName := "folder"
 	fileName := "file"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(true)
-	t.mockStorage.EXPECT().IsExistFile(userName, folderName, fileName).Return(true)
-	t.mockStorage.EXPECT().DeleteFile(userName, folderName, fileName)
+	t.mockStorage.EXPECT().DeleteFile(gomock.Any(), userName, folderName, fileName).Return(nil)
 	// execute
 	out, err := t.Execute([]string{"delete-file", userName, folderName, fileName})
 	// testing
@@ -626,7 +663,7 @@ func (t *TestRepl) TestDeleteFileCmdUserNameNotExist() {
 	folderName := "folder"
 	fileName := "file"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(false)
+	t.mockStorage.EXPECT().DeleteFile(gomock.Any(), userName, folderName, fileName).Return(storage.ErrUserNotFound)
 	// execute
 	_, err := t.Execute([]string{"delete-file", userName, folderName, fileName})
 	// testing
@@ -640,8 +677,7 @@ func (t *TestRepl) TestDeleteFileCmdFolderNameNotExist() {
 	folderName := "folder"
 	fileName := "file"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(false)
+	t.mockStorage.EXPECT().DeleteFile(gomock.Any(), userName, folderName, fileName).Return(storage.ErrFolderNotFound)
 	// execute
 	_, err := t.Execute([]string{"delete-file", userName, folderName, fileName})
 	// testing
@@ -655,9 +691,7 @@ func (t *TestRepl) TestDeleteFileCmdFileNameNotExist() {
 	folderName := "folder"
 	fileName := "file"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(true)
-	t.mockStorage.EXPECT().IsExistFile(userName, folderName, fileName).Return(false)
+	t.mockStorage.EXPECT().DeleteFile(gomock.Any(), userName, folderName, fileName).Return(storage.ErrFileNotFound)
 	// execute
 	_, err := t.Execute([]string{"delete-file", userName, folderName, fileName})
 	// testing
@@ -675,9 +709,7 @@ func (t *TestRepl) TestListFilesCmdSuccess() {
 		{FileName: "file3", FileCreateTime: 1719797050, FileDesc: "desc3"},
 	}
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(true)
-	t.mockStorage.EXPECT().ListFile(userName, folderName, "name", "asc").Return(files)
+	t.mockStorage.EXPECT().ListFile(gomock.Any(), userName, folderName, "name", "asc").Return(files, nil)
 	// execute
 	out, err := t.Execute([]string{"list-files", userName, folderName})
 	// testing
@@ -696,9 +728,7 @@ func (t *TestRepl) TestListFilesCmdByNameSuccess() {
 		{FileName: "file1", FileCreateTime: 1719797050, FileDesc: "desc1"},
 	}
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(true)
-	t.mockStorage.EXPECT().ListFile(userName, folderName, "name", "desc").Return(files)
+	t.mockStorage.EXPECT().ListFile(gomock.Any(), userName, folderName, "name", "desc").Return(files, nil)
 	// execute
 	out, err := t.Execute([]string{"list-files", userName, folderName, "--sort-name", "desc"})
 	// testing
@@ -717,9 +747,7 @@ func (t *TestRepl) TestListFilesCmdByCreateSuccess() {
 		{FileName: "file1", FileCreateTime: 1719797051, FileDesc: "desc1"},
 	}
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(true)
-	t.mockStorage.EXPECT().ListFile(userName, folderName, "create", "desc").Return(files)
+	t.mockStorage.EXPECT().ListFile(gomock.Any(), userName, folderName, "create", "desc").Return(files, nil)
 	// execute
 	out, err := t.Execute([]string{"list-files", userName, folderName, "--sort-created", "desc"})
 	// testing
@@ -733,9 +761,7 @@ func (t *TestRepl) TestListFilesCmdNoData() {
 	userName := "test"
 	folderName := "folder"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(true)
-	t.mockStorage.EXPECT().ListFile(userName, folderName, "name", "asc").Return([]storage.VirtualFileSysFileEntity{})
+	t.mockStorage.EXPECT().ListFile(gomock.Any(), userName, folderName, "name", "asc").Return([]storage.VirtualFileSysFileEntity{}, nil)
 	// execute
 	out, err := t.Execute([]string{"list-files", userName, folderName})
 	// testing
@@ -758,7 +784,7 @@ func (t *TestRepl) TestListFilesCmdUserNameNotExist() {
 	userName := "test"
 	folderName := "folder"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(false)
+	t.mockStorage.EXPECT().ListFile(gomock.Any(), userName, folderName, "name", "asc").Return(nil, storage.ErrUserNotFound)
 	// execute
 	_, err := t.Execute([]string{"list-files", userName, folderName})
 	// testing
@@ -771,8 +797,7 @@ func (t *TestRepl) TestListFilesCmdFolderNameNotExist() {
 	userName := "test"
 	folderName := "folder"
 	// mock data
-	t.mockStorage.EXPECT().IsExistUser(userName).Return(true)
-	t.mockStorage.EXPECT().IsExistFolder(userName, folderName).Return(false)
+	t.mockStorage.EXPECT().ListFile(gomock.Any(), userName, folderName, "name", "asc").Return(nil, storage.ErrFolderNotFound)
 	// execute
 	_, err := t.Execute([]string{"list-files", userName, folderName})
 	// testing
@@ -781,13 +806,289 @@ func (t *TestRepl) TestListFilesCmdFolderNameNotExist() {
 	assert.Equal(t.T(), expected, err.Error())
 }
 
+func (t *TestRepl) TestCreateFolderCmdActor() {
+	userName := "test"
+	folderName := "folder"
+	// mock data
+	t.mockStorage.EXPECT().AddFolder(actorMatcher(userName), userName, folderName, "").Return(nil)
+	// execute
+	_, err := t.Execute([]string{"create-folder", userName, folderName})
+	// testing
+	assert.Nil(t.T(), err)
+}
+
+func (t *TestRepl) TestCreateFolderCmdCanceled() {
+	userName := "test"
+	folderName := "folder"
+	// mock data
+	t.mockStorage.EXPECT().AddFolder(gomock.Any(), userName, folderName, "").Return(context.Canceled)
+	// execute
+	_, err := t.Execute([]string{"create-folder", userName, folderName})
+	// testing
+	assert.NotNil(t.T(), err)
+	assert.Equal(t.T(), "the command was canceled", err.Error())
+}
+
+func (t *TestRepl) TestListFoldersCmdTimeout() {
+	userName := "test"
+	// mock data
+	t.mockStorage.EXPECT().ListFolder(gomock.Any(), userName, "name", "asc").Return(nil, context.DeadlineExceeded)
+	// execute
+	_, err := t.Execute([]string{"list-folders", userName})
+	// testing
+	assert.NotNil(t.T(), err)
+	assert.Equal(t.T(), "the command timed out", err.Error())
+}
+
+func (t *TestRepl) TestCommandContext() {
+	t.repl.timeout = time.Minute
+	defer func() {
+		t.repl.timeout = 0
+	}()
+	// execute
+	ctx, cancel := t.repl.commandContext(context.Background())
+	// testing
+	assert.NotEmpty(t.T(), storage.TraceIDFromContext(ctx))
+	_, ok := ctx.Deadline()
+	assert.True(t.T(), ok)
+	cancel()
+	assert.ErrorIs(t.T(), ctx.Err(), context.Canceled)
+}
+
+// useMemoryStorage swaps the mock for an in-memory storage,
+// the mock can't be committed to
+func (t *TestRepl) useMemoryStorage() storage.IStorage {
+	s := storage.NewVirtualFileSysStorage()
+	t.repl.storage = s
+	t.T().Cleanup(func() {
+		t.repl.storage = t.mockStorage
+		t.repl.tx = nil
+	})
+	return s
+}
+
+func (t *TestRepl) TestBeginCmdNotSupported() {
+	// execute
+	_, err := t.Execute([]string{"begin"})
+	// testing
+	assert.ErrorIs(t.T(), err, storage.ErrTxNotSupported)
+	assert.Nil(t.T(), t.repl.tx)
+}
+
+func (t *TestRepl) TestCommitCmdSuccess() {
+	s := t.useMemoryStorage()
+	ctx := context.Background()
+	// execute
+	out, err := t.Execute([]string{"begin"})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "Begin a transaction\n", out)
+	_, err = t.Execute([]string{"register", "test"})
+	assert.Nil(t.T(), err)
+	_, err = t.Execute([]string{"create-folder", "test", "folder"})
+	assert.Nil(t.T(), err)
+	_, err = t.Execute([]string{"create-file", "test", "folder", "file"})
+	assert.Nil(t.T(), err)
+	// testing
+	out, err = t.Execute([]string{"list-files", "test", "folder"})
+	assert.Nil(t.T(), err)
+	assert.True(t.T(), strings.HasPrefix(out, "file "))
+	assert.False(t.T(), s.IsExistUser(ctx, "test"))
+	out, err = t.Execute([]string{"commit"})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "Commit 3 changes successfully\n", out)
+	assert.True(t.T(), s.IsExistFile(ctx, "test", "folder", "file"))
+	assert.Nil(t.T(), t.repl.tx)
+}
+
+func (t *TestRepl) TestCommitCmdConflict() {
+	s := t.useMemoryStorage()
+	ctx := context.Background()
+	assert.Nil(t.T(), s.AddUser(ctx, "test"))
+	// execute
+	_, err := t.Execute([]string{"begin"})
+	assert.Nil(t.T(), err)
+	_, err = t.Execute([]string{"create-folder", "test", "folder"})
+	assert.Nil(t.T(), err)
+	assert.Nil(t.T(), s.AddFolder(ctx, "test", "folder", ""))
+	_, err = t.Execute([]string{"commit"})
+	// testing
+	assert.ErrorIs(t.T(), err, storage.ErrFolderExists)
+	assert.Nil(t.T(), t.repl.tx)
+}
+
+func (t *TestRepl) TestRollbackCmdSuccess() {
+	s := t.useMemoryStorage()
+	// execute
+	_, err := t.Execute([]string{"begin"})
+	assert.Nil(t.T(), err)
+	_, err = t.Execute([]string{"register", "test"})
+	assert.Nil(t.T(), err)
+	out, err := t.Execute([]string{"rollback"})
+	// testing
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "Rollback successfully\n", out)
+	assert.False(t.T(), s.IsExistUser(context.Background(), "test"))
+	assert.Nil(t.T(), t.repl.tx)
+}
+
+func (t *TestRepl) TestTxCmdNotOpen() {
+	// execute
+	_, err := t.Execute([]string{"commit"})
+	// testing
+	assert.Equal(t.T(), "no transaction is open", err.Error())
+	_, err = t.Execute([]string{"rollback"})
+	assert.Equal(t.T(), "no transaction is open", err.Error())
+}
+
+func (t *TestRepl) TestBeginCmdAlreadyOpen() {
+	t.useMemoryStorage()
+	// execute
+	_, err := t.Execute([]string{"begin"})
+	assert.Nil(t.T(), err)
+	_, err = t.Execute([]string{"begin"})
+	// testing
+	assert.Equal(t.T(), "a transaction is already open", err.Error())
+	assert.NotNil(t.T(), t.repl.tx)
+}
+
+func (t *TestRepl) TestTxRollbackOnError() {
+	s := t.useMemoryStorage()
+	// execute
+	out := t.Interact("register test\nbegin\ncreate-folder test folder\ncreate-folder test folder\ncommit\nexit\n")
+	// testing
+	assert.Contains(t.T(), out, "Warning: the transaction was rolled back\n")
+	assert.False(t.T(), s.IsExistFolder(context.Background(), "test", "folder"))
+	assert.Nil(t.T(), t.repl.tx)
+}
+
+func (t *TestRepl) TestTxRollbackOnExit() {
+	s := t.useMemoryStorage()
+	// execute
+	out := t.Interact("begin\nregister test\nexit\n")
+	// testing
+	assert.Contains(t.T(), out, "Warning: the open transaction was rolled back\n")
+	assert.False(t.T(), s.IsExistUser(context.Background(), "test"))
+	assert.Nil(t.T(), t.repl.tx)
+}
+
+// Interact feeds input to the interactive loop and returns what it printed
+func (t *TestRepl) Interact(input string) string {
+	var out bytes.Buffer
+	t.repl.rootCmd.SetIn(strings.NewReader(input))
+	t.repl.rootCmd.SetOut(&out)
+	t.repl.rootCmd.SetErr(&out)
+	t.repl.rootCmd.SetContext(context.Background())
+	t.repl.RootCmdRunner(t.repl.rootCmd, nil)
+
+	return out.String()
+}
+
 func (t *TestRepl) TestHelpCmd() {
+	var out bytes.Buffer
+	t.repl.rootCmd.SetOut(&out)
 	// execute
 	t.repl.HelpCmd()
+	// testing
+	assert.Contains(t.T(), out.String(), "  register [username]\n")
+}
+
+func (t *TestRepl) TestRun() {
+	s := storage.NewVirtualFileSysStorage()
+	repl := &Repl{rootCmd: &cobra.Command{Use: "repl"}}
+	repl.AddRegisterCmd()
+	repl.AddCreateFolderCmd()
+	repl.AddBeginCmd()
+	repl.SetStorage(s)
+	// execute
+	var out, errOut bytes.Buffer
+	err := repl.Run(context.Background(), strings.NewReader("register test\nregister test\nbegin\ncreate-folder test folder\n"), &out, &errOut)
+	// testing
+	assert.Nil(t.T(), err)
+	assert.Contains(t.T(), out.String(), "# Add [test] successfully\n")
+	assert.Contains(t.T(), out.String(), "Warning: the open transaction was rolled back\n")
+	assert.Equal(t.T(), "Error: the [test] has already existed\n", errOut.String())
+	assert.False(t.T(), s.IsExistFolder(context.Background(), "test", "folder"))
+	assert.Nil(t.T(), repl.tx)
+}
+
+func (t *TestRepl) TestNewStorageError() {
+	for i := 0; i < 2; i++ {
+		repl := New()
+		repl.rootCmd.SetArgs([]string{"--data-dir", t.T().TempDir(), "--host-dir", t.T().TempDir()})
+		repl.rootCmd.SetIn(strings.NewReader(""))
+		repl.rootCmd.SetOut(io.Discard)
+		repl.rootCmd.SetErr(io.Discard)
+		// execute
+		err := repl.Execute()
+		// testing
+		assert.EqualError(t.T(), err, "only one of --data-dir, --host-dir and --remote can be used")
+		assert.Nil(t.T(), repl.storage)
+	}
+}
+
+func (t *TestRepl) TestRunCanceled() {
+	repl := &Repl{rootCmd: &cobra.Command{Use: "repl"}}
+	repl.AddRegisterCmd()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// execute
+	var out bytes.Buffer
+	err := repl.Run(ctx, strings.NewReader("register test\n"), &out, &out)
+	// testing
+	assert.ErrorIs(t.T(), err, context.Canceled)
+	assert.NotContains(t.T(), out.String(), "Add [test]")
+	assert.NotNil(t.T(), repl.storage)
+}
+
+func (t *TestRepl) TestLineContinued() {
+	t.useMemoryStorage()
+	// execute
+	out := t.Interact("register \\\ntest\ncreate-folder test \"it's\nexit\n")
+	// testing
+	assert.Contains(t.T(), out, "# > Add [test] successfully\n")
+	assert.Contains(t.T(), out, "# Error: unterminated quote, missing the closing \"\n")
 }
 
 func (t *TestRepl) TestSplitArgs() {
 	str := "cmd 'new folder' 'hello world'"
-	s := t.repl.SplitArgs(str)
+	s, err := t.repl.SplitArgs(str)
+	assert.Nil(t.T(), err)
 	assert.Equal(t.T(), 3, len(s))
+
+	tests := []struct {
+		line string
+		want []string
+		err  error
+	}{
+		{``, nil, nil},
+		{`  a   b  `, []string{"a", "b"}, nil},
+		{`cmd "it's" 'say "hi"'`, []string{"cmd", "it's", `say "hi"`}, nil},
+		{`a '' "" b`, []string{"a", "", "", "b"}, nil},
+		{`a\ b c\'d \\`, []string{"a b", "c'd", `\`}, nil},
+		{`"a\"b\\c\d" 'e\f'`, []string{`a"b\c\d`, `e\f`}, nil},
+		{`ab"c d"'e'`, []string{"abc de"}, nil},
+		{"a \\\nb \"c\\\nd\"", []string{"a", "b", "cd"}, nil},
+		{"a 'b\\\nc'", []string{"a", "b\\\nc"}, nil},
+		{`a b\`, nil, errLineContinued},
+		{`a "b`, nil, errUnterminatedQuote},
+		{`a 'b"`, nil, errUnterminatedQuote},
+		{`a "b\"`, nil, errUnterminatedQuote},
+	}
+	for _, tt := range tests {
+		args, err := t.repl.SplitArgs(tt.line)
+		assert.ErrorIs(t.T(), err, tt.err, tt.line)
+		assert.Equal(t.T(), tt.want, args, tt.line)
+	}
+}
+
+// actorMatcher matches a context carrying the acting user
+type actorMatcher string
+
+func (m actorMatcher) Matches(x interface{}) bool {
+	ctx, ok := x.(context.Context)
+	return ok && storage.ActorFromContext(ctx) == string(m)
+}
+
+func (m actorMatcher) String() string {
+	return fmt.Sprintf("context with actor %s", string(m))
 }
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// runScript runs the commands in the file at path, or read from the input
+// of cmd for -, one per line. Blank lines and lines starting with # are
+// skipped. It stops at the first failing command, unless --continue-on-error.
+func (r *Repl) runScript(cmd *cobra.Command, path string) error {
+	in := cmd.InOrStdin()
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	return r.runLines(cmd, in, "line", r.continueOnError)
+}
+
+// runLines runs the commands read from in, one per line, telling the errors
+// with where and the line they're on. It stops at the first failing command,
+// unless continueOnError.
+func (r *Repl) runLines(cmd *cobra.Command, in io.Reader, where string, continueOnError bool) error {
+	ctx := cmd.Context()
+	out, errOut := cmd.OutOrStdout(), cmd.ErrOrStderr()
+	// the errors are told with their line instead
+	silenced := cmd.SilenceErrors
+	cmd.SilenceErrors = true
+	defer func() {
+		cmd.SilenceErrors = silenced
+	}()
+
+	scanner := bufio.NewScanner(in)
+	failed := 0
+	// pending holds the lines continued with a backslash so far, the
+	// command is told by the line it starts on
+	pending, start := "", 0
+	// fail tells err of the command starting on line start, or returns it
+	// when the script has to stop
+	fail := func(err error) error {
+		if !continueOnError {
+			r.rollbackOpenTx(out)
+			return fmt.Errorf("%s %d: %w", where, start, err)
+		}
+		failed++
+		fmt.Fprintf(errOut, "Error: %s %d: %v\n", where, start, err)
+		return nil
+	}
+	for n := 1; scanner.Scan() && ctx.Err() == nil; n++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if pending == "" {
+			start = n
+			line = strings.TrimSpace(line)
+			switch {
+			case line == "" || strings.HasPrefix(line, "#"):
+				continue
+			case line == "exit":
+				r.rollbackOpenTx(out)
+				return failedError(failed)
+			case line == "help":
+				r.HelpCmd()
+				continue
+			}
+		}
+		line = pending + line
+		args, err := r.SplitArgs(line)
+		if errors.Is(err, errLineContinued) {
+			pending = line + "\n"
+			continue
+		}
+		pending = ""
+		if err == nil && len(args) > 0 {
+			err = r.exec(ctx, cmd, args)
+		}
+		if err != nil {
+			err = fail(err)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if pending != "" && ctx.Err() == nil && scanner.Err() == nil {
+		err := fail(errLineContinued)
+		if err != nil {
+			return err
+		}
+	}
+	r.rollbackOpenTx(out)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return failedError(failed)
+}
+
+var errCommandsFailed = errors.New("commands failed")
+
+// failedError returns the error of a script with n failed commands, if any
+func failedError(n int) error {
+	if n == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %d", errCommandsFailed, n)
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/reddtsai/goREPL/pkg/storage"
+)
+
+type TestScript struct {
+	suite.Suite
+
+	storage storage.IStorage
+	repl    *Repl
+	out     bytes.Buffer
+	errOut  bytes.Buffer
+}
+
+func TestScriptSuite(t *testing.T) {
+	suite.Run(t, new(TestScript))
+}
+
+func (t *TestScript) SetupTest() {
+	t.storage = storage.NewVirtualFileSysStorage()
+	t.repl = &Repl{storage: t.storage}
+	t.repl.rootCmd = &cobra.Command{
+		Use:  "repl",
+		RunE: t.repl.RootCmdRunner,
+	}
+	t.repl.rootCmd.Flags().StringVarP(&t.repl.script, "file", "f", "", "")
+	t.repl.rootCmd.Flags().BoolVar(&t.repl.continueOnError, "continue-on-error", false, "")
+	t.repl.AddRegisterCmd()
+	t.repl.AddCreateFolderCmd()
+	t.repl.AddListFoldersCmd()
+	t.repl.AddBeginCmd()
+	t.repl.AddCommitCmd()
+	t.out.Reset()
+	t.errOut.Reset()
+	t.repl.rootCmd.SetOut(&t.out)
+	t.repl.rootCmd.SetErr(&t.errOut)
+}
+
+// run executes the root command with args, reading script from stdin
+func (t *TestScript) run(script string, args ...string) error {
+	resetFlags(t.repl.rootCmd)
+	t.repl.rootCmd.SetIn(strings.NewReader(script))
+	t.repl.rootCmd.SetArgs(args)
+	return t.repl.rootCmd.ExecuteContext(context.Background())
+}
+
+func (t *TestScript) TestOneShot() {
+	t.NoError(t.run("", "register", "alice"))
+	t.Equal("Add [alice] successfully\n", t.out.String())
+
+	t.Error(t.run("", "create-folder", "alice", "b@d"))
+	t.Equal("Error: the [b@d] contain invalid chars\n", t.errOut.String())
+	t.Error(t.run("", "list-folders", "alice", "--sort-name", "up"))
+	t.Error(t.run("", "unknown"))
+}
+
+func (t *TestScript) TestNoRC() {
+	rc := filepath.Join(t.T().TempDir(), "rc")
+	t.Require().NoError(os.WriteFile(rc, []byte("register bob\nalias reg register\n"), 0o600))
+	t.repl.config = newConfig()
+	t.Require().NoError(t.repl.config.set("rc", rc, "test"))
+	t.repl.AddAliasCmd()
+	// the aliases are for the interactive loop only
+	t.Error(t.run("reg alice\n", "-f", "-"))
+	t.Error(t.run("", "reg", "alice"))
+	t.False(t.storage.IsExistUser(context.Background(), "alice"))
+	t.False(t.storage.IsExistUser(context.Background(), "bob"))
+}
+
+func (t *TestScript) TestFile() {
+	path := filepath.Join(t.T().TempDir(), "setup.repl")
+	err := os.WriteFile(path, []byte("# setup\nregister alice\n\ncreate-folder alice docs\r\n"), 0o644)
+	t.Require().NoError(err)
+
+	t.NoError(t.run("", "-f", path))
+	t.Equal("Add [alice] successfully\nCreate [docs] successfully\n", t.out.String())
+	t.Empty(t.errOut.String())
+	t.True(t.storage.IsExistFolder(context.Background(), "alice", "docs"))
+
+	t.ErrorIs(t.run("", "-f", path+".missing"), os.ErrNotExist)
+}
+
+func (t *TestScript) TestStopOnError() {
+	err := t.run("register alice\ncreate-folder bob docs\nregister carol\n", "-f", "-")
+	t.EqualError(err, "line 2: the [bob] doesn't exist")
+	t.Equal("Error: line 2: the [bob] doesn't exist\n", t.errOut.String())
+	t.False(t.storage.IsExistUser(context.Background(), "carol"))
+
+	err = t.run("list-folders\n", "-f", "-")
+	t.ErrorContains(err, "line 1: unrecognized argument\nUsage:\n  list-folders")
+	err = t.run("register alice --unknown\n", "-f", "-")
+	t.EqualError(err, "line 1: unknown flag: --unknown")
+	err = t.run("\nfly\n", "-f", "-")
+	t.ErrorIs(err, errUnrecognizedCmd)
+	t.EqualError(err, "line 2: unrecognized command")
+}
+
+func (t *TestScript) TestContinueOnError() {
+	err := t.run("create-folder bob docs\nregister alice\nregister alice\nexit\nregister carol\n", "-f", "-", "--continue-on-error")
+	t.ErrorIs(err, errCommandsFailed)
+	t.Equal("Error: line 1: the [bob] doesn't exist\n"+
+		"Error: line 3: the [alice] has already existed\n"+
+		"Error: commands failed: 2\n", t.errOut.String())
+	t.True(t.storage.IsExistUser(context.Background(), "alice"))
+	t.False(t.storage.IsExistUser(context.Background(), "carol"))
+}
+
+func (t *TestScript) TestTransaction() {
+	err := t.run("begin\nregister alice\ncreate-folder alice docs\ncreate-folder alice docs\ncommit\n", "-f", "-")
+	t.EqualError(err, "line 4: the [docs] has already existed")
+	t.Contains(t.out.String(), "Warning: the transaction was rolled back\n")
+	t.False(t.storage.IsExistUser(context.Background(), "alice"))
+
+	t.out.Reset()
+	t.NoError(t.run("begin\nregister alice\n", "-f", "-"))
+	t.Contains(t.out.String(), "Warning: the open transaction was rolled back\n")
+	t.False(t.storage.IsExistUser(context.Background(), "alice"))
+}
+
+func (t *TestScript) TestLineContinued() {
+	err := t.run("register \\\n  alice\ncreate-folder alice \\\n\"my docs\"\ncreate-folder alice \"it's\nregister b\n", "-f", "-", "--continue-on-error")
+	t.ErrorIs(err, errCommandsFailed)
+	t.Equal("Add [alice] successfully\n", t.out.String())
+	t.Equal("Error: line 3: the [my docs] contain invalid chars\n"+
+		"Error: line 5: unterminated quote, missing the closing \"\n"+
+		"Error: line 6: the [b] invalid length\n"+
+		"Error: commands failed: 3\n", t.errOut.String())
+
+	t.errOut.Reset()
+	err = t.run("register carol\nregister dave \\\n", "-f", "-")
+	t.EqualError(err, "line 2: the line continues past the end of the input")
+	t.False(t.storage.IsExistUser(context.Background(), "dave"))
+}
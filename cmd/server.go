@@ -0,0 +1,572 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/reddtsai/goREPL/pkg/policy"
+	"github.com/reddtsai/goREPL/pkg/storage"
+)
+
+// error codes of the REST API, telling clients which error they got
+// without parsing the message
+const (
+	CodeInvalidArgument  = "invalid_argument"
+	CodeUserNotFound     = "user_not_found"
+	CodeUserExists       = "user_exists"
+	CodeFolderNotFound   = "folder_not_found"
+	CodeFolderExists     = "folder_exists"
+	CodeFileNotFound     = "file_not_found"
+	CodeFileExists       = "file_exists"
+	CodeInvalidName      = "invalid_name"
+	CodeCanceled         = "canceled"
+	CodeTimeout          = "timeout"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeInternal         = "internal"
+)
+
+// TraceIDHeader carries the trace ID of a request, a new one is made when
+// it's missing
+const TraceIDHeader = "X-Trace-Id"
+
+// APIError is the body of a failed REST API request
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"error"`
+}
+
+// APIUser is the body of a user
+type APIUser struct {
+	UserName string `json:"userName"`
+}
+
+// APIRequest is the body of a POST or PATCH request, creating or renaming
+// a user, folder or file
+type APIRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+func (r *Repl) AddServeCmd() {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "serve the virtual file system as a REST API",
+		Args:  cobra.NoArgs,
+		RunE:  r.ServeRunner,
+	}
+	cmd.Flags().String("addr", ":8080", "listen on this address")
+	cmd.SetUsageTemplate("Usage:\n  serve [--addr host:port]")
+
+	r.rootCmd.AddCommand(cmd)
+}
+
+// ServeRunner serves the REST API until interrupted, then lets the running
+// requests finish
+func (r *Repl) ServeRunner(cmd *cobra.Command, args []string) error {
+	addr, err := cmd.Flags().GetString("addr")
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler:           newHandler(r.storage, r.timeout, r.naming()),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(ln)
+	}()
+	fmt.Fprintf(cmd.OutOrStdout(), "Serving on %s\n", ln.Addr())
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = srv.Shutdown(shutdownCtx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), "Server stopped")
+	return nil
+}
+
+// NewHandler serves s as a REST API:
+//
+//	POST   /users
+//	GET    /users/{user}
+//	GET    /users/{user}/folders?sort-name=asc|desc&sort-created=asc|desc
+//	POST   /users/{user}/folders
+//	GET    /users/{user}/folders/{folder}
+//	PATCH  /users/{user}/folders/{folder}
+//	DELETE /users/{user}/folders/{folder}
+//	GET    /users/{user}/folders/{folder}/files?sort-name=asc|desc&sort-created=asc|desc
+//	POST   /users/{user}/folders/{folder}/files
+//	GET    /users/{user}/folders/{folder}/files/{file}
+//	DELETE /users/{user}/folders/{folder}/files/{file}
+//
+// Names keep their case but match case-insensitively, and are checked like
+// the REPL commands do, as ASCII names.
+// Requests time out after timeout, 0 means no limit.
+func NewHandler(s storage.IStorage, timeout time.Duration) http.Handler {
+	return newHandler(s, timeout, naming{})
+}
+
+// newHandler returns the handler checking names by n
+func newHandler(s storage.IStorage, timeout time.Duration, n naming) *handler {
+	return &handler{
+		storage: s,
+		timeout: timeout,
+		naming:  n,
+	}
+}
+
+type handler struct {
+	storage storage.IStorage
+	timeout time.Duration
+	naming  naming
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path, ok := splitPath(req.URL)
+	if !ok || path[0] != "users" || len(path) > 6 || len(path) > 2 && path[2] != "folders" || len(path) > 4 && path[4] != "files" {
+		writeError(w, http.StatusNotFound, CodeNotFound, fmt.Errorf("unrecognized path"))
+		return
+	}
+	ctx := req.Context()
+	traceID := req.Header.Get(TraceIDHeader)
+	if traceID == "" {
+		traceID = newTraceID()
+	}
+	w.Header().Set(TraceIDHeader, traceID)
+	ctx = storage.WithTraceID(ctx, traceID)
+	if len(path) > 1 {
+		ctx = storage.WithActor(ctx, path[1])
+	}
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	req = req.WithContext(ctx)
+
+	var methods []string
+	switch len(path) {
+	case 1:
+		methods = []string{http.MethodGet, http.MethodPost}
+	case 2:
+		methods = []string{http.MethodGet}
+	case 3, 5:
+		methods = []string{http.MethodGet, http.MethodPost}
+	case 4:
+		methods = []string{http.MethodGet, http.MethodPatch, http.MethodDelete}
+	case 6:
+		methods = []string{http.MethodGet, http.MethodDelete}
+	}
+	allowed := false
+	for _, m := range methods {
+		allowed = allowed || req.Method == m
+	}
+	if !allowed {
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, fmt.Errorf("method %s not allowed", req.Method))
+		return
+	}
+
+	switch {
+	case len(path) == 1 && req.Method == http.MethodGet:
+		h.listUsers(w, req)
+	case len(path) == 1:
+		h.addUser(w, req)
+	case len(path) == 2:
+		h.getUser(w, req, path[1])
+	case len(path) == 3 && req.Method == http.MethodGet:
+		h.listFolders(w, req, path[1])
+	case len(path) == 3:
+		h.addFolder(w, req, path[1])
+	case len(path) == 4 && req.Method == http.MethodGet:
+		h.getFolder(w, req, path[1], path[3])
+	case len(path) == 4 && req.Method == http.MethodPatch:
+		h.renameFolder(w, req, path[1], path[3])
+	case len(path) == 4:
+		h.deleteFolder(w, req, path[1], path[3])
+	case len(path) == 5 && req.Method == http.MethodGet:
+		h.listFiles(w, req, path[1], path[3])
+	case len(path) == 5:
+		h.addFile(w, req, path[1], path[3])
+	case len(path) == 6 && req.Method == http.MethodGet:
+		h.getFile(w, req, path[1], path[3], path[5])
+	default:
+		h.deleteFile(w, req, path[1], path[3], path[5])
+	}
+}
+
+func (h *handler) addUser(w http.ResponseWriter, req *http.Request) {
+	body, ok := readBody(w, req)
+	if !ok {
+		return
+	}
+	userName := h.naming.normalize(body.Name)
+	ctx := storage.WithActor(req.Context(), userName)
+	err := h.naming.checkUser(userName)
+	if err == nil {
+		err = h.naming.addSibling(parentKey("", ""), userName, userNames(ctx, h.storage), func() error {
+			return h.storage.AddUser(ctx, userName)
+		})
+	}
+	if err != nil {
+		writeCheckError(w, err, userName, "", "")
+		return
+	}
+	w.Header().Set("Location", resourcePath(userName, "", ""))
+	writeJSON(w, http.StatusCreated, APIUser{UserName: userName})
+}
+
+func (h *handler) listUsers(w http.ResponseWriter, req *http.Request) {
+	userNames, err := h.storage.ListUser(req.Context())
+	if err != nil {
+		writeStorageError(w, err, "", "", "")
+		return
+	}
+	users := make([]APIUser, 0, len(userNames))
+	for _, userName := range userNames {
+		users = append(users, APIUser{UserName: userName})
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+// getUser writes the user with the name as kept
+func (h *handler) getUser(w http.ResponseWriter, req *http.Request, userName string) {
+	name, err := getUser(req.Context(), h.storage, userName)
+	if err != nil {
+		writeStorageError(w, err, userName, "", "")
+		return
+	}
+	writeJSON(w, http.StatusOK, APIUser{UserName: name})
+}
+
+func (h *handler) listFolders(w http.ResponseWriter, req *http.Request, userName string) {
+	sortName, orderBy, err := sortQuery(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, err)
+		return
+	}
+	folders, err := h.storage.ListFolder(req.Context(), userName, sortName, orderBy)
+	if err != nil {
+		writeStorageError(w, err, userName, "", "")
+		return
+	}
+	writeJSON(w, http.StatusOK, folders)
+}
+
+func (h *handler) addFolder(w http.ResponseWriter, req *http.Request, userName string) {
+	body, ok := readBody(w, req)
+	if !ok {
+		return
+	}
+	folderName := h.naming.normalize(body.Name)
+	err := h.naming.checkName(folderName)
+	if err == nil {
+		err = validateDesc(body.Description)
+	}
+	if err == nil {
+		err = h.naming.addSibling(parentKey(userName, ""), folderName, folderNames(req.Context(), h.storage, userName, ""), func() error {
+			return h.storage.AddFolder(req.Context(), userName, folderName, body.Description)
+		})
+	}
+	if err != nil {
+		writeCheckError(w, err, userName, folderName, "")
+		return
+	}
+	w.Header().Set("Location", resourcePath(userName, folderName, ""))
+	h.getFolderStatus(w, req, userName, folderName, http.StatusCreated)
+}
+
+func (h *handler) getFolder(w http.ResponseWriter, req *http.Request, userName, folderName string) {
+	h.getFolderStatus(w, req, userName, folderName, http.StatusOK)
+}
+
+// getFolderStatus writes the folder with status
+func (h *handler) getFolderStatus(w http.ResponseWriter, req *http.Request, userName, folderName string, status int) {
+	folder, err := getFolder(req.Context(), h.storage, userName, folderName)
+	if err != nil {
+		writeStorageError(w, err, userName, folderName, "")
+		return
+	}
+	writeJSON(w, status, folder)
+}
+
+func (h *handler) renameFolder(w http.ResponseWriter, req *http.Request, userName, folderName string) {
+	body, ok := readBody(w, req)
+	if !ok {
+		return
+	}
+	newFolderName := h.naming.normalize(body.Name)
+	err := h.naming.checkName(newFolderName)
+	if err == nil {
+		err = h.naming.addSibling(parentKey(userName, ""), newFolderName, folderNames(req.Context(), h.storage, userName, folderName), func() error {
+			return h.storage.RenameFolder(req.Context(), userName, folderName, newFolderName)
+		})
+	}
+	if errors.Is(err, storage.ErrFolderExists) {
+		writeStorageError(w, err, userName, newFolderName, "")
+		return
+	}
+	if err != nil {
+		writeCheckError(w, err, userName, folderName, "")
+		return
+	}
+	w.Header().Set("Location", resourcePath(userName, newFolderName, ""))
+	h.getFolderStatus(w, req, userName, newFolderName, http.StatusOK)
+}
+
+func (h *handler) deleteFolder(w http.ResponseWriter, req *http.Request, userName, folderName string) {
+	err := h.storage.DeleteFolder(req.Context(), userName, folderName)
+	if err != nil {
+		writeStorageError(w, err, userName, folderName, "")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) listFiles(w http.ResponseWriter, req *http.Request, userName, folderName string) {
+	sortName, orderBy, err := sortQuery(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, err)
+		return
+	}
+	files, err := h.storage.ListFile(req.Context(), userName, folderName, sortName, orderBy)
+	if err != nil {
+		writeStorageError(w, err, userName, folderName, "")
+		return
+	}
+	writeJSON(w, http.StatusOK, files)
+}
+
+func (h *handler) addFile(w http.ResponseWriter, req *http.Request, userName, folderName string) {
+	body, ok := readBody(w, req)
+	if !ok {
+		return
+	}
+	fileName := h.naming.normalize(body.Name)
+	err := h.naming.checkName(fileName)
+	if err == nil {
+		err = validateDesc(body.Description)
+	}
+	if err == nil {
+		err = h.naming.addSibling(parentKey(userName, folderName), fileName, fileNames(req.Context(), h.storage, userName, folderName), func() error {
+			return h.storage.AddFile(req.Context(), userName, folderName, fileName, body.Description)
+		})
+	}
+	if err != nil {
+		writeCheckError(w, err, userName, folderName, fileName)
+		return
+	}
+	w.Header().Set("Location", resourcePath(userName, folderName, fileName))
+	h.getFileStatus(w, req, userName, folderName, fileName, http.StatusCreated)
+}
+
+func (h *handler) getFile(w http.ResponseWriter, req *http.Request, userName, folderName, fileName string) {
+	h.getFileStatus(w, req, userName, folderName, fileName, http.StatusOK)
+}
+
+// getFileStatus writes the file with status
+func (h *handler) getFileStatus(w http.ResponseWriter, req *http.Request, userName, folderName, fileName string, status int) {
+	file, err := getFile(req.Context(), h.storage, userName, folderName, fileName)
+	if err != nil {
+		writeStorageError(w, err, userName, folderName, fileName)
+		return
+	}
+	writeJSON(w, status, file)
+}
+
+// getUser returns the user with the name as kept, looked up directly by a
+// storage.Getter, else found in the list of users
+func getUser(ctx context.Context, s storage.IStorage, userName string) (string, error) {
+	if g, ok := s.(storage.Getter); ok {
+		return g.GetUser(ctx, userName)
+	}
+	userNames, err := s.ListUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	name, ok := keptName(userNames, userName)
+	if !ok {
+		return "", storage.ErrUserNotFound
+	}
+	return name, nil
+}
+
+// getFolder returns the folder, like getUser
+func getFolder(ctx context.Context, s storage.IStorage, userName, folderName string) (storage.VirtualFileSysEntity, error) {
+	if g, ok := s.(storage.Getter); ok {
+		return g.GetFolder(ctx, userName, folderName)
+	}
+	folders, err := s.ListFolder(ctx, userName, "name", "asc")
+	if err != nil {
+		return storage.VirtualFileSysEntity{}, err
+	}
+	for _, folder := range folders {
+		if storage.NameKey(folder.FolderName) == storage.NameKey(folderName) {
+			return folder, nil
+		}
+	}
+	return storage.VirtualFileSysEntity{}, storage.ErrFolderNotFound
+}
+
+// getFile returns the file, like getUser
+func getFile(ctx context.Context, s storage.IStorage, userName, folderName, fileName string) (storage.VirtualFileSysFileEntity, error) {
+	if g, ok := s.(storage.Getter); ok {
+		return g.GetFile(ctx, userName, folderName, fileName)
+	}
+	files, err := s.ListFile(ctx, userName, folderName, "name", "asc")
+	if err != nil {
+		return storage.VirtualFileSysFileEntity{}, err
+	}
+	for _, file := range files {
+		if storage.NameKey(file.FileName) == storage.NameKey(fileName) {
+			return file, nil
+		}
+	}
+	return storage.VirtualFileSysFileEntity{}, storage.ErrFileNotFound
+}
+
+func (h *handler) deleteFile(w http.ResponseWriter, req *http.Request, userName, folderName, fileName string) {
+	err := h.storage.DeleteFile(req.Context(), userName, folderName, fileName)
+	if err != nil {
+		writeStorageError(w, err, userName, folderName, fileName)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// splitPath splits the path into its elements, an escaped slash is kept in
+// its element
+func splitPath(u *url.URL) ([]string, bool) {
+	path := strings.Split(strings.Trim(u.EscapedPath(), "/"), "/")
+	for i, p := range path {
+		p, err := url.PathUnescape(p)
+		if err != nil {
+			return nil, false
+		}
+		path[i] = p
+	}
+	return path, true
+}
+
+// sortQuery reads the sort mode like the flags of list-folders and list-files
+func sortQuery(req *http.Request) (string, string, error) {
+	q := req.URL.Query()
+	sortName, orderBy := "name", "asc"
+	if v := q.Get("sort-created"); v != "" {
+		sortName, orderBy = "create", v
+	} else if v := q.Get("sort-name"); v != "" {
+		orderBy = v
+	}
+	orderBy = strings.ToLower(orderBy)
+	switch orderBy {
+	case "asc", "desc":
+		return sortName, orderBy, nil
+	}
+	return "", "", fmt.Errorf("the [%s] invalid order, use asc or desc", orderBy)
+}
+
+// readBody decodes the request body, writing the error if it can't
+func readBody(w http.ResponseWriter, req *http.Request) (APIRequest, bool) {
+	var body APIRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<20))
+	err := dec.Decode(&body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, fmt.Errorf("invalid request body: %w", err))
+		return body, false
+	}
+	return body, true
+}
+
+// writeCheckError writes err checking a name, a bad request unless it's an
+// error of the storage
+func writeCheckError(w http.ResponseWriter, err error, userName, folderName, fileName string) {
+	var e *policy.Error
+	if errors.As(err, &e) {
+		writeError(w, http.StatusBadRequest, CodeInvalidArgument, err)
+		return
+	}
+	writeStorageError(w, err, userName, folderName, fileName)
+}
+
+// writeStorageError writes err of the storage with its status code and
+// the message the REPL shows for it
+func writeStorageError(w http.ResponseWriter, err error, userName, folderName, fileName string) {
+	status, code := http.StatusInternalServerError, CodeInternal
+	switch {
+	case errors.Is(err, storage.ErrUserNotFound):
+		status, code = http.StatusNotFound, CodeUserNotFound
+	case errors.Is(err, storage.ErrUserExists):
+		status, code = http.StatusConflict, CodeUserExists
+	case errors.Is(err, storage.ErrFolderNotFound):
+		status, code = http.StatusNotFound, CodeFolderNotFound
+	case errors.Is(err, storage.ErrFolderExists):
+		status, code = http.StatusConflict, CodeFolderExists
+	case errors.Is(err, storage.ErrFileNotFound):
+		status, code = http.StatusNotFound, CodeFileNotFound
+	case errors.Is(err, storage.ErrFileExists):
+		status, code = http.StatusConflict, CodeFileExists
+	case errors.Is(err, storage.ErrInvalidName):
+		status, code = http.StatusBadRequest, CodeInvalidName
+	case errors.Is(err, storage.ErrInvalidArgument):
+		status, code = http.StatusBadRequest, CodeInvalidArgument
+	case errors.Is(err, context.Canceled):
+		// the client went away, nobody reads this
+		status, code = http.StatusServiceUnavailable, CodeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		status, code = http.StatusGatewayTimeout, CodeTimeout
+	}
+	writeError(w, status, code, storageError(err, userName, folderName, fileName))
+}
+
+// resourcePath returns the path of a user, or of a folder of it, or of a
+// file in the folder, each name escaped
+func resourcePath(userName, folderName, fileName string) string {
+	path := "/users/" + url.PathEscape(userName)
+	if folderName != "" {
+		path += "/folders/" + url.PathEscape(folderName)
+	}
+	if fileName != "" {
+		path += "/files/" + url.PathEscape(fileName)
+	}
+	return path
+}
+
+func writeError(w http.ResponseWriter, status int, code string, err error) {
+	writeJSON(w, status, APIError{
+		Code:    code,
+		Message: err.Error(),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
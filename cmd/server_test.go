@@ -0,0 +1,339 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/reddtsai/goREPL/pkg/storage"
+	"github.com/reddtsai/goREPL/pkg/storage/mock"
+	"github.com/reddtsai/goREPL/pkg/storage/storagetest"
+)
+
+type TestServer struct {
+	suite.Suite
+
+	storage storage.IStorage
+	srv     *httptest.Server
+}
+
+func TestServerSuite(t *testing.T) {
+	suite.Run(t, new(TestServer))
+}
+
+func (t *TestServer) SetupTest() {
+	t.storage = storage.NewVirtualFileSysStorage()
+	t.srv = httptest.NewServer(NewHandler(t.storage, 0))
+}
+
+func (t *TestServer) TearDownTest() {
+	t.srv.Close()
+}
+
+// Do sends a request with body, if not empty, and returns the status and
+// the response body
+func (t *TestServer) Do(method, path, body string) (int, string) {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, t.srv.URL+path, r)
+	t.Require().NoError(err)
+	resp, err := t.srv.Client().Do(req)
+	t.Require().NoError(err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	t.Require().NoError(err)
+	return resp.StatusCode, string(b)
+}
+
+// DoError sends a request that fails and returns its status and error
+func (t *TestServer) DoError(method, path, body string) (int, APIError) {
+	status, out := t.Do(method, path, body)
+	var apiErr APIError
+	t.Require().NoError(json.Unmarshal([]byte(out), &apiErr), out)
+	return status, apiErr
+}
+
+func (t *TestServer) fill() {
+	ctx := context.Background()
+	t.Require().NoError(t.storage.AddUser(ctx, "test"))
+	t.Require().NoError(t.storage.AddFolder(ctx, "test", "folder1", "desc1"))
+	t.Require().NoError(t.storage.AddFolder(ctx, "test", "folder2", "desc2"))
+	t.Require().NoError(t.storage.AddFile(ctx, "test", "folder1", "file1", "desc3"))
+	t.Require().NoError(t.storage.AddFile(ctx, "test", "folder1", "file2", "desc4"))
+}
+
+func (t *TestServer) TestUser() {
+	status, out := t.Do(http.MethodPost, "/users", `{"name":"Test"}`)
+	t.Equal(http.StatusCreated, status)
+	t.JSONEq(`{"userName":"Test"}`, out)
+	t.True(t.storage.IsExistUser(context.Background(), "test"))
+
+	// the name as kept
+	status, out = t.Do(http.MethodGet, "/users/TEST", "")
+	t.Equal(http.StatusOK, status)
+	t.JSONEq(`{"userName":"Test"}`, out)
+
+	status, apiErr := t.DoError(http.MethodPost, "/users", `{"name":"test"}`)
+	t.Equal(http.StatusConflict, status)
+	t.Equal(APIError{Code: CodeUserExists, Message: "the [test] has already existed"}, apiErr)
+
+	status, apiErr = t.DoError(http.MethodGet, "/users/other", "")
+	t.Equal(http.StatusNotFound, status)
+	t.Equal(APIError{Code: CodeUserNotFound, Message: "the [other] doesn't exist"}, apiErr)
+
+	t.Require().NoError(t.storage.AddUser(context.Background(), "alice"))
+	status, out = t.Do(http.MethodGet, "/users", "")
+	t.Equal(http.StatusOK, status)
+	t.JSONEq(`[{"userName":"alice"},{"userName":"Test"}]`, out)
+}
+
+func (t *TestServer) TestValidation() {
+	t.fill()
+	tests := []struct {
+		method, path, body, message string
+	}{
+		{http.MethodPost, "/users", `{"name":"ab"}`, "the [ab] invalid length"},
+		{http.MethodPost, "/users", `{"name":"a-b-c"}`, "the [a-b-c] contain invalid chars"},
+		{http.MethodPost, "/users/test/folders", `{"name":""}`, "the [] invalid length"},
+		{http.MethodPost, "/users/test/folders", `{"name":"a b"}`, "the [a b] contain invalid chars"},
+		{http.MethodPost, "/users/test/folders", `{"name":"a","description":"` + strings.Repeat("x", 501) + `"}`, "the [description] invalid length"},
+		{http.MethodPatch, "/users/test/folders/folder1", `{"name":"a/b"}`, "the [a/b] contain invalid chars"},
+		{http.MethodPost, "/users/test/folders/folder1/files", `{"name":"` + strings.Repeat("x", 101) + `"}`, "the [" + strings.Repeat("x", 101) + "] invalid length"},
+		{http.MethodPost, "/users/test/folders/folder1/files", `{"name":"a?"}`, "the [a?] contain invalid chars"},
+		{http.MethodGet, "/users/test/folders?sort-name=up", "", "the [up] invalid order, use asc or desc"},
+		{http.MethodGet, "/users/test/folders/folder1/files?sort-created=up", "", "the [up] invalid order, use asc or desc"},
+	}
+	for _, tt := range tests {
+		status, apiErr := t.DoError(tt.method, tt.path, tt.body)
+		t.Equal(http.StatusBadRequest, status, tt.path)
+		t.Equal(APIError{Code: CodeInvalidArgument, Message: tt.message}, apiErr, tt.path)
+	}
+
+	status, apiErr := t.DoError(http.MethodPost, "/users", `{"name":`)
+	t.Equal(http.StatusBadRequest, status)
+	t.Equal(CodeInvalidArgument, apiErr.Code)
+	t.Contains(apiErr.Message, "invalid request body")
+}
+
+func (t *TestServer) TestFolder() {
+	t.fill()
+	status, out := t.Do(http.MethodPost, "/users/test/folders", `{"name":"Folder3","description":"desc"}`)
+	t.Equal(http.StatusCreated, status)
+	var folder storage.VirtualFileSysEntity
+	t.Require().NoError(json.Unmarshal([]byte(out), &folder))
+	t.Equal("Folder3", folder.FolderName)
+	t.Equal("desc", folder.FolderDesc)
+	t.Equal("test", folder.UserName)
+	t.NotZero(folder.FolderCreateTime)
+
+	status, out = t.Do(http.MethodGet, "/users/test/folders/FOLDER3", "")
+	t.Equal(http.StatusOK, status)
+	var got storage.VirtualFileSysEntity
+	t.Require().NoError(json.Unmarshal([]byte(out), &got))
+	t.Equal(folder, got)
+
+	status, out = t.Do(http.MethodPatch, "/users/test/folders/folder3", `{"name":"folder4"}`)
+	t.Equal(http.StatusOK, status)
+	t.Require().NoError(json.Unmarshal([]byte(out), &got))
+	t.Equal("folder4", got.FolderName)
+	t.Equal("desc", got.FolderDesc)
+
+	status, out = t.Do(http.MethodDelete, "/users/test/folders/folder4", "")
+	t.Equal(http.StatusNoContent, status)
+	t.Empty(out)
+	t.False(t.storage.IsExistFolder(context.Background(), "test", "folder4"))
+}
+
+func (t *TestServer) TestFolderError() {
+	t.fill()
+	tests := []struct {
+		method, path, body string
+		status             int
+		apiErr             APIError
+	}{
+		{http.MethodPost, "/users/other/folders", `{"name":"folder1"}`, http.StatusNotFound, APIError{CodeUserNotFound, "the [other] doesn't exist"}},
+		{http.MethodPost, "/users/test/folders", `{"name":"folder1"}`, http.StatusConflict, APIError{CodeFolderExists, "the [folder1] has already existed"}},
+		{http.MethodGet, "/users/test/folders/folder3", "", http.StatusNotFound, APIError{CodeFolderNotFound, "the [folder3] doesn't exist"}},
+		{http.MethodPatch, "/users/test/folders/folder3", `{"name":"folder4"}`, http.StatusNotFound, APIError{CodeFolderNotFound, "the [folder3] doesn't exist"}},
+		{http.MethodPatch, "/users/test/folders/folder1", `{"name":"folder2"}`, http.StatusConflict, APIError{CodeFolderExists, "the [folder2] has already existed"}},
+		{http.MethodDelete, "/users/test/folders/folder3", "", http.StatusNotFound, APIError{CodeFolderNotFound, "the [folder3] doesn't exist"}},
+		{http.MethodGet, "/users/other/folders", "", http.StatusNotFound, APIError{CodeUserNotFound, "the [other] doesn't exist"}},
+	}
+	for _, tt := range tests {
+		status, apiErr := t.DoError(tt.method, tt.path, tt.body)
+		t.Equal(tt.status, status, tt.method+" "+tt.path)
+		t.Equal(tt.apiErr, apiErr, tt.method+" "+tt.path)
+	}
+}
+
+func (t *TestServer) TestListFolders() {
+	t.fill()
+	names := func(query string) []string {
+		status, out := t.Do(http.MethodGet, "/users/test/folders"+query, "")
+		t.Require().Equal(http.StatusOK, status, out)
+		var folders []storage.VirtualFileSysEntity
+		t.Require().NoError(json.Unmarshal([]byte(out), &folders))
+		names := []string{}
+		for _, folder := range folders {
+			names = append(names, folder.FolderName)
+		}
+		return names
+	}
+	t.Equal([]string{"folder1", "folder2"}, names(""))
+	t.Equal([]string{"folder2", "folder1"}, names("?sort-name=DESC"))
+	t.Equal([]string{"folder1", "folder2"}, names("?sort-created=asc"))
+	t.Equal([]string{"folder2", "folder1"}, names("?sort-created=desc&sort-name=asc"))
+
+	t.Require().NoError(t.storage.AddUser(context.Background(), "empty"))
+	status, out := t.Do(http.MethodGet, "/users/empty/folders", "")
+	t.Equal(http.StatusOK, status)
+	t.JSONEq(`[]`, out)
+}
+
+func (t *TestServer) TestFile() {
+	t.fill()
+	status, out := t.Do(http.MethodPost, "/users/test/folders/folder1/files", `{"name":"File3","description":"desc"}`)
+	t.Equal(http.StatusCreated, status)
+	var file storage.VirtualFileSysFileEntity
+	t.Require().NoError(json.Unmarshal([]byte(out), &file))
+	t.Equal("File3", file.FileName)
+	t.Equal("desc", file.FileDesc)
+
+	status, out = t.Do(http.MethodGet, "/users/test/folders/folder1/files/FILE3", "")
+	t.Equal(http.StatusOK, status)
+	var got storage.VirtualFileSysFileEntity
+	t.Require().NoError(json.Unmarshal([]byte(out), &got))
+	t.Equal(file, got)
+
+	status, out = t.Do(http.MethodGet, "/users/test/folders/folder1/files?sort-name=desc", "")
+	t.Equal(http.StatusOK, status)
+	var files []storage.VirtualFileSysFileEntity
+	t.Require().NoError(json.Unmarshal([]byte(out), &files))
+	t.Require().Len(files, 3)
+	t.Equal("File3", files[0].FileName)
+
+	status, _ = t.Do(http.MethodDelete, "/users/test/folders/folder1/files/file3", "")
+	t.Equal(http.StatusNoContent, status)
+	t.False(t.storage.IsExistFile(context.Background(), "test", "folder1", "file3"))
+}
+
+func (t *TestServer) TestFileError() {
+	t.fill()
+	tests := []struct {
+		method, path, body string
+		status             int
+		apiErr             APIError
+	}{
+		{http.MethodPost, "/users/other/folders/folder1/files", `{"name":"file1"}`, http.StatusNotFound, APIError{CodeUserNotFound, "the [other] doesn't exist"}},
+		{http.MethodPost, "/users/test/folders/folder3/files", `{"name":"file1"}`, http.StatusNotFound, APIError{CodeFolderNotFound, "the [folder3] doesn't exist"}},
+		{http.MethodPost, "/users/test/folders/folder1/files", `{"name":"file1"}`, http.StatusConflict, APIError{CodeFileExists, "the [file1] has already existed"}},
+		{http.MethodGet, "/users/test/folders/folder1/files/file3", "", http.StatusNotFound, APIError{CodeFileNotFound, "the [file3] doesn't exist"}},
+		{http.MethodDelete, "/users/test/folders/folder1/files/file3", "", http.StatusNotFound, APIError{CodeFileNotFound, "the [file3] doesn't exist"}},
+		{http.MethodGet, "/users/test/folders/folder3/files", "", http.StatusNotFound, APIError{CodeFolderNotFound, "the [folder3] doesn't exist"}},
+	}
+	for _, tt := range tests {
+		status, apiErr := t.DoError(tt.method, tt.path, tt.body)
+		t.Equal(tt.status, status, tt.method+" "+tt.path)
+		t.Equal(tt.apiErr, apiErr, tt.method+" "+tt.path)
+	}
+}
+
+func (t *TestServer) TestRouting() {
+	for _, path := range []string{"/", "/files", "/users/test/files", "/users/test/folders/folder1/folders", "/users/test/folders/folder1/files/file1/x"} {
+		status, apiErr := t.DoError(http.MethodGet, path, "")
+		t.Equal(http.StatusNotFound, status, path)
+		t.Equal(CodeNotFound, apiErr.Code, path)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, t.srv.URL+"/users/test/folders/folder1", nil)
+	t.Require().NoError(err)
+	resp, err := t.srv.Client().Do(req)
+	t.Require().NoError(err)
+	resp.Body.Close()
+	t.Equal(http.StatusMethodNotAllowed, resp.StatusCode)
+	t.Equal("GET, PATCH, DELETE", resp.Header.Get("Allow"))
+}
+
+func (t *TestServer) TestTraceID() {
+	ctrl := gomock.NewController(t.T())
+	mockStorage := mock.NewMockIStorage(ctrl)
+	srv := httptest.NewServer(NewHandler(mockStorage, 0))
+	defer srv.Close()
+
+	mockStorage.EXPECT().AddUser(gomock.Any(), "test").DoAndReturn(func(ctx context.Context, userName string) error {
+		t.Equal("trace", storage.TraceIDFromContext(ctx))
+		t.Equal("test", storage.ActorFromContext(ctx))
+		return nil
+	})
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/users", strings.NewReader(`{"name":"test"}`))
+	t.Require().NoError(err)
+	req.Header.Set(TraceIDHeader, "trace")
+	resp, err := srv.Client().Do(req)
+	t.Require().NoError(err)
+	resp.Body.Close()
+	t.Equal(http.StatusCreated, resp.StatusCode)
+	t.Equal("trace", resp.Header.Get(TraceIDHeader))
+}
+
+func (t *TestServer) TestTimeout() {
+	ctrl := gomock.NewController(t.T())
+	mockStorage := mock.NewMockIStorage(ctrl)
+	t.srv.Close()
+	t.srv = httptest.NewServer(NewHandler(mockStorage, 10*time.Millisecond))
+
+	mockStorage.EXPECT().DeleteFolder(gomock.Any(), "test", "folder1").DoAndReturn(func(ctx context.Context, userName, folderName string) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	status, apiErr := t.DoError(http.MethodDelete, "/users/test/folders/folder1", "")
+	t.Equal(http.StatusGatewayTimeout, status)
+	t.Equal(APIError{CodeTimeout, "the command timed out"}, apiErr)
+}
+
+func (t *TestServer) TestServeCmd() {
+	repl := &Repl{
+		storage: t.storage,
+		rootCmd: &cobra.Command{Use: "repl"},
+	}
+	repl.AddServeCmd()
+	var out bytes.Buffer
+	repl.rootCmd.SetOut(&out)
+	repl.rootCmd.SetErr(io.Discard)
+	repl.rootCmd.SetArgs([]string{"serve", "--addr", "127.0.0.1:0"})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	t.NoError(repl.ExecuteContext(ctx))
+	t.Contains(out.String(), "Serving on 127.0.0.1:")
+	t.Contains(out.String(), "Server stopped\n")
+
+	repl.rootCmd.SetArgs([]string{"serve", "--addr", "256.0.0.1:0"})
+	t.Error(repl.ExecuteContext(context.Background()))
+}
+
+func TestRemoteStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.IStorage {
+		// the names of any script go through
+		srv := httptest.NewServer(newHandler(storage.NewVirtualFileSysStorage(), 0, naming{unicode: true}))
+		t.Cleanup(srv.Close)
+		s, err := storage.NewRemoteStorage(srv.URL, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			s.(io.Closer).Close()
+		})
+		return s
+	})
+}
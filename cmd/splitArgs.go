@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var (
+	errUnterminatedQuote = errors.New("unterminated quote")
+	// errLineContinued is returned for a line ending with a backslash, to
+	// be read again with the next line after a newline
+	errLineContinued = errors.New("the line continues past the end of the input")
+)
+
+// SplitArgs splits line into arguments like a shell does. Single quotes
+// keep everything in them, double quotes all but \" and \\, and a
+// backslash outside of quotes keeps the char after it. Empty quotes are empty
+// arguments. A backslash before a newline joins the lines.
+func (r *Repl) SplitArgs(line string) ([]string, error) {
+	var (
+		args []string
+		arg  strings.Builder
+		// inArg tells an empty quoted argument from none
+		inArg bool
+		quote rune
+	)
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\\':
+			if i+1 == len(runes) {
+				return nil, errLineContinued
+			}
+			next := runes[i+1]
+			switch {
+			case next == '\n':
+				// joins the lines
+			case quote == '"' && next != '"' && next != '\\':
+				arg.WriteRune(c)
+				arg.WriteRune(next)
+			default:
+				arg.WriteRune(next)
+			}
+			i++
+			inArg = inArg || next != '\n'
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case unicode.IsSpace(c):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("%w, missing the closing %c", errUnterminatedQuote, quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/reddtsai/goREPL/pkg/storage"
+)
+
+var errNoUserInUse = errors.New("no user is in use, run use [username] first")
+
+// contextArgs tells, for the commands taking names, how many of the leading
+// arguments the working context can fill in, the user or the user and the
+// folder, and how many arguments their full form takes
+var contextArgs = map[string]struct{ depth, min, max int }{
+	"create-folder": {1, 2, 3},
+	"delete-folder": {1, 2, 2},
+	"list-folders":  {1, 1, 1},
+	"rename-folder": {1, 3, 3},
+	"create-file":   {2, 3, 4},
+	"delete-file":   {2, 3, 3},
+	"list-files":    {2, 2, 2},
+}
+
+// fillContext returns the names of the working context to put before the n
+// arguments given to the command name. Arguments making a full form already
+// are taken as they are, otherwise as much of the context as fits is used.
+func (r *Repl) fillContext(name string, n int) []string {
+	c, ok := contextArgs[name]
+	if !ok || n >= c.min || r.user == "" {
+		return nil
+	}
+	names := []string{r.user}
+	if r.folder != "" {
+		names = append(names, r.folder)
+	}
+	for k := min(c.depth, len(names)); k > 0; k-- {
+		if n+k >= c.min && n+k <= c.max {
+			return names[:k]
+		}
+	}
+	return nil
+}
+
+// inUse tells whether the folder of the user is the one in use
+func (r *Repl) inUse(userName, folderName string) bool {
+	return r.folder != "" &&
+		storage.NameKey(userName) == storage.NameKey(r.user) &&
+		storage.NameKey(folderName) == storage.NameKey(r.folder)
+}
+
+// keptName returns the one of names, as a storage keeps them, that name
+// stands for
+func keptName(names []string, name string) (string, bool) {
+	for _, n := range names {
+		if storage.NameKey(n) == storage.NameKey(name) {
+			return n, true
+		}
+	}
+	return "", false
+}
+
+// pwd returns the working context as a path
+func (r *Repl) pwd() string {
+	switch {
+	case r.user == "":
+		return "/"
+	case r.folder == "":
+		return "/" + r.user
+	}
+	return "/" + r.user + "/" + r.folder
+}
+
+// prompt returns the prompt of the interactive loop, the prompt setting
+// with the working context in place of its placeholders
+func (r *Repl) prompt() string {
+	context := ""
+	if r.user != "" {
+		context = r.pwd() + " "
+	}
+	return strings.NewReplacer(
+		"{context}", context,
+		"{pwd}", r.pwd(),
+		"{user}", r.user,
+		"{folder}", r.folder,
+	).Replace(r.setting("prompt"))
+}
+
+func (r *Repl) AddUseCmd() {
+	cmd := &cobra.Command{
+		Use:               "use",
+		Short:             "work as a user",
+		Args:              r.UseValidation,
+		RunE:              r.UseRunner,
+		ValidArgsFunction: r.completeNames(1),
+	}
+	cmd.SetUsageTemplate("Usage:\n  use [username]")
+
+	r.addCommand(cmd, (*Repl).AddUseCmd)
+}
+
+func (r *Repl) UseValidation(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	if len(args) != 1 {
+		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
+	}
+
+	return nil
+}
+
+// UseRunner works as a user, kept in the case the storage keeps the name
+func (r *Repl) UseRunner(cmd *cobra.Command, args []string) error {
+	users, err := r.store().ListUser(cmd.Context())
+	if err != nil {
+		return storageError(err, args[0], "", "")
+	}
+	userName, ok := keptName(users, args[0])
+	if !ok {
+		return storageError(storage.ErrUserNotFound, args[0], "", "")
+	}
+	r.user, r.folder = userName, ""
+	fmt.Fprintf(cmd.OutOrStdout(), "Use [%s] successfully\n", userName)
+	return nil
+}
+
+func (r *Repl) AddCdCmd() {
+	cmd := &cobra.Command{
+		Use:               "cd",
+		Short:             "work in a folder of the user in use",
+		Args:              r.CdValidation,
+		RunE:              r.CdRunner,
+		ValidArgsFunction: r.completeFolders,
+	}
+	cmd.SetUsageTemplate("Usage:\n  cd [foldername|..]?")
+
+	r.addCommand(cmd, (*Repl).AddCdCmd)
+}
+
+func (r *Repl) CdValidation(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	if len(args) > 1 {
+		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
+	}
+
+	return nil
+}
+
+// CdRunner changes to a folder of the user in use, cd alone or cd .. leaves
+// the folder and cd . stays in it. Folders named . or .. are only reached
+// with the commands taking the folder.
+func (r *Repl) CdRunner(cmd *cobra.Command, args []string) error {
+	if r.user == "" {
+		return errNoUserInUse
+	}
+	if len(args) == 0 || args[0] == ".." || args[0] == "/" {
+		r.folder = ""
+		return nil
+	}
+	if args[0] == "." {
+		return nil
+	}
+	folders, err := r.store().ListFolder(cmd.Context(), r.user, "name", "asc")
+	if err != nil {
+		return storageError(err, r.user, args[0], "")
+	}
+	names := make([]string, 0, len(folders))
+	for _, f := range folders {
+		names = append(names, f.FolderName)
+	}
+	folderName, ok := keptName(names, args[0])
+	if !ok {
+		return storageError(storage.ErrFolderNotFound, r.user, args[0], "")
+	}
+	r.folder = folderName
+	return nil
+}
+
+// completeFolders completes the folders of the user in use
+func (r *Repl) completeFolders(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if r.user == "" || len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return r.completeNames(2)(cmd, []string{r.user}, toComplete)
+}
+
+func (r *Repl) AddPwdCmd() {
+	cmd := &cobra.Command{
+		Use:   "pwd",
+		Short: "print the user and the folder in use",
+		Args:  r.PwdValidation,
+		RunE:  r.PwdRunner,
+	}
+	cmd.SetUsageTemplate("Usage:\n  pwd")
+
+	r.addCommand(cmd, (*Repl).AddPwdCmd)
+}
+
+func (r *Repl) PwdValidation(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	if len(args) != 0 {
+		return fmt.Errorf("unrecognized argument\n%s", cmd.UsageString())
+	}
+
+	return nil
+}
+
+func (r *Repl) PwdRunner(cmd *cobra.Command, args []string) error {
+	fmt.Fprintln(cmd.OutOrStdout(), r.pwd())
+	return nil
+}
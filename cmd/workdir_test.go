@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/reddtsai/goREPL/pkg/storage"
+)
+
+type TestWorkdir struct {
+	suite.Suite
+
+	repl    *Repl
+	storage storage.IStorage
+}
+
+func TestWorkdirSuite(t *testing.T) {
+	suite.Run(t, new(TestWorkdir))
+}
+
+func (t *TestWorkdir) SetupTest() {
+	t.storage = storage.NewVirtualFileSysStorage()
+	ctx := context.Background()
+	t.Require().NoError(t.storage.AddUser(ctx, "alice"))
+	t.Require().NoError(t.storage.AddUser(ctx, "bob"))
+	t.Require().NoError(t.storage.AddFolder(ctx, "alice", "docs", ""))
+	t.repl = &Repl{
+		storage: t.storage,
+		rootCmd: &cobra.Command{Use: "repl"},
+	}
+	t.repl.AddCreateFolderCmd()
+	t.repl.AddDeleteFolderCmd()
+	t.repl.AddListFoldersCmd()
+	t.repl.AddRenameFolderCmd()
+	t.repl.AddCreateFileCmd()
+	t.repl.AddDeleteFileCmd()
+	t.repl.AddListFilesCmd()
+	t.repl.AddUseCmd()
+	t.repl.AddCdCmd()
+	t.repl.AddPwdCmd()
+}
+
+// run feeds input to a session and returns what it printed
+func (t *TestWorkdir) run(input string) string {
+	var out bytes.Buffer
+	err := t.repl.Run(context.Background(), strings.NewReader(input), &out, &out)
+	t.Require().NoError(err)
+	return out.String()
+}
+
+func (t *TestWorkdir) TestUseCd() {
+	out := t.run("pwd\ncd docs\nuse carol\nuse ALICE\npwd\ncd other\ncd Docs\npwd\ncd ..\npwd\ncd docs\nuse bob\npwd\n")
+	t.Contains(out, "# /\n")
+	t.Contains(out, "# Error: no user is in use, run use [username] first\n")
+	t.Contains(out, "# Error: the [carol] doesn't exist\n")
+	t.Contains(out, "# Use [alice] successfully\n/alice # /alice\n")
+	t.Contains(out, "/alice # Error: the [other] doesn't exist\n")
+	t.Contains(out, "/alice # /alice/docs # /alice/docs\n")
+	t.Contains(out, "/alice/docs # /alice # /alice\n")
+	// another user leaves the folder
+	t.Contains(out, "/alice/docs # Use [bob] successfully\n/bob # /bob\n")
+}
+
+func (t *TestWorkdir) TestDotNames() {
+	out := t.run("create-folder alice ..\ncreate-file alice .. .\nuse alice\ncd docs\ncd .\npwd\ncd ..\npwd\n")
+	t.Contains(out, "Create [..] successfully\n")
+	t.Contains(out, "Create [.] in [alice]/[..] successfully\n")
+	// cd takes them as the folders in use
+	t.Contains(out, "/alice/docs # /alice/docs # /alice/docs\n")
+	t.Contains(out, "/alice/docs # /alice # /alice\n")
+}
+
+func (t *TestWorkdir) TestShortForms() {
+	out := t.run("use alice\ncreate-folder work\nlist-folders\ncd work\ncreate-file report\ncreate-file notes 'my notes'\n" +
+		"list-files --sort-name desc\ndelete-file report\nlist-files docs\ncreate-file docs todo\ncreate-file alice docs todo\ncreate-folder bob extra\n")
+	t.Contains(out, "Create [work] successfully\n")
+	t.Contains(out, "docs  ")
+	t.Contains(out, "Create [report] in [alice]/[work] successfully\n")
+	t.Contains(out, "Create [notes] in [alice]/[work] successfully\n")
+	t.Contains(out, "report  ")
+	t.Contains(out, "notes my notes ")
+	t.Less(strings.Index(out, "report  "), strings.Index(out, "notes my notes "))
+	t.Contains(out, "Delete [report] in [alice]/[work] successfully\n")
+	t.Contains(out, "Warning: the [docs] is empty\n")
+	// the folder in use is filled in first
+	t.Contains(out, "Create [docs] in [alice]/[work] successfully\n")
+	t.Contains(out, "Create [todo] in [alice]/[docs] successfully\n")
+	// the full forms are taken as they are
+	t.Contains(out, "Create [extra] successfully\n")
+	t.True(t.storage.IsExistFolder(context.Background(), "bob", "extra"))
+	t.False(t.storage.IsExistFolder(context.Background(), "alice", "bob"))
+}
+
+func (t *TestWorkdir) TestFullForms() {
+	out := t.run("use alice\ncreate-folder typo docs\ncreate-file typo docs f1\ncd docs\ncreate-file docs\ncreate-file docs notes\n")
+	// a mistyped user isn't taken as a folder
+	t.Contains(out, "/alice # Error: the [typo] doesn't exist\n/alice # Error: the [typo] doesn't exist\n")
+	t.False(t.storage.IsExistFolder(context.Background(), "alice", "typo"))
+	// a file named like a folder is a file, told by the count alone
+	t.Contains(out, "/alice/docs # Create [docs] in [alice]/[docs] successfully\n")
+	t.Contains(out, "/alice/docs # Error: the [docs] has already existed\n")
+}
+
+func (t *TestWorkdir) TestFolderChanged() {
+	out := t.run("use alice\ncd docs\nrename-folder docs papers\npwd\ndelete-folder papers\npwd\n")
+	t.Contains(out, "Rename [docs] to [papers] successfully\n/alice/papers # /alice/papers\n")
+	t.Contains(out, "Delete [papers] successfully\n/alice # /alice\n")
+}
+
+func (t *TestWorkdir) TestKeepCase() {
+	out := t.run("create-folder ALICE MyProject\nlist-folders alice\nuse Alice\ncd myproject\npwd\n" +
+		"rename-folder myproject MYPROJECT\npwd\nrename-folder MYPROJECT MYPROJECT\ncreate-folder myPROJECT\n")
+	t.Contains(out, "# Create [MyProject] successfully\n")
+	t.Contains(out, "\nMyProject  ")
+	// the names in use are the ones kept
+	t.Contains(out, "# Use [alice] successfully\n/alice # /alice/MyProject # /alice/MyProject\n")
+	t.Contains(out, "Rename [myproject] to [MYPROJECT] successfully\n/alice/MYPROJECT # /alice/MYPROJECT\n")
+	t.Contains(out, "# Error: the [MYPROJECT] has already existed\n")
+	t.Contains(out, "# Error: the [myPROJECT] has already existed\n")
+}
+
+func (t *TestWorkdir) TestFillContext() {
+	t.Nil(t.repl.fillContext("create-file", 1))
+	t.repl.user = "alice"
+	t.Equal([]string{"alice"}, t.repl.fillContext("list-folders", 0))
+	t.Equal([]string{"alice"}, t.repl.fillContext("create-file", 2))
+	t.Nil(t.repl.fillContext("create-file", 1))
+	t.repl.folder = "docs"
+	t.Equal([]string{"alice", "docs"}, t.repl.fillContext("create-file", 1))
+	t.Equal([]string{"alice", "docs"}, t.repl.fillContext("create-file", 2))
+	t.Equal([]string{"alice"}, t.repl.fillContext("list-files", 1))
+	t.Equal([]string{"alice"}, t.repl.fillContext("create-folder", 1))
+	t.Nil(t.repl.fillContext("create-file", 3))
+	t.Nil(t.repl.fillContext("pwd", 0))
+}
+
+func (t *TestWorkdir) TestComplete() {
+	ctx := context.Background()
+	t.Require().NoError(t.storage.AddFile(ctx, "alice", "docs", "notes", ""))
+	t.Nil(t.repl.Complete(ctx, "cd "))
+	t.repl.user = "alice"
+	t.Equal([]string{"docs"}, t.repl.Complete(ctx, "cd "))
+	t.Equal([]string{"docs"}, t.repl.Complete(ctx, "list-files "))
+	t.repl.folder = "docs"
+	t.Equal([]string{"notes"}, t.repl.Complete(ctx, "delete-file "))
+	t.Equal([]string{"alice", "bob"}, t.repl.Complete(ctx, "use "))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/reddtsai/goREPL/cmd"
 )
@@ -16,9 +17,29 @@ func main() {
 	repl.AddCreateFileCmd()   // 6
 	repl.AddDeleteFileCmd()   // 7
 	repl.AddListFilesCmd()    // 8
+	repl.AddBeginCmd()        // 9
+	repl.AddCommitCmd()       // 10
+	repl.AddRollbackCmd()     // 11
+	repl.AddServeCmd()        // 12
+	repl.AddListenCmd()       // 13
+	repl.AddHistoryCmd()      // 14
+	repl.AddUseCmd()          // 15
+	repl.AddCdCmd()           // 16
+	repl.AddPwdCmd()          // 17
+	repl.AddAliasCmd()        // 18
+	repl.AddUnaliasCmd()      // 19
+	repl.AddMacroCmd()        // 20
+	repl.AddMacrosCmd()       // 21
+	repl.AddUnmacroCmd()      // 22
+	repl.AddConfigCmd()       // 23
 
 	err := repl.Execute()
+	if cerr := repl.Close(); cerr != nil {
+		log.Println(cerr)
+		err = cerr
+	}
+	// the error of a command is printed already
 	if err != nil {
-		log.Fatalln(err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,440 @@
+// Package lineedit reads lines from a terminal with the usual editing keys,
+// using only termios, and keeps their history.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupt is returned by ReadLine for Ctrl-C
+var ErrInterrupt = errors.New("interrupted")
+
+const (
+	ctrlA     = 0x01
+	ctrlB     = 0x02
+	ctrlC     = 0x03
+	ctrlD     = 0x04
+	ctrlE     = 0x05
+	ctrlF     = 0x06
+	ctrlG     = 0x07
+	ctrlH     = 0x08
+	ctrlI     = 0x09
+	ctrlJ     = 0x0a
+	ctrlK     = 0x0b
+	ctrlL     = 0x0c
+	ctrlM     = 0x0d
+	ctrlN     = 0x0e
+	ctrlP     = 0x10
+	ctrlR     = 0x12
+	ctrlU     = 0x15
+	ctrlW     = 0x17
+	ctrlY     = 0x19
+	esc       = 0x1b
+	backspace = 0x7f
+)
+
+// the keys sent as escape sequences
+const (
+	keyUp rune = -(iota + 1)
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDelete
+	keyWordLeft
+	keyWordRight
+	keyUnknown
+)
+
+// Completer returns the words the word before the cursor can be completed
+// to, given the line up to the cursor
+type Completer func(line string) []string
+
+// Editor reads lines from in, a terminal, writing the prompt and the line
+// being edited to out. Any other in is read line by line.
+type Editor struct {
+	in       *bufio.Reader
+	fd       int
+	out      io.Writer
+	history  *History
+	complete Completer
+
+	prompt string
+	// buf is the line being edited, pos the cursor in it
+	buf []rune
+	pos int
+	// histPos is the history entry shown, Len() for the new line, saved
+	// in the meantime
+	histPos int
+	saved   []rune
+	// yanked is the text killed last
+	yanked []rune
+}
+
+// New returns an Editor browsing history, a new one if nil
+func New(in io.Reader, out io.Writer, history *History) *Editor {
+	if history == nil {
+		history = NewHistory(0)
+	}
+	fd := -1
+	if f, ok := in.(*os.File); ok && isTerminal(int(f.Fd())) {
+		fd = int(f.Fd())
+	}
+	return &Editor{
+		in:      bufio.NewReader(in),
+		fd:      fd,
+		out:     out,
+		history: history,
+	}
+}
+
+// SetCompleter makes Tab complete the word before the cursor with c
+func (e *Editor) SetCompleter(c Completer) {
+	e.complete = c
+}
+
+// IsTerminal reports whether in is a terminal the lines can be edited on
+func IsTerminal(in io.Reader) bool {
+	f, ok := in.(*os.File)
+	return ok && isTerminal(int(f.Fd()))
+}
+
+// ReadLine writes prompt and returns the line read, without the newline.
+// It returns ErrInterrupt for Ctrl-C, and io.EOF for Ctrl-D on an empty line
+// or at the end of in.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if e.fd >= 0 {
+		restore, err := makeRaw(e.fd)
+		if err == nil {
+			defer restore()
+			return e.edit(prompt)
+		}
+	}
+	fmt.Fprint(e.out, prompt)
+	line, err := e.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+// edit reads the keys of a line until Enter
+func (e *Editor) edit(prompt string) (string, error) {
+	e.prompt = prompt
+	e.buf, e.pos = nil, 0
+	e.histPos, e.saved = e.history.Len(), nil
+	e.refresh()
+
+	// next is the key ending a search, handled as any other
+	var next rune
+	for {
+		k := next
+		next = 0
+		if k == 0 {
+			var err error
+			k, err = e.readKey()
+			if err != nil {
+				return "", err
+			}
+		}
+		switch k {
+		case ctrlM, ctrlJ:
+			fmt.Fprint(e.out, "\r\n")
+			return string(e.buf), nil
+		case ctrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", ErrInterrupt
+		case ctrlD:
+			if len(e.buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.delete(e.pos, e.pos+1)
+		case ctrlA, keyHome:
+			e.pos = 0
+		case ctrlE, keyEnd:
+			e.pos = len(e.buf)
+		case ctrlB, keyLeft:
+			e.pos = max(e.pos-1, 0)
+		case ctrlF, keyRight:
+			e.pos = min(e.pos+1, len(e.buf))
+		case keyWordLeft:
+			e.pos = e.wordStart()
+		case keyWordRight:
+			e.pos = e.wordEnd()
+		case ctrlH, backspace:
+			if e.pos > 0 {
+				e.delete(e.pos-1, e.pos)
+			}
+		case keyDelete:
+			e.delete(e.pos, e.pos+1)
+		case ctrlK:
+			e.kill(e.pos, len(e.buf))
+		case ctrlU:
+			e.kill(0, e.pos)
+		case ctrlW:
+			e.kill(e.wordStart(), e.pos)
+		case ctrlY:
+			e.insert(e.yanked...)
+		case ctrlP, keyUp:
+			e.browse(e.histPos - 1)
+		case ctrlN, keyDown:
+			e.browse(e.histPos + 1)
+		case ctrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case ctrlI:
+			e.completeWord()
+		case ctrlR:
+			var err error
+			next, err = e.search()
+			if err != nil {
+				return "", err
+			}
+		default:
+			if k > 0 && unicode.IsPrint(k) {
+				e.insert(k)
+			}
+		}
+		e.refresh()
+	}
+}
+
+// readKey reads a key, the escape sequences of the arrows and the like are
+// returned as a single key
+func (e *Editor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != esc {
+		return r, err
+	}
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	switch r {
+	case 'b':
+		return keyWordLeft, nil
+	case 'f':
+		return keyWordRight, nil
+	case '[', 'O':
+	default:
+		return keyUnknown, nil
+	}
+	// parameters up to the final byte, e.g. 3~ or 1;5C
+	var seq strings.Builder
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		seq.WriteRune(r)
+		if r >= 0x40 && r <= 0x7e {
+			break
+		}
+	}
+	switch seq.String() {
+	case "A":
+		return keyUp, nil
+	case "B":
+		return keyDown, nil
+	case "C":
+		return keyRight, nil
+	case "D":
+		return keyLeft, nil
+	case "H", "1~", "7~":
+		return keyHome, nil
+	case "F", "4~", "8~":
+		return keyEnd, nil
+	case "3~":
+		return keyDelete, nil
+	case "1;5C", "1;3C":
+		return keyWordRight, nil
+	case "1;5D", "1;3D":
+		return keyWordLeft, nil
+	}
+	return keyUnknown, nil
+}
+
+// refresh draws the prompt and the line again, with the cursor at pos
+func (e *Editor) refresh() {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.prompt, string(e.buf))
+	if n := len(e.buf) - e.pos; n > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", n)
+	}
+}
+
+func (e *Editor) insert(rs ...rune) {
+	buf := make([]rune, 0, len(e.buf)+len(rs))
+	buf = append(buf, e.buf[:e.pos]...)
+	buf = append(buf, rs...)
+	e.buf = append(buf, e.buf[e.pos:]...)
+	e.pos += len(rs)
+}
+
+// delete removes buf[from:to], to is cut to the end of buf
+func (e *Editor) delete(from, to int) {
+	to = min(to, len(e.buf))
+	if from >= to {
+		return
+	}
+	e.buf = append(e.buf[:from:from], e.buf[to:]...)
+	e.pos = from
+}
+
+// kill deletes buf[from:to], to be yanked back
+func (e *Editor) kill(from, to int) {
+	if from >= to {
+		return
+	}
+	e.yanked = append([]rune(nil), e.buf[from:to]...)
+	e.delete(from, to)
+}
+
+// wordStart returns the start of the word before the cursor
+func (e *Editor) wordStart() int {
+	i := e.pos
+	for i > 0 && unicode.IsSpace(e.buf[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(e.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+// wordEnd returns the end of the word after the cursor
+func (e *Editor) wordEnd() int {
+	i := e.pos
+	for i < len(e.buf) && unicode.IsSpace(e.buf[i]) {
+		i++
+	}
+	for i < len(e.buf) && !unicode.IsSpace(e.buf[i]) {
+		i++
+	}
+	return i
+}
+
+// completeWord completes the word before the cursor. A single candidate is
+// taken with a space after it, several are completed up to their common
+// prefix, and listed if that adds nothing.
+func (e *Editor) completeWord() {
+	if e.complete == nil {
+		return
+	}
+	start := e.pos
+	for start > 0 && !unicode.IsSpace(e.buf[start-1]) {
+		start--
+	}
+	candidates := e.complete(string(e.buf[:e.pos]))
+	word := string(e.buf[start:e.pos])
+	switch len(candidates) {
+	case 0:
+		fmt.Fprint(e.out, "\a")
+		return
+	case 1:
+		e.delete(start, e.pos)
+		e.insert([]rune(candidates[0] + " ")...)
+		return
+	}
+	prefix := []rune(candidates[0])
+	for _, c := range candidates[1:] {
+		n := 0
+		for _, r := range c {
+			if n == len(prefix) || prefix[n] != r {
+				break
+			}
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	if len(prefix) > len([]rune(word)) {
+		e.delete(start, e.pos)
+		e.insert(prefix...)
+		return
+	}
+	// drawn again below
+	fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+}
+
+// browse shows the ith history entry, or the new line for Len()
+func (e *Editor) browse(i int) {
+	if i < 0 || i > e.history.Len() || i == e.histPos {
+		return
+	}
+	if e.histPos == e.history.Len() {
+		e.saved = e.buf
+	}
+	e.histPos = i
+	if i == e.history.Len() {
+		e.buf = e.saved
+	} else {
+		e.buf = []rune(e.history.Entry(i))
+	}
+	e.pos = len(e.buf)
+}
+
+// search looks for the typed text back in the history, from the entry
+// shown. Ctrl-R looks for the next match, Ctrl-G cancels. It returns the
+// key ending the search, to be handled with the match as the line.
+func (e *Editor) search() (rune, error) {
+	var query []rune
+	orig, origPos, origHist := e.buf, e.pos, e.histPos
+	match, failed := e.histPos, false
+	// find looks for the query from the ith entry back
+	find := func(i int) {
+		for ; i >= 0; i-- {
+			entry := e.history.Entry(i)
+			if n := strings.Index(entry, string(query)); n >= 0 {
+				match, failed = i, false
+				e.histPos, e.buf = i, []rune(entry)
+				e.pos = len([]rune(entry[:n]))
+				return
+			}
+		}
+		failed = true
+	}
+	for {
+		label := "reverse-i-search"
+		if failed {
+			label = "failed " + label
+		}
+		fmt.Fprintf(e.out, "\r(%s)`%s': %s\x1b[K", label, string(query), string(e.buf))
+
+		k, err := e.readKey()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case k == ctrlR:
+			if len(query) > 0 {
+				find(match - 1)
+			}
+		case k == ctrlH || k == backspace:
+			if len(query) == 0 {
+				break
+			}
+			query = query[:len(query)-1]
+			if len(query) == 0 {
+				e.buf, e.pos, e.histPos = orig, origPos, origHist
+				match, failed = origHist, false
+			} else {
+				find(origHist - 1)
+			}
+		case k == ctrlG:
+			e.buf, e.pos, e.histPos = orig, origPos, origHist
+			return 0, nil
+		case k > 0 && unicode.IsPrint(k):
+			query = append(query, k)
+			// the match so far may still do
+			find(min(match, e.history.Len()-1))
+		default:
+			return k, nil
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package lineedit
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TestEditor struct {
+	suite.Suite
+
+	history *History
+	out     bytes.Buffer
+}
+
+func TestEditorSuite(t *testing.T) {
+	suite.Run(t, new(TestEditor))
+}
+
+func (t *TestEditor) SetupTest() {
+	t.history = NewHistory(10)
+	for _, line := range []string{"register alice", "create-folder alice docs", "list-folders alice"} {
+		t.Require().NoError(t.history.Add(line))
+	}
+	t.out.Reset()
+}
+
+// edit types keys into a raw terminal and returns the lines entered
+func (t *TestEditor) edit(keys string) []string {
+	e := New(strings.NewReader(keys), &t.out, t.history)
+	var lines []string
+	for {
+		line, err := e.edit("# ")
+		if err == io.EOF {
+			return lines
+		}
+		t.Require().NoError(err)
+		lines = append(lines, line)
+	}
+}
+
+func (t *TestEditor) TestEdit() {
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"abc\r", "abc"},
+		{"abc\x7f\x7fd\n", "ad"},
+		{"abd\x1b[Dc\x1b[C\x1b[C!\r", "abcd!"},
+		{"bc\x01a\x05d\r", "abcd"},
+		{"bc\x1b[Ha\x1b[Fd\r", "abcd"},
+		{"abc\x02\x02\x04\r", "ac"},
+		{"abc\x1b[D\x1b[D\x1b[3~\r", "ac"},
+		{"héllo\x02\x02\x08\r", "hélo"},
+		{"one two three\x17\x17x\r", "one x"},
+		{"one two\x1bb\x1bbX\x1bfY\r", "XoneY two"},
+		{"one two\x1b[1;5DX\r", "one Xtwo"},
+		{"abcdef\x02\x02\x0b\x01\x19\r", "efabcd"},
+		{"abcdef\x02\x02\x15\x05\x19\r", "efabcd"},
+		{"a\tb\x1b[Zc\r", "abc"},
+	}
+	for _, tt := range tests {
+		t.Equal([]string{tt.want}, t.edit(tt.keys), "%q", tt.keys)
+	}
+}
+
+func (t *TestEditor) TestKeys() {
+	// Ctrl-D deletes on a line that isn't empty
+	t.Equal([]string{"b"}, t.edit("ab\x01\x04\r\x04"))
+	// Ctrl-C drops the line
+	e := New(strings.NewReader("abc\x03"), &t.out, t.history)
+	_, err := e.edit("# ")
+	t.ErrorIs(err, ErrInterrupt)
+	t.True(strings.HasSuffix(t.out.String(), "^C\r\n"))
+	// the end of the input
+	e = New(strings.NewReader("abc"), &t.out, t.history)
+	_, err = e.edit("# ")
+	t.ErrorIs(err, io.EOF)
+}
+
+func (t *TestEditor) TestRefresh() {
+	e := New(strings.NewReader("ab\x02\r"), &t.out, t.history)
+	_, err := e.edit("# ")
+	t.NoError(err)
+	t.Equal("\r# \x1b[K\r# a\x1b[K\r# ab\x1b[K\r# ab\x1b[K\x1b[1D\r\n", t.out.String())
+}
+
+func (t *TestEditor) TestHistory() {
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"\x1b[A\r", "list-folders alice"},
+		{"\x10\x10\r", "create-folder alice docs"},
+		{"\x1b[A\x1b[A\x1b[A\x1b[A\r", "register alice"},
+		{"new\x1b[A\x1b[A\x1b[B\x0e\r", "new"},
+		{"\x1b[A x\x1b[B\x1b[A\r", "list-folders alice"},
+	}
+	for _, tt := range tests {
+		t.Equal([]string{tt.want}, t.edit(tt.keys), "%q", tt.keys)
+	}
+}
+
+func (t *TestEditor) TestSearch() {
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"\x12alice\r", "list-folders alice"},
+		{"\x12alice\x12\r", "create-folder alice docs"},
+		{"\x12alice\x12\x12\x12\r", "register alice"},
+		{"\x12reg\x1b[CX\r", "rXegister alice"},
+		{"\x12docs\x05!\r", "create-folder alice docs!"},
+		{"\x12docsx\x7f\r", "create-folder alice docs"},
+		{"\x12list\x7f\x7f\x7f\x7f\r", ""},
+		{"keep\x12nothing\x07\r", "keep"},
+		{"\x12nothing\r", ""},
+	}
+	for _, tt := range tests {
+		t.Equal([]string{tt.want}, t.edit(tt.keys), "%q", tt.keys)
+	}
+
+	t.out.Reset()
+	t.edit("\x12zz\x07\r")
+	t.Contains(t.out.String(), "(failed reverse-i-search)`zz': ")
+}
+
+func (t *TestEditor) TestComplete() {
+	var lines []string
+	complete := func(line string) []string {
+		lines = append(lines, line)
+		var words []string
+		for _, w := range []string{"create-file", "create-folder", "delete-file"} {
+			if strings.HasPrefix(w, line[strings.LastIndex(line, " ")+1:]) {
+				words = append(words, w)
+			}
+		}
+		return words
+	}
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"d\t\r", "delete-file "},
+		{"cr\t\r", "create-f"},
+		{"cr\t\to\t\r", "create-folder "},
+		{"x cr\tx\r", "x create-fx"},
+		{"cr\x01\t\r", "cr"},
+		{"z\t\r", "z"},
+	}
+	for _, tt := range tests {
+		e := New(strings.NewReader(tt.keys), &t.out, t.history)
+		e.SetCompleter(complete)
+		line, err := e.edit("# ")
+		t.NoError(err)
+		t.Equal(tt.want, line, "%q", tt.keys)
+	}
+	// the text up to the cursor is completed
+	t.Contains(lines, "x cr")
+	t.Contains(lines, "")
+
+	t.out.Reset()
+	e := New(strings.NewReader("create-f\t\r"), &t.out, t.history)
+	e.SetCompleter(complete)
+	_, err := e.edit("# ")
+	t.NoError(err)
+	t.Contains(t.out.String(), "\r\ncreate-file  create-folder\r\n\r# create-f")
+}
+
+func (t *TestEditor) TestReadLine() {
+	// not a terminal, read line by line
+	e := New(strings.NewReader("register alice\n\x1b[Aend"), &t.out, t.history)
+	line, err := e.ReadLine("# ")
+	t.NoError(err)
+	t.Equal("register alice", line)
+	line, err = e.ReadLine("> ")
+	t.NoError(err)
+	t.Equal("\x1b[Aend", line)
+	_, err = e.ReadLine("# ")
+	t.ErrorIs(err, io.EOF)
+	t.Equal("# > # ", t.out.String())
+	t.False(IsTerminal(strings.NewReader("")))
+}
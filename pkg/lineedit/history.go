@@ -0,0 +1,99 @@
+package lineedit
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// History holds the lines entered, oldest first. Opened by LoadHistory, it
+// is kept in a file too.
+type History struct {
+	entries []string
+	max     int
+	path    string
+}
+
+// NewHistory returns an empty history keeping the last max lines in memory
+func NewHistory(max int) *History {
+	return &History{max: max}
+}
+
+// LoadHistory reads the history kept in the file at path, one line each,
+// and keeps the lines added later in it. The file holds the last max lines
+// only.
+func LoadHistory(path string, max int) (*History, error) {
+	h := &History{max: max, path: path}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, os.MkdirAll(filepath.Dir(path), 0o700)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	if len(h.entries) <= max {
+		return h, nil
+	}
+	h.entries = h.entries[len(h.entries)-max:]
+	err = h.save()
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// save writes the lines to the file, in place of the ones in it, so it
+// doesn't grow past max lines
+func (h *History) save() error {
+	f, err := os.CreateTemp(filepath.Dir(h.path), ".history-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(strings.Join(h.entries, "\n") + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), h.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Add appends line, unless it's blank, has a newline or repeats the last
+// one
+func (h *History) Add(line string) error {
+	if strings.TrimSpace(line) == "" || strings.Contains(line, "\n") {
+		return nil
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return nil
+	}
+	h.entries = append(h.entries, line)
+	if len(h.entries) > h.max {
+		h.entries = h.entries[len(h.entries)-h.max:]
+	}
+	if h.path == "" {
+		return nil
+	}
+	return h.save()
+}
+
+// Len returns the number of lines
+func (h *History) Len() int {
+	return len(h.entries)
+}
+
+// Entry returns the ith line, from 0
+func (h *History) Entry(i int) string {
+	return h.entries[i]
+}
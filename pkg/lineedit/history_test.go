@@ -0,0 +1,78 @@
+package lineedit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TestHistory struct {
+	suite.Suite
+
+	path string
+}
+
+func TestHistorySuite(t *testing.T) {
+	suite.Run(t, new(TestHistory))
+}
+
+func (t *TestHistory) SetupTest() {
+	t.path = filepath.Join(t.T().TempDir(), "goREPL", "history")
+}
+
+func entries(h *History) []string {
+	var lines []string
+	for i := 0; i < h.Len(); i++ {
+		lines = append(lines, h.Entry(i))
+	}
+	return lines
+}
+
+func (t *TestHistory) TestAdd() {
+	h := NewHistory(3)
+	for _, line := range []string{"a", "", "  ", "b", "b", "c\nd", "c", "d"} {
+		t.NoError(h.Add(line))
+	}
+	t.Equal([]string{"b", "c", "d"}, entries(h))
+}
+
+func (t *TestHistory) TestLoad() {
+	h, err := LoadHistory(t.path, 3)
+	t.Require().NoError(err)
+	t.Equal(0, h.Len())
+	for _, line := range []string{"a", "b", "c", "d"} {
+		t.NoError(h.Add(line))
+	}
+	t.Equal([]string{"b", "c", "d"}, entries(h))
+	// cut down as the lines are added
+	b, err := os.ReadFile(t.path)
+	t.Require().NoError(err)
+	t.Equal("b\nc\nd\n", string(b))
+
+	// and on the next load
+	h, err = LoadHistory(t.path, 2)
+	t.Require().NoError(err)
+	t.Equal([]string{"c", "d"}, entries(h))
+	b, err = os.ReadFile(t.path)
+	t.Require().NoError(err)
+	t.Equal("c\nd\n", string(b))
+	fi, err := os.Stat(t.path)
+	t.Require().NoError(err)
+	t.Equal(os.FileMode(0o600), fi.Mode().Perm())
+}
+
+func (t *TestHistory) TestLoadError() {
+	t.Require().NoError(os.MkdirAll(t.path, 0o700))
+	_, err := LoadHistory(t.path, 10)
+	t.Error(err)
+
+	h, err := LoadHistory(filepath.Join(t.path, "history"), 10)
+	t.Require().NoError(err)
+	t.Require().NoError(os.Remove(t.path))
+	t.Require().NoError(os.WriteFile(t.path, []byte("x"), 0o600))
+	// kept in memory when the file can't be written
+	t.Error(h.Add("a"))
+	t.Equal(1, h.Len())
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package lineedit
+
+import "errors"
+
+// line editing needs termios, only wired up on Linux
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (func() error, error) {
+	return nil, errors.ErrUnsupported
+}
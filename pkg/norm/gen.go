@@ -0,0 +1,170 @@
+//go:build ignore
+
+// gen writes tables.go from the UnicodeData.txt and
+// CompositionExclusions.txt of the Unicode Character Database in -ucd:
+//
+//	go run gen.go -ucd /path/to/ucd -version 14.0.0
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ucd     = flag.String("ucd", ".", "the dir of the Unicode Character Database files")
+	version = flag.String("version", "", "the Unicode version of the files")
+	out     = flag.String("out", "tables.go", "the file to write")
+)
+
+func main() {
+	flag.Parse()
+	if *version == "" {
+		log.Fatal("the -version is required")
+	}
+
+	ccc := map[rune]uint8{}
+	decomp := map[rune][]rune{}
+	err := eachLine("UnicodeData.txt", func(fields []string) {
+		r := parseRune(fields[0])
+		if c, _ := strconv.Atoi(fields[3]); c != 0 {
+			ccc[r] = uint8(c)
+		}
+		// the compatibility decompositions are tagged like <font>
+		if fields[5] != "" && !strings.HasPrefix(fields[5], "<") {
+			for _, f := range strings.Fields(fields[5]) {
+				decomp[r] = append(decomp[r], parseRune(f))
+			}
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	excluded := map[rune]bool{}
+	err = eachLine("CompositionExclusions.txt", func(fields []string) {
+		excluded[parseRune(fields[0])] = true
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by gen.go from the Unicode %s Character Database. DO NOT EDIT.\n\n", *version)
+	fmt.Fprintf(&b, "package norm\n\n")
+	fmt.Fprintf(&b, "// UnicodeVersion is the Unicode version of the tables\n")
+	fmt.Fprintf(&b, "const UnicodeVersion = %q\n\n", *version)
+
+	fmt.Fprintf(&b, "// cccRanges holds the runs of runes of the same non-zero canonical\n")
+	fmt.Fprintf(&b, "// combining class, in order\n")
+	fmt.Fprintf(&b, "var cccRanges = []cccRange{\n")
+	for _, r := range cccRuns(ccc) {
+		fmt.Fprintf(&b, "\t{0x%04X, 0x%04X, %d},\n", r.lo, r.hi, r.ccc)
+	}
+	fmt.Fprintf(&b, "}\n\n")
+
+	runes := sortedKeys(decomp)
+	fmt.Fprintf(&b, "// decompositions holds the canonical decompositions, one level deep\n")
+	fmt.Fprintf(&b, "var decompositions = map[rune][]rune{\n")
+	for _, r := range runes {
+		fmt.Fprintf(&b, "\t0x%04X: {%s},\n", r, hexRunes(decomp[r]))
+	}
+	fmt.Fprintf(&b, "}\n\n")
+
+	fmt.Fprintf(&b, "// compositions holds the primary composites by the pairs they\n")
+	fmt.Fprintf(&b, "// decompose to\n")
+	fmt.Fprintf(&b, "var compositions = map[[2]rune]rune{\n")
+	for _, r := range runes {
+		d := decomp[r]
+		// singletons, non-starter decompositions and the exclusions never
+		// compose
+		if len(d) != 2 || excluded[r] || ccc[r] != 0 || ccc[d[0]] != 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\t{%s}: 0x%04X,\n", hexRunes(d), r)
+	}
+	fmt.Fprintf(&b, "}\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// eachLine calls f with the fields of each data line of the file name
+func eachLine(name string, f func(fields []string)) error {
+	file, err := os.Open(filepath.Join(*ucd, name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		line, _, _ := strings.Cut(s.Text(), "#")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, ";")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		f(fields)
+	}
+	return s.Err()
+}
+
+func parseRune(s string) rune {
+	n, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		log.Fatalf("the %q isn't a code point", s)
+	}
+	return rune(n)
+}
+
+type run struct {
+	lo, hi rune
+	ccc    uint8
+}
+
+// cccRuns merges the runes of ccc into runs of consecutive runes of the
+// same class
+func cccRuns(ccc map[rune]uint8) []run {
+	var runs []run
+	for _, r := range sortedKeys(ccc) {
+		if n := len(runs); n > 0 && runs[n-1].hi == r-1 && runs[n-1].ccc == ccc[r] {
+			runs[n-1].hi = r
+			continue
+		}
+		runs = append(runs, run{r, r, ccc[r]})
+	}
+	return runs
+}
+
+func sortedKeys[V any](m map[rune]V) []rune {
+	keys := make([]rune, 0, len(m))
+	for r := range m {
+		keys = append(keys, r)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func hexRunes(rs []rune) string {
+	s := make([]string, len(rs))
+	for i, r := range rs {
+		s[i] = fmt.Sprintf("0x%04X", r)
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,191 @@
+// Package norm puts strings in the Unicode Normalization Form C and folds
+// their case, so that the strings a user can't tell apart compare equal.
+//
+// The normalization tables are generated from the Unicode Character
+// Database, see UnicodeVersion. To regenerate them, set UCD to the dir of
+// its files and run go generate.
+package norm
+
+//go:generate go run gen.go -ucd $UCD -version 14.0.0
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type cccRange struct {
+	lo, hi rune
+	ccc    uint8
+}
+
+// the Hangul syllables are composed and decomposed algorithmically
+const (
+	sBase  = 0xAC00
+	lBase  = 0x1100
+	vBase  = 0x1161
+	tBase  = 0x11A7
+	lCount = 19
+	vCount = 21
+	tCount = 28
+	nCount = vCount * tCount
+	sCount = lCount * nCount
+)
+
+// NFC returns s in the Normalization Form C, its canonical decomposition
+// composed back
+func NFC(s string) string {
+	if isASCII(s) {
+		return s
+	}
+	rs := decompose(s)
+	if len(rs) == 0 {
+		return s
+	}
+	return string(compose(rs))
+}
+
+// NFD returns s in the Normalization Form D, its canonical decomposition
+func NFD(s string) string {
+	if isASCII(s) {
+		return s
+	}
+	return string(decompose(s))
+}
+
+// IsNFC tells whether s is in the Normalization Form C
+func IsNFC(s string) bool {
+	return NFC(s) == s
+}
+
+// Fold returns s with each rune simply case folded, the runes the Unicode
+// case folding tells apart only by case mapped to the same one
+func Fold(s string) string {
+	if isASCII(s) {
+		return strings.ToLower(s)
+	}
+	return strings.Map(foldRune, s)
+}
+
+// Key returns the key s compares by, its NFC case folded. The strings of
+// the same key differ only in case or in their canonical forms.
+func Key(s string) string {
+	if isASCII(s) {
+		return strings.ToLower(s)
+	}
+	return NFC(Fold(NFC(s)))
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// foldRune returns the rune r folds to: among the runes its case folding
+// orbit holds, the least lowercase one, or the least one if none is
+func foldRune(r rune) rune {
+	f := r
+	for c := unicode.SimpleFold(r); c != r; c = unicode.SimpleFold(c) {
+		if lower, fLower := unicode.IsLower(c), unicode.IsLower(f); lower && !fLower || lower == fLower && c < f {
+			f = c
+		}
+	}
+	return f
+}
+
+// combiningClass returns the canonical combining class of r
+func combiningClass(r rune) uint8 {
+	i := sort.Search(len(cccRanges), func(i int) bool { return cccRanges[i].hi >= r })
+	if i < len(cccRanges) && cccRanges[i].lo <= r {
+		return cccRanges[i].ccc
+	}
+	return 0
+}
+
+// decompose returns the canonical decomposition of s in the canonical
+// order. Invalid UTF-8 is kept as utf8.RuneError.
+func decompose(s string) []rune {
+	rs := make([]rune, 0, len(s))
+	for _, r := range s {
+		rs = appendDecomposed(rs, r)
+	}
+	// sort the runs of non-starters by class, stably
+	for i := 1; i < len(rs); i++ {
+		c := combiningClass(rs[i])
+		if c == 0 {
+			continue
+		}
+		for j := i; j > 0; j-- {
+			p := combiningClass(rs[j-1])
+			if p == 0 || p <= c {
+				break
+			}
+			rs[j-1], rs[j] = rs[j], rs[j-1]
+		}
+	}
+	return rs
+}
+
+func appendDecomposed(rs []rune, r rune) []rune {
+	if s := r - sBase; s >= 0 && s < sCount {
+		rs = append(rs, lBase+s/nCount, vBase+(s%nCount)/tCount)
+		if t := s % tCount; t != 0 {
+			rs = append(rs, tBase+t)
+		}
+		return rs
+	}
+	d, ok := decompositions[r]
+	if !ok {
+		return append(rs, r)
+	}
+	for _, c := range d {
+		rs = appendDecomposed(rs, c)
+	}
+	return rs
+}
+
+// compose composes the decomposed rs in place, each starter with the runes
+// following it that aren't blocked from it
+func compose(rs []rune) []rune {
+	out := rs[:1]
+	starter := -1
+	if combiningClass(rs[0]) == 0 {
+		starter = 0
+	}
+	// last is the class of the last rune left uncomposed after the starter,
+	// 0 while there's none
+	var last uint8
+	for _, r := range rs[1:] {
+		c := combiningClass(r)
+		if starter >= 0 && (last == 0 || last < c) {
+			if p, ok := composePair(out[starter], r); ok {
+				out[starter] = p
+				continue
+			}
+		}
+		if c == 0 {
+			starter = len(out)
+			last = 0
+		} else {
+			last = c
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+func composePair(a, b rune) (rune, bool) {
+	if l, v := a-lBase, b-vBase; l >= 0 && l < lCount && v >= 0 && v < vCount {
+		return sBase + (l*vCount+v)*tCount, true
+	}
+	if s, t := a-sBase, b-tBase; s >= 0 && s < sCount && s%tCount == 0 && t > 0 && t < tCount {
+		return a + t, true
+	}
+	p, ok := compositions[[2]rune{a, b}]
+	return p, ok
+}
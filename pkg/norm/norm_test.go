@@ -0,0 +1,64 @@
+package norm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TestNorm struct {
+	suite.Suite
+}
+
+func TestNormSuite(t *testing.T) {
+	suite.Run(t, new(TestNorm))
+}
+
+func (t *TestNorm) TestNFC() {
+	cases := []struct{ in, want string }{
+		{"alice", "alice"},
+		{"e\u0301", "\u00e9"},
+		{"\u00e9", "\u00e9"},
+		// the marks are ordered by class before they compose
+		{"a\u0323\u0302", "\u1ead"},
+		{"a\u0302\u0323", "\u1ead"},
+		// a mark of the same class blocks the second one
+		{"a\u0301\u0301", "\u00e1\u0301"},
+		// singletons and exclusions don't compose back
+		{"\u212b", "\u00c5"},
+		{"\u0958", "\u0915\u093c"},
+		// Hangul syllables, LV and LVT
+		{"\u1100\u1161", "\uac00"},
+		{"\u1100\u1161\u11a8", "\uac01"},
+		{"\uac00\u11a8", "\uac01"},
+		// a leading mark stays
+		{"\u0301e", "\u0301e"},
+		{"caf\u00e9 cafe\u0301", "caf\u00e9 caf\u00e9"},
+		{"a\xff", "a\ufffd"},
+	}
+	for _, c := range cases {
+		t.Equal(c.want, NFC(c.in), "%+q", c.in)
+		t.True(IsNFC(c.want), "%+q", c.want)
+	}
+	t.False(IsNFC("e\u0301"))
+	t.Equal("a\u0323\u0302", NFD("\u1ead"))
+	t.Equal("\u1100\u1161\u11a8", NFD("\uac01"))
+}
+
+func (t *TestNorm) TestFold() {
+	t.Equal("alice", Fold("ALICE"))
+	t.Equal("привет", Fold("ПРИВЕТ"))
+	t.Equal(Fold("σ"), Fold("Σ"))
+	t.Equal(Fold("σ"), Fold("ς"))
+	t.Equal(Fold("k"), Fold("\u212a"))
+	t.Equal(Fold("ß"), Fold("ẞ"))
+	// the dotless i folds apart from i
+	t.NotEqual(Fold("i"), Fold("ı"))
+}
+
+func (t *TestNorm) TestKey() {
+	t.Equal("readme", Key("ReadMe"))
+	t.Equal(Key("Café"), Key("CAFE\u0301"))
+	t.Equal(Key("Ångström"), Key("\u212bngstro\u0308m"))
+	t.NotEqual(Key("cafe"), Key("café"))
+}
@@ -0,0 +1,167 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/reddtsai/goREPL/pkg/norm"
+)
+
+// prototypes maps the letters of other scripts that look like Latin ones,
+// after the confusables of the Unicode Technical Standard #39, to the Latin
+// letters they look like
+var prototypes = map[rune]rune{
+	// Cyrillic
+	'\u0410': 'A', // cyrillic capital letter a
+	'\u0412': 'B', // cyrillic capital letter ve
+	'\u0415': 'E', // cyrillic capital letter ie
+	'\u041a': 'K', // cyrillic capital letter ka
+	'\u041c': 'M', // cyrillic capital letter em
+	'\u041d': 'H', // cyrillic capital letter en
+	'\u041e': 'O', // cyrillic capital letter o
+	'\u0420': 'P', // cyrillic capital letter er
+	'\u0421': 'C', // cyrillic capital letter es
+	'\u0422': 'T', // cyrillic capital letter te
+	'\u0425': 'X', // cyrillic capital letter ha
+	'\u0423': 'Y', // cyrillic capital letter u
+	'\u0405': 'S', // cyrillic capital letter dze
+	'\u0406': 'I', // cyrillic capital letter byelorussian-ukrainian i
+	'\u0408': 'J', // cyrillic capital letter je
+	'\u051a': 'Q', // cyrillic capital letter qa
+	'\u051c': 'W', // cyrillic capital letter we
+	'\u04ae': 'Y', // cyrillic capital letter straight u
+	'\u04c0': 'l', // cyrillic letter palochka
+	'\u0430': 'a', // cyrillic small letter a
+	'\u0435': 'e', // cyrillic small letter ie
+	'\u043e': 'o', // cyrillic small letter o
+	'\u0440': 'p', // cyrillic small letter er
+	'\u0441': 'c', // cyrillic small letter es
+	'\u0443': 'y', // cyrillic small letter u
+	'\u0445': 'x', // cyrillic small letter ha
+	'\u0455': 's', // cyrillic small letter dze
+	'\u0456': 'i', // cyrillic small letter byelorussian-ukrainian i
+	'\u0458': 'j', // cyrillic small letter je
+	'\u0501': 'd', // cyrillic small letter komi de
+	'\u04bb': 'h', // cyrillic small letter shha
+	'\u051b': 'q', // cyrillic small letter qa
+	'\u051d': 'w', // cyrillic small letter we
+	'\u04cf': 'l', // cyrillic small letter palochka
+	'\u04af': 'y', // cyrillic small letter straight u
+	'\u0475': 'v', // cyrillic small letter izhitsa
+	// Greek
+	'\u0391': 'A', // greek capital letter alpha
+	'\u0392': 'B', // greek capital letter beta
+	'\u0395': 'E', // greek capital letter epsilon
+	'\u0396': 'Z', // greek capital letter zeta
+	'\u0397': 'H', // greek capital letter eta
+	'\u0399': 'I', // greek capital letter iota
+	'\u039a': 'K', // greek capital letter kappa
+	'\u039c': 'M', // greek capital letter mu
+	'\u039d': 'N', // greek capital letter nu
+	'\u039f': 'O', // greek capital letter omicron
+	'\u03a1': 'P', // greek capital letter rho
+	'\u03a4': 'T', // greek capital letter tau
+	'\u03a5': 'Y', // greek capital letter upsilon
+	'\u03a7': 'X', // greek capital letter chi
+	'\u03f9': 'C', // greek capital lunate sigma symbol
+	'\u037f': 'J', // greek capital letter yot
+	'\u03bf': 'o', // greek small letter omicron
+	'\u03b1': 'a', // greek small letter alpha
+	'\u03bd': 'v', // greek small letter nu
+	'\u03b9': 'i', // greek small letter iota
+	'\u03c1': 'p', // greek small letter rho
+	'\u03c5': 'u', // greek small letter upsilon
+	'\u03c7': 'x', // greek small letter chi
+	'\u03f2': 'c', // greek lunate sigma symbol
+	'\u03f3': 'j', // greek letter yot
+	'\u03b3': 'y', // greek small letter gamma
+	// Armenian
+	'\u0555': 'O', // armenian capital letter oh
+	'\u054d': 'U', // armenian capital letter seh
+	'\u054f': 'S', // armenian capital letter tiwn
+	'\u0585': 'o', // armenian small letter oh
+	'\u057d': 'u', // armenian small letter seh
+	'\u0581': 'g', // armenian small letter co
+	'\u0570': 'h', // armenian small letter ho
+	'\u0578': 'n', // armenian small letter vo
+	'\u0566': 'q', // armenian small letter za
+	'\u0561': 'w', // armenian small letter ayb
+	// Cherokee
+	'\u13aa': 'A', // cherokee letter go
+	'\u13f4': 'B', // cherokee letter yv
+	'\u13df': 'C', // cherokee letter tli
+	'\u13ac': 'E', // cherokee letter gv
+	'\u13bb': 'H', // cherokee letter mi
+	'\u13ab': 'J', // cherokee letter gu
+	'\u13e6': 'K', // cherokee letter tso
+	'\u13b7': 'M', // cherokee letter lu
+	'\u13e2': 'P', // cherokee letter tlv
+	'\u13da': 'S', // cherokee letter du
+	'\u13a2': 'T', // cherokee letter i
+	'\u13d4': 'W', // cherokee letter ta
+	'\u13c3': 'Z', // cherokee letter no
+}
+
+// skeleton returns what s looks like: its decomposition with the lookalikes
+// in place of their prototypes, as a key. The values of the same skeleton
+// are confusable.
+func skeleton(s string) string {
+	return norm.Key(strings.Map(func(c rune) rune {
+		if p, ok := prototypes[c]; ok {
+			return p
+		}
+		return c
+	}, norm.NFD(s)))
+}
+
+// mixedScript tells whether s holds letters of more than one script, the
+// runes common to the scripts aside
+func mixedScript(s string) bool {
+	seen := ""
+	for _, c := range s {
+		script := scriptOf(c)
+		if script == "" {
+			continue
+		}
+		if seen != "" && script != seen {
+			return true
+		}
+		seen = script
+	}
+	return false
+}
+
+// scriptOf returns the script of c, or "" for the common and inherited runes
+func scriptOf(c rune) string {
+	if c < unicode.MaxASCII {
+		if unicode.IsLetter(c) {
+			return "Latin"
+		}
+		return ""
+	}
+	for name, table := range unicode.Scripts {
+		if name != "Common" && name != "Inherited" && unicode.Is(table, c) {
+			return name
+		}
+	}
+	return ""
+}
+
+// Confusable forbids the values that look like one of names, without being
+// the same name, when either holds letters of mixed scripts, like a
+// Cyrillic "\u0430" in place of a Latin "a"
+func Confusable(names ...string) Rule {
+	return NewRule("confusable", func(s string) string {
+		k := skeleton(s)
+		for _, name := range names {
+			if norm.Key(name) == norm.Key(s) || skeleton(name) != k {
+				continue
+			}
+			if mixedScript(s) || mixedScript(name) {
+				return fmt.Sprintf("looks like [%s]", name)
+			}
+		}
+		return ""
+	})
+}
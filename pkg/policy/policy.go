@@ -0,0 +1,214 @@
+// Package policy checks names against named rules, such as the chars and
+// the length allowed, and tells which rule a name breaks.
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Unit is what a length is counted in
+type Unit int
+
+const (
+	Bytes Unit = iota
+	Runes
+)
+
+// Rule is a named check of a value
+type Rule struct {
+	// Name names the rule, a Policy holds one rule of a name
+	Name string
+	// check returns why s breaks the rule, or "" if it doesn't
+	check func(s string) string
+}
+
+// NewRule returns the rule name, check returns why a value breaks it, or ""
+// if it doesn't
+func NewRule(name string, check func(s string) string) Rule {
+	return Rule{Name: name, check: check}
+}
+
+// Check returns why s breaks r, or "" if it doesn't
+func (r Rule) Check(s string) string {
+	return r.check(s)
+}
+
+// Charset allows only the runes in ranges, given as pairs like "a-zA-Z", and
+// in chars. It panics if ranges isn't made of pairs.
+func Charset(ranges, chars string) Rule {
+	rs := []rune(ranges)
+	if len(rs)%3 != 0 {
+		panic(fmt.Sprintf("policy: the ranges %q aren't pairs like a-z", ranges))
+	}
+	for i := 0; i < len(rs); i += 3 {
+		if rs[i+1] != '-' || rs[i] > rs[i+2] {
+			panic(fmt.Sprintf("policy: the ranges %q aren't pairs like a-z", ranges))
+		}
+	}
+	allowed := func(c rune) bool {
+		for i := 0; i < len(rs); i += 3 {
+			if rs[i] <= c && c <= rs[i+2] {
+				return true
+			}
+		}
+		return strings.ContainsRune(chars, c)
+	}
+	return NewRule("charset", func(s string) string {
+		if !utf8.ValidString(s) {
+			return "contain invalid chars"
+		}
+		for _, c := range s {
+			if !allowed(c) {
+				return "contain invalid chars"
+			}
+		}
+		return ""
+	})
+}
+
+// UnicodeCharset allows only the runes in one of tables, such as unicode.L,
+// and in chars
+func UnicodeCharset(tables []*unicode.RangeTable, chars string) Rule {
+	return NewRule("charset", func(s string) string {
+		if !utf8.ValidString(s) {
+			return "contain invalid chars"
+		}
+		for _, c := range s {
+			if !unicode.IsOneOf(tables, c) && !strings.ContainsRune(chars, c) {
+				return "contain invalid chars"
+			}
+		}
+		return ""
+	})
+}
+
+// Length allows from min to max bytes or runes
+func Length(min, max int, unit Unit) Rule {
+	return NewRule("length", func(s string) string {
+		l := len(s)
+		if unit == Runes {
+			l = utf8.RuneCountInString(s)
+		}
+		if l < min || l > max {
+			return "invalid length"
+		}
+		return ""
+	})
+}
+
+// Reserved forbids names, whatever their case
+func Reserved(names ...string) Rule {
+	return NewRule("reserved", func(s string) string {
+		for _, name := range names {
+			if strings.EqualFold(s, name) {
+				return "is reserved"
+			}
+		}
+		return ""
+	})
+}
+
+// ForbiddenPrefixes forbids the values starting with one of prefixes
+func ForbiddenPrefixes(prefixes ...string) Rule {
+	return NewRule("prefix", func(s string) string {
+		for _, p := range prefixes {
+			if strings.HasPrefix(s, p) {
+				return fmt.Sprintf("can't start with [%s]", p)
+			}
+		}
+		return ""
+	})
+}
+
+// ForbiddenSuffixes forbids the values ending with one of suffixes
+func ForbiddenSuffixes(suffixes ...string) Rule {
+	return NewRule("suffix", func(s string) string {
+		for _, p := range suffixes {
+			if strings.HasSuffix(s, p) {
+				return fmt.Sprintf("can't end with [%s]", p)
+			}
+		}
+		return ""
+	})
+}
+
+// Error is the rule a value breaks and why
+type Error struct {
+	// Subject is the value, or the label of the policy
+	Subject string
+	Rule    string
+	Reason  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("the [%s] %s", e.Subject, e.Reason)
+}
+
+// Policy is the rules a value must follow, checked in order
+type Policy struct {
+	// Label stands for the value in the errors when set, e.g. for long
+	// texts
+	Label string
+	Rules []Rule
+}
+
+// New returns the policy of rules
+func New(rules ...Rule) Policy {
+	return Policy{Rules: rules}
+}
+
+// Labeled returns a copy of p naming the value label in the errors
+func (p Policy) Labeled(label string) Policy {
+	p.Label = label
+	return p
+}
+
+// With returns a copy of p where rule takes the place of the rule of the
+// same name, or follows the others if there is none
+func (p Policy) With(rule Rule) Policy {
+	rules := make([]Rule, 0, len(p.Rules)+1)
+	replaced := false
+	for _, r := range p.Rules {
+		if r.Name == rule.Name {
+			r = rule
+			replaced = true
+		}
+		rules = append(rules, r)
+	}
+	if !replaced {
+		rules = append(rules, rule)
+	}
+	p.Rules = rules
+	return p
+}
+
+// Without returns a copy of p without the rule name
+func (p Policy) Without(name string) Policy {
+	rules := make([]Rule, 0, len(p.Rules))
+	for _, r := range p.Rules {
+		if r.Name != name {
+			rules = append(rules, r)
+		}
+	}
+	p.Rules = rules
+	return p
+}
+
+// Check returns an *Error for the first rule s breaks, or nil
+func (p Policy) Check(s string) error {
+	for _, r := range p.Rules {
+		reason := r.Check(s)
+		if reason == "" {
+			continue
+		}
+		subject := s
+		if p.Label != "" {
+			subject = p.Label
+		}
+		return &Error{Subject: subject, Rule: r.Name, Reason: reason}
+	}
+	return nil
+}
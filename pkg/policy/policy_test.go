@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+	"unicode"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TestPolicy struct {
+	suite.Suite
+}
+
+func TestPolicySuite(t *testing.T) {
+	suite.Run(t, new(TestPolicy))
+}
+
+func (t *TestPolicy) TestCharset() {
+	r := Charset("a-zA-Z0-9", ".-_")
+	t.Equal("charset", r.Name)
+	t.Empty(r.Check("aZ9.-_"))
+	t.Empty(r.Check(""))
+	t.Equal("contain invalid chars", r.Check("a b"))
+	t.Equal("contain invalid chars", r.Check("é"))
+	t.Equal("contain invalid chars", r.Check("a\xff"))
+	t.Empty(Charset("α-ω", "").Check("λ"))
+	t.Panics(func() { Charset("a-", "") })
+	t.Panics(func() { Charset("abc", "") })
+	t.Panics(func() { Charset("z-a", "") })
+}
+
+func (t *TestPolicy) TestUnicodeCharset() {
+	r := UnicodeCharset([]*unicode.RangeTable{unicode.L, unicode.M, unicode.Nd}, "._")
+	t.Equal("charset", r.Name)
+	t.Empty(r.Check("Привет_мир.txt"))
+	t.Empty(r.Check("नमस्ते"))
+	t.Empty(r.Check("cafe\u0301"))
+	t.Equal("contain invalid chars", r.Check("a b"))
+	t.Equal("contain invalid chars", r.Check("a\u200bb"))
+	t.Equal("contain invalid chars", r.Check("a\xff"))
+}
+
+func (t *TestPolicy) TestLength() {
+	bytes := Length(1, 3, Bytes)
+	runes := Length(1, 3, Runes)
+	t.Equal("invalid length", bytes.Check(""))
+	t.Empty(bytes.Check("abc"))
+	t.Equal("invalid length", bytes.Check("abcd"))
+	t.Equal("invalid length", bytes.Check("äö"))
+	t.Empty(runes.Check("äöü"))
+	t.Equal("invalid length", runes.Check("äöüß"))
+}
+
+func (t *TestPolicy) TestReservedAndAffixes() {
+	t.Equal("is reserved", Reserved("con", "..").Check("CON"))
+	t.Empty(Reserved("con").Check("cons"))
+	p := ForbiddenPrefixes("-", ".")
+	t.Equal("can't start with [.]", p.Check(".hidden"))
+	t.Empty(p.Check("a.b"))
+	s := ForbiddenSuffixes(".tmp", "~")
+	t.Equal("can't end with [~]", s.Check("notes~"))
+	t.Empty(s.Check("tmp.notes"))
+}
+
+func (t *TestPolicy) TestConfusable() {
+	t.True(mixedScript("p\u0430ypal"))
+	t.False(mixedScript("\u043f\u0440\u0438\u0432\u0435\u0442"))
+	t.False(mixedScript("report-2024.txt"))
+	t.Equal(skeleton("paypal"), skeleton("P\u0410YPAL"))
+
+	r := Confusable("paypal", "\u0441\u043e\u0440\u0435", "Notes")
+	t.Equal("confusable", r.Name)
+	// a Cyrillic a in place of a Latin one
+	t.Equal("looks like [paypal]", r.Check("p\u0430ypal"))
+	t.Equal("looks like [paypal]", r.Check("P\u0410YPAL"))
+	// a Latin c among the Cyrillic letters
+	t.Equal("looks like [\u0441\u043e\u0440\u0435]", r.Check("c\u043e\u0440\u0435"))
+	// the same name is left to the others
+	t.Empty(r.Check("PayPal"))
+	// a name of a single script, or looking like none, is fine
+	t.Empty(r.Check("\u0440\u0430\u0443\u0440\u0430\u04cf"))
+	t.Empty(r.Check("N\u03bftes2"))
+}
+
+func (t *TestPolicy) TestCheck() {
+	p := New(Length(1, 5, Bytes), Charset("a-z", ""), Reserved("root"))
+	t.NoError(p.Check("alice"))
+	// the first rule broken is reported
+	err := p.Check("ALICE!")
+	t.EqualError(err, "the [ALICE!] invalid length")
+	var e *Error
+	t.Require().True(errors.As(err, &e))
+	t.Equal(&Error{Subject: "ALICE!", Rule: "length", Reason: "invalid length"}, e)
+	t.EqualError(p.Check("a b"), "the [a b] contain invalid chars")
+	t.EqualError(p.Check("root"), "the [root] is reserved")
+	t.EqualError(p.Labeled("name").Check("bob!"), "the [name] contain invalid chars")
+}
+
+func (t *TestPolicy) TestWithWithout() {
+	p := New(Length(1, 5, Bytes), Charset("a-z", ""))
+	longer := p.With(Length(1, 10, Bytes))
+	t.Len(longer.Rules, 2)
+	t.NoError(longer.Check("abcdefgh"))
+	// p is left as it is
+	t.Error(p.Check("abcdefgh"))
+	suffix := p.With(ForbiddenSuffixes("x"))
+	t.Equal("suffix", suffix.Rules[2].Name)
+	t.EqualError(suffix.Check("box"), "the [box] can't end with [x]")
+	t.NoError(p.Without("charset").Check("A1"))
+	t.Len(p.Rules, 2)
+}
@@ -0,0 +1,49 @@
+package storage_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/reddtsai/goREPL/pkg/storage"
+	"github.com/reddtsai/goREPL/pkg/storage/storagetest"
+)
+
+func TestVirtualFileSysStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.IStorage {
+		return storage.NewVirtualFileSysStorage()
+	})
+}
+
+func TestFileSysStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.IStorage {
+		s, err := storage.NewFileSysStorage(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			s.(io.Closer).Close()
+		})
+		return s
+	})
+}
+
+func TestTxConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.IStorage {
+		tx, err := storage.Begin(context.Background(), storage.NewVirtualFileSysStorage())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	})
+}
+
+func TestHostDirStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.IStorage {
+		s, err := storage.NewHostDirStorage(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
@@ -0,0 +1,32 @@
+package storage
+
+import "context"
+
+type contextKey int
+
+const (
+	actorKey contextKey = iota
+	traceIDKey
+)
+
+// WithActor returns a copy of ctx carrying the user acting on the storage.
+func WithActor(ctx context.Context, userName string) context.Context {
+	return context.WithValue(ctx, actorKey, userName)
+}
+
+// ActorFromContext returns the user set by WithActor, if any.
+func ActorFromContext(ctx context.Context) string {
+	userName, _ := ctx.Value(actorKey).(string)
+	return userName
+}
+
+// WithTraceID returns a copy of ctx carrying the trace ID of a request.
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey, traceID)
+}
+
+// TraceIDFromContext returns the trace ID set by WithTraceID, if any.
+func TraceIDFromContext(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDKey).(string)
+	return traceID
+}
@@ -0,0 +1,355 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	snapshotFileName = "snapshot.json"
+	snapshotVersion  = 1
+	// the journal is folded into a new snapshot once it grows past this size
+	defaultCompactThreshold = 1 << 20
+)
+
+// FileSysStorage keeps the virtual file system in memory and persists it
+// to a data directory, so the tree survives a restart of the REPL.
+//
+// Every mutation is appended to a write-ahead journal before it is applied.
+// On open the journal is replayed over the last snapshot, and once it grows
+// past the compaction threshold it is folded into a new snapshot.
+//
+// A mutation is checked, journaled and applied under the locks of the users
+// it works on, so mutations on different users only wait for each other to
+// append to the journal.
+type FileSysStorage struct {
+	// mu is held for reading by the mutations in flight, and for writing
+	// by a compaction, so a snapshot holds every mutation journaled
+	mu sync.RWMutex
+	// appendMu serializes the appends to the journal, and guards seq and
+	// the journal size
+	appendMu         sync.Mutex
+	dir              string
+	mem              *VirtualFileSysStorage
+	journal          *journal
+	seq              uint64
+	compactThreshold int64
+}
+
+type fileSysSnapshot struct {
+	Version int `json:"version"`
+	// Seq is the last journal record folded into the snapshot.
+	Seq   uint64                            `json:"seq"`
+	Users map[string][]VirtualFileSysEntity `json:"users"`
+}
+
+// NewFileSysStorage opens the data directory, creating it when missing,
+// and loads the last snapshot and journal saved there.
+func NewFileSysStorage(dir string) (IStorage, error) {
+	return openFileSysStorage(dir, defaultCompactThreshold)
+}
+
+func openFileSysStorage(dir string, compactThreshold int64) (*FileSysStorage, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+	f := &FileSysStorage{
+		dir:              dir,
+		mem:              newVirtualFileSysStorage(),
+		compactThreshold: compactThreshold,
+	}
+	err = f.load()
+	if err != nil {
+		return nil, err
+	}
+	// records up to the snapshot seq survive a crash between
+	// saving a snapshot and resetting the journal, skip them
+	f.journal, err = openJournal(filepath.Join(dir, journalFileName), func(m mutation) error {
+		if m.Seq <= f.seq {
+			return nil
+		}
+		f.seq = m.Seq
+		return f.mem.apply(m)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if f.journal.size >= f.compactThreshold {
+		err = f.compact()
+		if err != nil {
+			f.journal.close()
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// Close compacts the journal into a snapshot and releases the data directory.
+func (f *FileSysStorage) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := f.compact()
+	if cerr := f.journal.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (f *FileSysStorage) AddUser(ctx context.Context, userName string) error {
+	return f.commit(ctx, mutation{
+		Op:       opAddUser,
+		UserName: userName,
+	})
+}
+
+func (f *FileSysStorage) IsExistUser(ctx context.Context, userName string) bool {
+	return f.mem.IsExistUser(ctx, userName)
+}
+
+func (f *FileSysStorage) ListUser(ctx context.Context) ([]string, error) {
+	return f.mem.ListUser(ctx)
+}
+
+func (f *FileSysStorage) AddFolder(ctx context.Context, userName, folderName, folderDesc string) error {
+	return f.commit(ctx, mutation{
+		Op:         opAddFolder,
+		UserName:   userName,
+		FolderName: folderName,
+		Desc:       folderDesc,
+		Time:       time.Now().Unix(),
+	})
+}
+
+func (f *FileSysStorage) DeleteFolder(ctx context.Context, userName, folderName string) error {
+	return f.commit(ctx, mutation{
+		Op:         opDeleteFolder,
+		UserName:   userName,
+		FolderName: folderName,
+	})
+}
+
+func (f *FileSysStorage) RenameFolder(ctx context.Context, userName, folderName, newFolderName string) error {
+	return f.commit(ctx, mutation{
+		Op:            opRenameFolder,
+		UserName:      userName,
+		FolderName:    folderName,
+		NewFolderName: newFolderName,
+	})
+}
+
+func (f *FileSysStorage) IsExistFolder(ctx context.Context, userName, folderName string) bool {
+	return f.mem.IsExistFolder(ctx, userName, folderName)
+}
+
+func (f *FileSysStorage) ListFolder(ctx context.Context, userName, sortName, orderBy string) ([]VirtualFileSysEntity, error) {
+	return f.mem.ListFolder(ctx, userName, sortName, orderBy)
+}
+
+func (f *FileSysStorage) IsExistFile(ctx context.Context, userName, folderName, fileName string) bool {
+	return f.mem.IsExistFile(ctx, userName, folderName, fileName)
+}
+
+func (f *FileSysStorage) AddFile(ctx context.Context, userName, folderName, fileName, fileDesc string) error {
+	return f.commit(ctx, mutation{
+		Op:         opAddFile,
+		UserName:   userName,
+		FolderName: folderName,
+		FileName:   fileName,
+		Desc:       fileDesc,
+		Time:       time.Now().Unix(),
+	})
+}
+
+func (f *FileSysStorage) DeleteFile(ctx context.Context, userName, folderName, fileName string) error {
+	return f.commit(ctx, mutation{
+		Op:         opDeleteFile,
+		UserName:   userName,
+		FolderName: folderName,
+		FileName:   fileName,
+	})
+}
+
+func (f *FileSysStorage) ListFile(ctx context.Context, userName, folderName, sortName, orderBy string) ([]VirtualFileSysFileEntity, error) {
+	return f.mem.ListFile(ctx, userName, folderName, sortName, orderBy)
+}
+
+func (f *FileSysStorage) GetUser(ctx context.Context, userName string) (string, error) {
+	return f.mem.GetUser(ctx, userName)
+}
+
+func (f *FileSysStorage) GetFolder(ctx context.Context, userName, folderName string) (VirtualFileSysEntity, error) {
+	return f.mem.GetFolder(ctx, userName, folderName)
+}
+
+func (f *FileSysStorage) GetFile(ctx context.Context, userName, folderName, fileName string) (VirtualFileSysFileEntity, error) {
+	return f.mem.GetFile(ctx, userName, folderName, fileName)
+}
+
+// commit checks m, journals it and then applies it, under the locks of the
+// users m works on, so m can't be invalidated between the check and the
+// apply. ctx is only checked before the journal is written.
+func (f *FileSysStorage) commit(ctx context.Context, m mutation) error {
+	f.mu.RLock()
+	full := false
+	err := ctx.Err()
+	if err == nil {
+		m.Actor = ActorFromContext(ctx)
+		m.TraceID = TraceIDFromContext(ctx)
+		err = f.mem.applyWith(m, func() error {
+			var err error
+			full, err = f.append(m)
+			return err
+		})
+	}
+	f.mu.RUnlock()
+	if err != nil || !full {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// another mutation may have compacted meanwhile
+	if f.journal.size >= f.compactThreshold {
+		// the mutation is durable in the journal already,
+		// a failed compaction is retried on the next one
+		err = f.compact()
+		if err != nil {
+			log.Printf("storage: %v", err)
+		}
+	}
+	return nil
+}
+
+// append journals m as the next record, and reports whether the journal
+// has grown past the compaction threshold.
+func (f *FileSysStorage) append(m mutation) (bool, error) {
+	f.appendMu.Lock()
+	defer f.appendMu.Unlock()
+
+	m.Seq = f.seq + 1
+	err := f.journal.append(m)
+	if err != nil {
+		return false, err
+	}
+	f.seq = m.Seq
+	return f.journal.size >= f.compactThreshold, nil
+}
+
+// applyMutation lets a Tx commit to f.
+func (f *FileSysStorage) applyMutation(ctx context.Context, m mutation) error {
+	return f.commit(ctx, m)
+}
+
+// snapshotUser lets a Tx copy a user of f.
+func (f *FileSysStorage) snapshotUser(ctx context.Context, userName string) (string, []VirtualFileSysEntity, error) {
+	return f.mem.snapshotUser(ctx, userName)
+}
+
+// compact saves a snapshot of the current state and empties the journal.
+func (f *FileSysStorage) compact() error {
+	err := f.save()
+	if err != nil {
+		return err
+	}
+	return f.journal.reset(0)
+}
+
+func (f *FileSysStorage) load() error {
+	b, err := os.ReadFile(filepath.Join(f.dir, snapshotFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+	var snap fileSysSnapshot
+	err = json.Unmarshal(b, &snap)
+	if err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+
+	f.seq = snap.Seq
+	for userName, entities := range snap.Users {
+		f.mem.restore(userName, entities)
+	}
+
+	return nil
+}
+
+func (f *FileSysStorage) save() error {
+	users := f.mem.dump()
+	b, err := json.Marshal(fileSysSnapshot{
+		Version: snapshotVersion,
+		Seq:     f.seq,
+		Users:   users,
+	})
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	return writeFileAtomic(filepath.Join(f.dir, snapshotFileName), b)
+}
+
+// writeFileAtomic writes data to a temp file next to path, fsyncs it and
+// renames it over path, so a crash leaves either the old or the new file.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("write temp file: %w", err)
+	}
+	err = os.Rename(tmpName, path)
+	if err != nil {
+		return fmt.Errorf("rename temp file: %w", err)
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir flushes the directory entry of a rename to disk.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		// directories cannot be opened for sync on windows
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open data dir: %w", err)
+	}
+	defer d.Close()
+
+	err = d.Sync()
+	if err != nil {
+		return fmt.Errorf("sync data dir: %w", err)
+	}
+	return nil
+}
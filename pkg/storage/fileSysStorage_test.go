@@ -0,0 +1,329 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TestFileSysStorage struct {
+	suite.Suite
+
+	dir string
+	ctx context.Context
+}
+
+func TestFileSysStorageSuite(t *testing.T) {
+	suite.Run(t, new(TestFileSysStorage))
+}
+
+func (t *TestFileSysStorage) SetupTest() {
+	t.ctx = context.Background()
+	t.dir = t.T().TempDir()
+}
+
+func (t *TestFileSysStorage) open(compactThreshold int64) *FileSysStorage {
+	s, err := openFileSysStorage(t.dir, compactThreshold)
+	t.Require().NoError(err)
+	t.T().Cleanup(func() {
+		s.journal.close()
+	})
+	return s
+}
+
+func (t *TestFileSysStorage) fill(s IStorage) {
+	t.Require().NoError(s.AddUser(t.ctx, "test"))
+	t.Require().NoError(s.AddFolder(t.ctx, "test", "folder1", "desc1"))
+	t.Require().NoError(s.AddFolder(t.ctx, "test", "folder2", "desc2"))
+	t.Require().NoError(s.AddFile(t.ctx, "test", "folder1", "file1", "desc1"))
+	t.Require().NoError(s.AddFile(t.ctx, "test", "folder1", "file2", "desc2"))
+	t.Require().NoError(s.DeleteFile(t.ctx, "test", "folder1", "file2"))
+	t.Require().NoError(s.RenameFolder(t.ctx, "test", "folder2", "newfolder"))
+}
+
+func (t *TestFileSysStorage) check(s IStorage) {
+	t.True(s.IsExistUser(t.ctx, "test"))
+	t.True(s.IsExistFolder(t.ctx, "test", "folder1"))
+	t.False(s.IsExistFolder(t.ctx, "test", "folder2"))
+	t.True(s.IsExistFolder(t.ctx, "test", "newfolder"))
+	t.True(s.IsExistFile(t.ctx, "test", "folder1", "file1"))
+	t.False(s.IsExistFile(t.ctx, "test", "folder1", "file2"))
+	folders, err := s.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal(2, len(folders))
+	t.Equal("desc1", folders[0].FolderDesc)
+	files, err := s.ListFile(t.ctx, "test", "folder1", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal(1, len(files))
+	t.Equal("file1", files[0].FileName)
+}
+
+func (t *TestFileSysStorage) TestEmptyDir() {
+	s := t.open(defaultCompactThreshold)
+	t.False(s.IsExistUser(t.ctx, "test"))
+}
+
+func (t *TestFileSysStorage) TestRejectedMutationNotJournaled() {
+	s := t.open(defaultCompactThreshold)
+	t.Require().NoError(s.AddUser(t.ctx, "test"))
+	size := s.journal.size
+	t.ErrorIs(s.AddUser(t.ctx, "test"), ErrUserExists)
+	t.ErrorIs(s.AddFolder(t.ctx, "nobody", "folder", "desc"), ErrUserNotFound)
+	t.ErrorIs(s.DeleteFolder(t.ctx, "test", "folder"), ErrFolderNotFound)
+	t.Equal(size, s.journal.size)
+}
+
+func (t *TestFileSysStorage) TestJournalRequestContext() {
+	s := t.open(defaultCompactThreshold)
+	ctx := WithTraceID(WithActor(t.ctx, "test"), "trace")
+	t.Require().NoError(s.AddUser(ctx, "test"))
+	s.journal.close()
+
+	records := []mutation{}
+	j, err := openJournal(filepath.Join(t.dir, journalFileName), func(m mutation) error {
+		records = append(records, m)
+		return nil
+	})
+	t.Require().NoError(err)
+	defer j.close()
+	t.Equal(1, len(records))
+	t.Equal("test", records[0].Actor)
+	t.Equal("trace", records[0].TraceID)
+}
+
+func (t *TestFileSysStorage) TestCreateDir() {
+	t.dir = filepath.Join(t.dir, "data")
+	s := t.open(defaultCompactThreshold)
+	t.Require().NoError(s.AddUser(t.ctx, "test"))
+	t.FileExists(filepath.Join(t.dir, journalFileName))
+}
+
+func (t *TestFileSysStorage) TestReplayJournal() {
+	s := t.open(defaultCompactThreshold)
+	t.fill(s)
+	t.NoFileExists(filepath.Join(t.dir, snapshotFileName))
+
+	t.check(t.open(defaultCompactThreshold))
+}
+
+func (t *TestFileSysStorage) TestReplayKeepCreateTime() {
+	s := t.open(defaultCompactThreshold)
+	t.Require().NoError(s.AddUser(t.ctx, "test"))
+	t.Require().NoError(s.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.Require().NoError(s.AddFile(t.ctx, "test", "folder", "file", "desc"))
+	folders, err := s.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	files, err := s.ListFile(t.ctx, "test", "folder", "name", "asc")
+	t.Require().NoError(err)
+
+	s = t.open(defaultCompactThreshold)
+	reloadFolders, err := s.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal(folders, reloadFolders)
+	reloadFiles, err := s.ListFile(t.ctx, "test", "folder", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal(files, reloadFiles)
+}
+
+func (t *TestFileSysStorage) TestReloadAfterClose() {
+	s := t.open(defaultCompactThreshold)
+	t.fill(s)
+	t.NoError(s.Close())
+	t.FileExists(filepath.Join(t.dir, snapshotFileName))
+	info, err := os.Stat(filepath.Join(t.dir, journalFileName))
+	t.Require().NoError(err)
+	t.Equal(int64(0), info.Size())
+
+	t.check(t.open(defaultCompactThreshold))
+}
+
+func (t *TestFileSysStorage) TestReloadKeepCase() {
+	s := t.open(defaultCompactThreshold)
+	t.Require().NoError(s.AddUser(t.ctx, "Alice"))
+	t.Require().NoError(s.AddFolder(t.ctx, "alice", "project", "desc"))
+	t.Require().NoError(s.RenameFolder(t.ctx, "ALICE", "PROJECT", "MyProject"))
+	t.Require().NoError(s.AddFile(t.ctx, "alice", "myproject", "ReadMe", "desc"))
+	check := func(s IStorage) {
+		users, err := s.ListUser(t.ctx)
+		t.Require().NoError(err)
+		t.Equal([]string{"Alice"}, users)
+		folders, err := s.ListFolder(t.ctx, "alice", "name", "asc")
+		t.Require().NoError(err)
+		t.Require().Len(folders, 1)
+		t.Equal("Alice", folders[0].UserName)
+		t.Equal("MyProject", folders[0].FolderName)
+		t.True(s.IsExistFile(t.ctx, "alice", "myproject", "readme"))
+	}
+	// replayed from the journal, then from the snapshot
+	check(t.open(defaultCompactThreshold))
+	t.NoError(s.Close())
+	check(t.open(defaultCompactThreshold))
+}
+
+func (t *TestFileSysStorage) TestCompact() {
+	s := t.open(1)
+	t.fill(s)
+	t.FileExists(filepath.Join(t.dir, snapshotFileName))
+	t.Equal(int64(0), s.journal.size)
+
+	t.check(t.open(1))
+}
+
+func (t *TestFileSysStorage) TestCompactOnOpen() {
+	s := t.open(defaultCompactThreshold)
+	t.fill(s)
+
+	s = t.open(1)
+	t.Equal(int64(0), s.journal.size)
+	t.check(s)
+}
+
+func (t *TestFileSysStorage) TestReplaySkipSnapshotRecords() {
+	s := t.open(defaultCompactThreshold)
+	t.fill(s)
+	// crash after saving the snapshot but before resetting the journal
+	t.Require().NoError(s.save())
+
+	s = t.open(defaultCompactThreshold)
+	t.check(s)
+}
+
+func (t *TestFileSysStorage) TestReloadDeleteFolder() {
+	s := t.open(defaultCompactThreshold)
+	t.Require().NoError(s.AddUser(t.ctx, "test"))
+	t.Require().NoError(s.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.Require().NoError(s.AddFile(t.ctx, "test", "folder", "file", "desc"))
+	t.Require().NoError(s.DeleteFolder(t.ctx, "test", "folder"))
+
+	s = t.open(defaultCompactThreshold)
+	t.True(s.IsExistUser(t.ctx, "test"))
+	t.False(s.IsExistFolder(t.ctx, "test", "folder"))
+	t.False(s.IsExistFile(t.ctx, "test", "folder", "file"))
+	folders, err := s.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal(0, len(folders))
+}
+
+func (t *TestFileSysStorage) TestTornJournalRecord() {
+	s := t.open(defaultCompactThreshold)
+	t.fill(s)
+	t.Require().NoError(s.AddFolder(t.ctx, "test", "torn", "desc"))
+	size := s.journal.size
+	path := filepath.Join(t.dir, journalFileName)
+	// cut the last record in half
+	t.Require().NoError(os.Truncate(path, size-5))
+
+	s = t.open(defaultCompactThreshold)
+	t.check(s)
+	t.False(s.IsExistFolder(t.ctx, "test", "torn"))
+	info, err := os.Stat(path)
+	t.Require().NoError(err)
+	t.Equal(s.journal.size, info.Size())
+
+	// new records append after the truncated tail
+	t.Require().NoError(s.AddFolder(t.ctx, "test", "folder3", "desc3"))
+	s = t.open(defaultCompactThreshold)
+	t.True(s.IsExistFolder(t.ctx, "test", "folder3"))
+}
+
+func (t *TestFileSysStorage) TestTornJournalChecksum() {
+	s := t.open(defaultCompactThreshold)
+	t.fill(s)
+	t.Require().NoError(s.AddFolder(t.ctx, "test", "torn", "desc"))
+	path := filepath.Join(t.dir, journalFileName)
+	b, err := os.ReadFile(path)
+	t.Require().NoError(err)
+	b[len(b)-2] ^= 0xff
+	t.Require().NoError(os.WriteFile(path, b, 0o644))
+
+	s = t.open(defaultCompactThreshold)
+	t.check(s)
+	t.False(s.IsExistFolder(t.ctx, "test", "torn"))
+}
+
+func (t *TestFileSysStorage) TestCorruptJournal() {
+	s := t.open(defaultCompactThreshold)
+	t.fill(s)
+	path := filepath.Join(t.dir, journalFileName)
+	b, err := os.ReadFile(path)
+	t.Require().NoError(err)
+	b[journalHeaderSize+1] ^= 0xff
+	t.Require().NoError(os.WriteFile(path, b, 0o644))
+
+	_, err = NewFileSysStorage(t.dir)
+	t.ErrorIs(err, errCorruptJournal)
+}
+
+func (t *TestFileSysStorage) TestCorruptJournalLength() {
+	s := t.open(defaultCompactThreshold)
+	t.fill(s)
+	path := filepath.Join(t.dir, journalFileName)
+	b, err := os.ReadFile(path)
+	t.Require().NoError(err)
+	binary.LittleEndian.PutUint32(b[0:4], 0xfffffff0)
+	t.Require().NoError(os.WriteFile(path, b, 0o644))
+
+	_, err = NewFileSysStorage(t.dir)
+	t.ErrorIs(err, errCorruptJournal)
+	after, err := os.ReadFile(path)
+	t.Require().NoError(err)
+	t.Equal(b, after)
+}
+
+func (t *TestFileSysStorage) TestConcurrentCommit() {
+	s := t.open(512)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(userName string) {
+			defer wg.Done()
+			t.NoError(s.AddUser(t.ctx, userName))
+			for j := 0; j < 20; j++ {
+				t.NoError(s.AddFolder(t.ctx, userName, fmt.Sprint("folder", j), "desc"))
+			}
+		}(fmt.Sprint("user", i))
+	}
+	wg.Wait()
+	t.Require().NoError(s.Close())
+
+	// every commit survives the compactions run alongside
+	s = t.open(defaultCompactThreshold)
+	for i := 0; i < 8; i++ {
+		folders, err := s.ListFolder(t.ctx, fmt.Sprint("user", i), "name", "asc")
+		t.Require().NoError(err)
+		t.Len(folders, 20)
+	}
+}
+
+func (t *TestFileSysStorage) TestNoTempFilesLeft() {
+	s := t.open(1)
+	t.Require().NoError(s.AddUser(t.ctx, "test"))
+	t.Require().NoError(s.AddFolder(t.ctx, "test", "folder", "desc"))
+	entries, err := os.ReadDir(t.dir)
+	t.Require().NoError(err)
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	t.ElementsMatch([]string{journalFileName, snapshotFileName}, names)
+}
+
+func (t *TestFileSysStorage) TestCorruptSnapshot() {
+	err := os.WriteFile(filepath.Join(t.dir, snapshotFileName), []byte("{"), 0o644)
+	t.Require().NoError(err)
+	_, err = NewFileSysStorage(t.dir)
+	t.Error(err)
+}
+
+func (t *TestFileSysStorage) TestUnsupportedVersion() {
+	err := os.WriteFile(filepath.Join(t.dir, snapshotFileName), []byte(`{"version":99}`), 0o644)
+	t.Require().NoError(err)
+	_, err = NewFileSysStorage(t.dir)
+	t.Error(err)
+}
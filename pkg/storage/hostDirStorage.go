@@ -0,0 +1,571 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metaDirName holds the sidecar metadata under the root. It's rejected as
+// a name, so it can't clash with a user.
+const metaDirName = ".goREPL"
+
+// HostDirStorage maps the virtual file system onto a real directory tree:
+// root/user/folder/file, with every file an empty regular file. Descriptions
+// and creation times live in a sidecar file per user under root/.goREPL.
+//
+// The directory tree is the source of truth, entries made by other tools
+// show up with their modification time and no description. Names are kept
+// as given and match by NameKey, like the REPL expects, even on a
+// case-sensitive file system.
+//
+// Every call lists the directories on its path to match the names, under
+// one lock. A cache of the listings would go stale as soon as another tool
+// changes the tree, so the cost of a lookup grows with the entries of a
+// directory instead.
+type HostDirStorage struct {
+	mu   sync.Mutex
+	root string
+}
+
+// hostDirMeta is the sidecar metadata of a user, keyed by NameKey.
+type hostDirMeta struct {
+	Folders map[string]*hostDirMetaEntry `json:"folders"`
+}
+
+type hostDirMetaEntry struct {
+	Desc       string                       `json:"desc,omitempty"`
+	CreateTime int64                        `json:"createTime"`
+	Files      map[string]*hostDirMetaEntry `json:"files,omitempty"`
+}
+
+// NewHostDirStorage serves the directory tree under root, creating root
+// when missing.
+func NewHostDirStorage(root string) (IStorage, error) {
+	err := os.MkdirAll(filepath.Join(root, metaDirName), 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("create root dir: %w", err)
+	}
+	return &HostDirStorage{root: root}, nil
+}
+
+func (h *HostDirStorage) AddUser(ctx context.Context, userName string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	err := checkNames(ctx, userName)
+	if err != nil {
+		return err
+	}
+	_, ok, err := lookupEntry(h.root, userName, true)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return ErrUserExists
+	}
+	return os.Mkdir(filepath.Join(h.root, userName), 0o755)
+}
+
+func (h *HostDirStorage) IsExistUser(ctx context.Context, userName string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err := h.userPath(ctx, userName)
+	return err == nil
+}
+
+func (h *HostDirStorage) ListUser(ctx context.Context) ([]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entries, err := readEntries(h.root, true)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]string, 0, len(entries))
+	for _, e := range entries {
+		users = append(users, e.name)
+	}
+	sortNames(users)
+	return users, nil
+}
+
+func (h *HostDirStorage) AddFolder(ctx context.Context, userName, folderName, folderDesc string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	userPath, err := h.userPath(ctx, userName, folderName)
+	if err != nil {
+		return err
+	}
+	_, ok, err := lookupEntry(userPath, folderName, true)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return ErrFolderExists
+	}
+	err = os.Mkdir(filepath.Join(userPath, folderName), 0o755)
+	if err != nil {
+		return err
+	}
+	return h.updateMeta(userName, func(meta *hostDirMeta) {
+		meta.Folders[NameKey(folderName)] = &hostDirMetaEntry{
+			Desc:       folderDesc,
+			CreateTime: time.Now().Unix(),
+		}
+	})
+}
+
+func (h *HostDirStorage) DeleteFolder(ctx context.Context, userName, folderName string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	folderPath, err := h.folderPath(ctx, userName, folderName)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(folderPath)
+	if err != nil {
+		return err
+	}
+	return h.updateMeta(userName, func(meta *hostDirMeta) {
+		delete(meta.Folders, NameKey(folderName))
+	})
+}
+
+func (h *HostDirStorage) RenameFolder(ctx context.Context, userName, folderName, newFolderName string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	err := checkNames(ctx, newFolderName)
+	if err != nil {
+		return err
+	}
+	folderPath, err := h.folderPath(ctx, userName, folderName)
+	if err != nil {
+		return err
+	}
+	userPath := filepath.Dir(folderPath)
+	name, ok, err := lookupEntry(userPath, newFolderName, true)
+	if err != nil {
+		return err
+	}
+	// only the case of the folder itself may change
+	if ok && (NameKey(name) != NameKey(folderName) || newFolderName == filepath.Base(folderPath)) {
+		return ErrFolderExists
+	}
+	err = os.Rename(folderPath, filepath.Join(userPath, newFolderName))
+	if err != nil {
+		return err
+	}
+	return h.updateMeta(userName, func(meta *hostDirMeta) {
+		key := NameKey(folderName)
+		if e, ok := meta.Folders[key]; ok {
+			delete(meta.Folders, key)
+			meta.Folders[NameKey(newFolderName)] = e
+		}
+	})
+}
+
+func (h *HostDirStorage) IsExistFolder(ctx context.Context, userName, folderName string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err := h.folderPath(ctx, userName, folderName)
+	return err == nil
+}
+
+func (h *HostDirStorage) ListFolder(ctx context.Context, userName, sortName, orderBy string) ([]VirtualFileSysEntity, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	userPath, err := h.userPath(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readEntries(userPath, true)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := h.loadMeta(userName)
+	if err != nil {
+		return nil, err
+	}
+	folders := make([]VirtualFileSysEntity, 0, len(entries))
+	for _, e := range entries {
+		folder := VirtualFileSysEntity{
+			UserName:         filepath.Base(userPath),
+			FolderName:       e.name,
+			FolderCreateTime: e.modTime,
+		}
+		if m, ok := meta.Folders[NameKey(e.name)]; ok {
+			folder.FolderDesc = m.Desc
+			folder.FolderCreateTime = m.CreateTime
+		}
+		folders = append(folders, folder)
+	}
+
+	sort.Slice(folders, func(i, j int) bool {
+		a, b := folders[i], folders[j]
+		if orderBy == "desc" {
+			a, b = b, a
+		}
+		if sortName == "create" && a.FolderCreateTime != b.FolderCreateTime {
+			return a.FolderCreateTime < b.FolderCreateTime
+		}
+		return lessName(a.FolderName, b.FolderName)
+	})
+	return folders, nil
+}
+
+func (h *HostDirStorage) IsExistFile(ctx context.Context, userName, folderName, fileName string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err := h.filePath(ctx, userName, folderName, fileName)
+	return err == nil
+}
+
+func (h *HostDirStorage) AddFile(ctx context.Context, userName, folderName, fileName, fileDesc string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	folderPath, err := h.folderPath(ctx, userName, folderName, fileName)
+	if err != nil {
+		return err
+	}
+	_, ok, err := lookupEntry(folderPath, fileName, false)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return ErrFileExists
+	}
+	f, err := os.OpenFile(filepath.Join(folderPath, fileName), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return h.updateMeta(userName, func(meta *hostDirMeta) {
+		folder := meta.folder(NameKey(folderName))
+		folder.Files[NameKey(fileName)] = &hostDirMetaEntry{
+			Desc:       fileDesc,
+			CreateTime: time.Now().Unix(),
+		}
+	})
+}
+
+func (h *HostDirStorage) DeleteFile(ctx context.Context, userName, folderName, fileName string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	filePath, err := h.filePath(ctx, userName, folderName, fileName)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filePath)
+	if err != nil {
+		return err
+	}
+	return h.updateMeta(userName, func(meta *hostDirMeta) {
+		folder := meta.folder(NameKey(folderName))
+		delete(folder.Files, NameKey(fileName))
+	})
+}
+
+func (h *HostDirStorage) ListFile(ctx context.Context, userName, folderName, sortName, orderBy string) ([]VirtualFileSysFileEntity, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	folderPath, err := h.folderPath(ctx, userName, folderName)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readEntries(folderPath, false)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := h.loadMeta(userName)
+	if err != nil {
+		return nil, err
+	}
+	folder := meta.folder(NameKey(folderName))
+	files := make([]VirtualFileSysFileEntity, 0, len(entries))
+	for _, e := range entries {
+		file := VirtualFileSysFileEntity{
+			FileName:       e.name,
+			FileCreateTime: e.modTime,
+		}
+		if m, ok := folder.Files[NameKey(e.name)]; ok {
+			file.FileDesc = m.Desc
+			file.FileCreateTime = m.CreateTime
+		}
+		files = append(files, file)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if orderBy == "desc" {
+			a, b = b, a
+		}
+		if sortName == "create" && a.FileCreateTime != b.FileCreateTime {
+			return a.FileCreateTime < b.FileCreateTime
+		}
+		return lessName(a.FileName, b.FileName)
+	})
+	return files, nil
+}
+
+func (h *HostDirStorage) GetUser(ctx context.Context, userName string) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	userPath, err := h.userPath(ctx, userName)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(userPath), nil
+}
+
+func (h *HostDirStorage) GetFolder(ctx context.Context, userName, folderName string) (VirtualFileSysEntity, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	folderPath, err := h.folderPath(ctx, userName, folderName)
+	if err != nil {
+		return VirtualFileSysEntity{}, err
+	}
+	info, err := os.Stat(folderPath)
+	if err != nil {
+		return VirtualFileSysEntity{}, err
+	}
+	meta, err := h.loadMeta(userName)
+	if err != nil {
+		return VirtualFileSysEntity{}, err
+	}
+	folder := VirtualFileSysEntity{
+		UserName:         filepath.Base(filepath.Dir(folderPath)),
+		FolderName:       info.Name(),
+		FolderCreateTime: info.ModTime().Unix(),
+	}
+	if m, ok := meta.Folders[NameKey(folderName)]; ok {
+		folder.FolderDesc = m.Desc
+		folder.FolderCreateTime = m.CreateTime
+	}
+	return folder, nil
+}
+
+func (h *HostDirStorage) GetFile(ctx context.Context, userName, folderName, fileName string) (VirtualFileSysFileEntity, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	filePath, err := h.filePath(ctx, userName, folderName, fileName)
+	if err != nil {
+		return VirtualFileSysFileEntity{}, err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return VirtualFileSysFileEntity{}, err
+	}
+	meta, err := h.loadMeta(userName)
+	if err != nil {
+		return VirtualFileSysFileEntity{}, err
+	}
+	file := VirtualFileSysFileEntity{
+		FileName:       info.Name(),
+		FileCreateTime: info.ModTime().Unix(),
+	}
+	if m, ok := meta.folder(NameKey(folderName)).Files[NameKey(fileName)]; ok {
+		file.FileDesc = m.Desc
+		file.FileCreateTime = m.CreateTime
+	}
+	return file, nil
+}
+
+// userPath checks ctx and the names, and returns the directory of the user.
+// The names after userName are only checked.
+func (h *HostDirStorage) userPath(ctx context.Context, userName string, names ...string) (string, error) {
+	err := checkNames(ctx, append([]string{userName}, names...)...)
+	if err != nil {
+		return "", err
+	}
+	name, ok, err := lookupEntry(h.root, userName, true)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrUserNotFound
+	}
+	return filepath.Join(h.root, name), nil
+}
+
+// folderPath returns the directory of the folder, like userPath.
+func (h *HostDirStorage) folderPath(ctx context.Context, userName, folderName string, names ...string) (string, error) {
+	userPath, err := h.userPath(ctx, userName, append([]string{folderName}, names...)...)
+	if err != nil {
+		return "", err
+	}
+	name, ok, err := lookupEntry(userPath, folderName, true)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrFolderNotFound
+	}
+	return filepath.Join(userPath, name), nil
+}
+
+// filePath returns the path of the file, like userPath.
+func (h *HostDirStorage) filePath(ctx context.Context, userName, folderName, fileName string) (string, error) {
+	folderPath, err := h.folderPath(ctx, userName, folderName, fileName)
+	if err != nil {
+		return "", err
+	}
+	name, ok, err := lookupEntry(folderPath, fileName, false)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrFileNotFound
+	}
+	return filepath.Join(folderPath, name), nil
+}
+
+func (h *HostDirStorage) metaPath(userName string) string {
+	return filepath.Join(h.root, metaDirName, NameKey(userName)+".json")
+}
+
+func (h *HostDirStorage) loadMeta(userName string) (*hostDirMeta, error) {
+	meta := &hostDirMeta{Folders: make(map[string]*hostDirMetaEntry)}
+	b, err := os.ReadFile(h.metaPath(userName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return meta, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read metadata: %w", err)
+	}
+	err = json.Unmarshal(b, meta)
+	if err != nil {
+		return nil, fmt.Errorf("decode metadata: %w", err)
+	}
+	if meta.Folders == nil {
+		meta.Folders = make(map[string]*hostDirMetaEntry)
+	}
+	return meta, nil
+}
+
+// updateMeta changes the metadata of a user with fn and saves it.
+func (h *HostDirStorage) updateMeta(userName string, fn func(meta *hostDirMeta)) error {
+	meta, err := h.loadMeta(userName)
+	if err != nil {
+		return err
+	}
+	fn(meta)
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("encode metadata: %w", err)
+	}
+	return writeFileAtomic(h.metaPath(userName), b)
+}
+
+// folder returns the metadata of a folder, adding it when missing.
+func (m *hostDirMeta) folder(key string) *hostDirMetaEntry {
+	e, ok := m.Folders[key]
+	if !ok {
+		e = &hostDirMetaEntry{}
+		m.Folders[key] = e
+	}
+	if e.Files == nil {
+		e.Files = make(map[string]*hostDirMetaEntry)
+	}
+	return e
+}
+
+// checkNames fails once ctx is done, and rejects names that aren't a single
+// path element, and the name of the metadata dir.
+func checkNames(ctx context.Context, names ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if name == "" || name == "." || name == ".." || isMetaDir(name) || strings.ContainsAny(name, `/\`+"\x00") {
+			return &InvalidNameError{Name: name}
+		}
+	}
+	return nil
+}
+
+// isMetaDir reports whether name is the metadata dir, in any case.
+func isMetaDir(name string) bool {
+	return NameKey(name) == NameKey(metaDirName)
+}
+
+// lookupEntry finds the entry of dir matching name by NameKey, an exact
+// match wins, and returns its name on disk. dirs selects whether
+// directories or regular files match. The name is taken from the listing,
+// as on a case-insensitive file system the one given opens the entry too.
+func lookupEntry(dir, name string, dirs bool) (string, bool, error) {
+	entries, err := readEntries(dir, dirs)
+	if err != nil {
+		return "", false, err
+	}
+	found, ok := "", false
+	for _, e := range entries {
+		if e.name == name {
+			return e.name, true, nil
+		}
+		if !ok && NameKey(e.name) == NameKey(name) {
+			found, ok = e.name, true
+		}
+	}
+	return found, ok, nil
+}
+
+type hostDirEntry struct {
+	name    string
+	modTime int64
+}
+
+// readEntries lists the directories, or the regular files, of dir sorted
+// by name, leaving out the metadata dir.
+func readEntries(dir string, dirs bool) ([]hostDirEntry, error) {
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]hostDirEntry, 0, len(des))
+	for _, de := range des {
+		if isMetaDir(de.Name()) {
+			continue
+		}
+		if dirs != de.IsDir() || !dirs && !de.Type().IsRegular() {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			// removed meanwhile by another tool
+			continue
+		}
+		entries = append(entries, hostDirEntry{
+			name:    de.Name(),
+			modTime: info.ModTime().Unix(),
+		})
+	}
+	return entries, nil
+}
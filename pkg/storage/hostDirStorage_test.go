@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TestHostDirStorage struct {
+	suite.Suite
+
+	root string
+	ctx  context.Context
+	s    IStorage
+}
+
+func TestHostDirStorageSuite(t *testing.T) {
+	suite.Run(t, new(TestHostDirStorage))
+}
+
+func (t *TestHostDirStorage) SetupTest() {
+	t.ctx = context.Background()
+	t.root = filepath.Join(t.T().TempDir(), "root")
+	t.s = t.open()
+}
+
+func (t *TestHostDirStorage) open() IStorage {
+	s, err := NewHostDirStorage(t.root)
+	t.Require().NoError(err)
+	return s
+}
+
+func (t *TestHostDirStorage) fill() {
+	t.Require().NoError(t.s.AddUser(t.ctx, "test"))
+	t.Require().NoError(t.s.AddFolder(t.ctx, "test", "folder1", "desc1"))
+	t.Require().NoError(t.s.AddFile(t.ctx, "test", "folder1", "file1", "desc2"))
+}
+
+func (t *TestHostDirStorage) TestLayout() {
+	t.fill()
+	info, err := os.Stat(filepath.Join(t.root, "test", "folder1"))
+	t.Require().NoError(err)
+	t.True(info.IsDir())
+	info, err = os.Stat(filepath.Join(t.root, "test", "folder1", "file1"))
+	t.Require().NoError(err)
+	t.True(info.Mode().IsRegular())
+	_, err = os.Stat(filepath.Join(t.root, metaDirName, "test.json"))
+	t.NoError(err)
+
+	t.NoError(t.s.RenameFolder(t.ctx, "test", "folder1", "folder2"))
+	_, err = os.Stat(filepath.Join(t.root, "test", "folder2", "file1"))
+	t.NoError(err)
+	t.NoError(t.s.DeleteFolder(t.ctx, "test", "folder2"))
+	_, err = os.Stat(filepath.Join(t.root, "test", "folder2"))
+	t.True(os.IsNotExist(err))
+}
+
+func (t *TestHostDirStorage) TestReopen() {
+	t.fill()
+	s := t.open()
+	folders, err := s.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	t.Require().Len(folders, 1)
+	t.Equal("desc1", folders[0].FolderDesc)
+	files, err := s.ListFile(t.ctx, "test", "folder1", "name", "asc")
+	t.Require().NoError(err)
+	t.Require().Len(files, 1)
+	t.Equal("desc2", files[0].FileDesc)
+}
+
+func (t *TestHostDirStorage) TestInvalidName() {
+	t.fill()
+	for _, name := range []string{"", ".", "..", "../x", "a/b", `a\b`, metaDirName, ".GOREPL", "a\x00b"} {
+		t.ErrorIs(t.s.AddUser(t.ctx, name), ErrInvalidName, name)
+		t.ErrorIs(t.s.AddFolder(t.ctx, "test", name, "desc"), ErrInvalidName, name)
+		t.ErrorIs(t.s.RenameFolder(t.ctx, "test", "folder1", name), ErrInvalidName, name)
+		t.ErrorIs(t.s.AddFile(t.ctx, "test", "folder1", name, "desc"), ErrInvalidName, name)
+		t.ErrorIs(t.s.DeleteFile(t.ctx, "test", "folder1", name), ErrInvalidName, name)
+		t.False(t.s.IsExistFolder(t.ctx, name, "folder1"), name)
+		_, err := t.s.ListFolder(t.ctx, name, "name", "asc")
+		t.ErrorIs(err, ErrInvalidName, name)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(t.root))
+	t.Require().NoError(err)
+	t.Len(entries, 1, "nothing is created next to root")
+	t.True(t.s.IsExistFile(t.ctx, "test", "folder1", "file1"))
+}
+
+func (t *TestHostDirStorage) TestHiddenName() {
+	t.fill()
+	t.NoError(t.s.AddFolder(t.ctx, "test", ".hidden", "desc"))
+	t.NoError(t.s.AddFile(t.ctx, "test", ".hidden", ".file", "desc"))
+	t.True(t.s.IsExistFile(t.ctx, "test", ".hidden", ".file"))
+	folders, err := t.s.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	t.Require().Len(folders, 2)
+	t.Equal(".hidden", folders[0].FolderName)
+	// the metadata dir isn't a user
+	users, err := t.s.ListUser(t.ctx)
+	t.Require().NoError(err)
+	t.Equal([]string{"test"}, users)
+}
+
+func (t *TestHostDirStorage) TestCaseOnDisk() {
+	t.Require().NoError(os.MkdirAll(filepath.Join(t.root, "Test", "Folder1"), 0o755))
+	t.Require().NoError(os.WriteFile(filepath.Join(t.root, "Test", "Folder1", "File1"), nil, 0o644))
+
+	t.True(t.s.IsExistUser(t.ctx, "test"))
+	t.True(t.s.IsExistFolder(t.ctx, "TEST", "folder1"))
+	t.True(t.s.IsExistFile(t.ctx, "test", "FOLDER1", "file1"))
+	t.ErrorIs(t.s.AddUser(t.ctx, "test"), ErrUserExists)
+	t.ErrorIs(t.s.AddFolder(t.ctx, "test", "folder1", "desc"), ErrFolderExists)
+	t.ErrorIs(t.s.AddFile(t.ctx, "test", "folder1", "file1", "desc"), ErrFileExists)
+
+	folders, err := t.s.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	t.Require().Len(folders, 1)
+	t.Equal("Folder1", folders[0].FolderName)
+	t.NoError(t.s.DeleteFile(t.ctx, "test", "folder1", "FILE1"))
+	_, err = os.Stat(filepath.Join(t.root, "Test", "Folder1", "File1"))
+	t.True(os.IsNotExist(err))
+	t.NoError(t.s.RenameFolder(t.ctx, "test", "folder1", "FOLDER1"))
+	t.DirExists(filepath.Join(t.root, "Test", "FOLDER1"))
+}
+
+func (t *TestHostDirStorage) TestLookupEntry() {
+	dir := filepath.Join(t.root, "dir")
+	t.Require().NoError(os.MkdirAll(filepath.Join(dir, "Docs"), 0o755))
+	t.Require().NoError(os.WriteFile(filepath.Join(dir, "Notes"), nil, 0o644))
+
+	// the name on disk, whatever the case given
+	name, ok, err := lookupEntry(dir, "DOCS", true)
+	t.Require().NoError(err)
+	t.True(ok)
+	t.Equal("Docs", name)
+	name, ok, err = lookupEntry(dir, "notes", false)
+	t.Require().NoError(err)
+	t.True(ok)
+	t.Equal("Notes", name)
+	_, ok, err = lookupEntry(dir, "notes", true)
+	t.Require().NoError(err)
+	t.False(ok)
+
+	// an exact match wins
+	t.Require().NoError(os.Mkdir(filepath.Join(dir, "docs"), 0o755))
+	name, ok, err = lookupEntry(dir, "docs", true)
+	t.Require().NoError(err)
+	t.True(ok)
+	t.Equal("docs", name)
+}
+
+func (t *TestHostDirStorage) TestOtherTools() {
+	t.fill()
+	modTime := time.Unix(1700000000, 0)
+	dir := filepath.Join(t.root, "test", "other")
+	t.Require().NoError(os.Mkdir(dir, 0o755))
+	t.Require().NoError(os.Chtimes(dir, modTime, modTime))
+	file := filepath.Join(t.root, "test", "folder1", "other")
+	t.Require().NoError(os.WriteFile(file, nil, 0o644))
+	t.Require().NoError(os.Chtimes(file, modTime, modTime))
+
+	folders, err := t.s.ListFolder(t.ctx, "test", "create", "asc")
+	t.Require().NoError(err)
+	t.Require().Len(folders, 2)
+	t.Equal("other", folders[0].FolderName)
+	t.Equal(modTime.Unix(), folders[0].FolderCreateTime)
+	t.Empty(folders[0].FolderDesc)
+	files, err := t.s.ListFile(t.ctx, "test", "folder1", "create", "asc")
+	t.Require().NoError(err)
+	t.Require().Len(files, 2)
+	t.Equal("other", files[0].FileName)
+	t.Equal(modTime.Unix(), files[0].FileCreateTime)
+
+	// a folder removed behind its back is gone, adding it again replaces
+	// the stale metadata
+	t.Require().NoError(os.RemoveAll(filepath.Join(t.root, "test", "folder1")))
+	t.False(t.s.IsExistFolder(t.ctx, "test", "folder1"))
+	t.NoError(t.s.AddFolder(t.ctx, "test", "folder1", "desc3"))
+	folders, err = t.s.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal("desc3", folders[0].FolderDesc)
+}
+
+func (t *TestHostDirStorage) TestSkipOther() {
+	t.fill()
+	outside := t.T().TempDir()
+	t.Require().NoError(os.Symlink(outside, filepath.Join(t.root, "link")))
+	t.Require().NoError(os.Symlink(outside, filepath.Join(t.root, "test", "link")))
+	t.Require().NoError(os.Symlink(filepath.Join(t.root, "test", "folder1", "file1"),
+		filepath.Join(t.root, "test", "folder1", "link")))
+	t.Require().NoError(os.WriteFile(filepath.Join(t.root, "test", "file"), nil, 0o644))
+	t.Require().NoError(os.Mkdir(filepath.Join(t.root, "test", "folder1", "dir"), 0o755))
+
+	t.False(t.s.IsExistUser(t.ctx, "link"))
+	t.False(t.s.IsExistFolder(t.ctx, "test", "link"))
+	t.False(t.s.IsExistFolder(t.ctx, "test", "file"))
+	t.False(t.s.IsExistFile(t.ctx, "test", "folder1", "link"))
+	t.False(t.s.IsExistFile(t.ctx, "test", "folder1", "dir"))
+	folders, err := t.s.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	t.Len(folders, 1)
+	files, err := t.s.ListFile(t.ctx, "test", "folder1", "name", "asc")
+	t.Require().NoError(err)
+	t.Len(files, 1)
+}
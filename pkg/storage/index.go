@@ -0,0 +1,124 @@
+package storage
+
+const (
+	// maxIndexLevel with a 1/4 promotion chance keeps searches
+	// logarithmic far beyond a few million items
+	maxIndexLevel = 16
+)
+
+// orderedIndex is a skip list keeping its items sorted by less, so they can
+// be listed in order without sorting. Insert and delete take O(log n).
+// Items must be unique under less.
+type orderedIndex[T any] struct {
+	less  func(a, b T) bool
+	head  indexNode[T]
+	level int
+	len   int
+	seed  uint64
+}
+
+type indexNode[T any] struct {
+	item T
+	next []*indexNode[T]
+}
+
+func newOrderedIndex[T any](less func(a, b T) bool) *orderedIndex[T] {
+	x := &orderedIndex[T]{
+		less:  less,
+		level: 1,
+		seed:  0x9e3779b97f4a7c15,
+	}
+	x.head.next = make([]*indexNode[T], maxIndexLevel)
+	return x
+}
+
+// Len returns the number of items.
+func (x *orderedIndex[T]) Len() int {
+	return x.len
+}
+
+// insert adds item, which must not be in x yet.
+func (x *orderedIndex[T]) insert(item T) {
+	var update [maxIndexLevel]*indexNode[T]
+	n := &x.head
+	for l := x.level - 1; l >= 0; l-- {
+		for n.next[l] != nil && x.less(n.next[l].item, item) {
+			n = n.next[l]
+		}
+		update[l] = n
+	}
+
+	level := x.randomLevel()
+	if level > x.level {
+		for l := x.level; l < level; l++ {
+			update[l] = &x.head
+		}
+		x.level = level
+	}
+	node := &indexNode[T]{
+		item: item,
+		next: make([]*indexNode[T], level),
+	}
+	for l := 0; l < level; l++ {
+		node.next[l] = update[l].next[l]
+		update[l].next[l] = node
+	}
+	x.len++
+}
+
+// delete removes item and reports whether it was in x.
+func (x *orderedIndex[T]) delete(item T) bool {
+	var update [maxIndexLevel]*indexNode[T]
+	n := &x.head
+	for l := x.level - 1; l >= 0; l-- {
+		for n.next[l] != nil && x.less(n.next[l].item, item) {
+			n = n.next[l]
+		}
+		update[l] = n
+	}
+
+	node := n.next[0]
+	// node isn't less than item, it is item unless item is less than it
+	if node == nil || x.less(item, node.item) {
+		return false
+	}
+	for l := 0; l < len(node.next); l++ {
+		update[l].next[l] = node.next[l]
+	}
+	for x.level > 1 && x.head.next[x.level-1] == nil {
+		x.level--
+	}
+	x.len--
+	return true
+}
+
+// ascend calls fn for every item in order until fn returns false.
+func (x *orderedIndex[T]) ascend(fn func(T) bool) {
+	for n := x.head.next[0]; n != nil; n = n.next[0] {
+		if !fn(n.item) {
+			return
+		}
+	}
+}
+
+// reverse reverses items in place.
+func reverse[T any](items []T) {
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+}
+
+// randomLevel picks the height of a new node, each level above the first
+// with a chance of 1/4. A xorshift keeps it cheap and free of locking.
+func (x *orderedIndex[T]) randomLevel() int {
+	x.seed ^= x.seed << 13
+	x.seed ^= x.seed >> 7
+	x.seed ^= x.seed << 17
+	r := x.seed
+	level := 1
+	for level < maxIndexLevel && r&3 == 0 {
+		level++
+		r >>= 2
+	}
+	return level
+}
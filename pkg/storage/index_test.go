@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TestOrderedIndex struct {
+	suite.Suite
+}
+
+func TestOrderedIndexSuite(t *testing.T) {
+	suite.Run(t, new(TestOrderedIndex))
+}
+
+func (t *TestOrderedIndex) list(x *orderedIndex[int]) []int {
+	items := []int{}
+	x.ascend(func(item int) bool {
+		items = append(items, item)
+		return true
+	})
+	return items
+}
+
+func (t *TestOrderedIndex) TestInsertDelete() {
+	x := newOrderedIndex(func(a, b int) bool { return a < b })
+	for _, i := range []int{5, 1, 3, 4, 2} {
+		x.insert(i)
+	}
+	t.Equal([]int{1, 2, 3, 4, 5}, t.list(x))
+	t.True(x.delete(3))
+	t.False(x.delete(3))
+	t.False(x.delete(9))
+	t.Equal([]int{1, 2, 4, 5}, t.list(x))
+	t.Equal(4, x.Len())
+}
+
+func (t *TestOrderedIndex) TestAscendStop() {
+	x := newOrderedIndex(func(a, b int) bool { return a < b })
+	for i := 0; i < 10; i++ {
+		x.insert(i)
+	}
+	n := 0
+	x.ascend(func(item int) bool {
+		n++
+		return item < 4
+	})
+	t.Equal(5, n)
+}
+
+// TestRandomOps checks the index against a sorted slice.
+func (t *TestOrderedIndex) TestRandomOps() {
+	x := newOrderedIndex(func(a, b int) bool { return a < b })
+	model := map[int]bool{}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		item := rnd.Intn(2000)
+		if model[item] {
+			t.Require().True(x.delete(item))
+			delete(model, item)
+		} else {
+			x.insert(item)
+			model[item] = true
+		}
+	}
+	want := []int{}
+	for item := range model {
+		want = append(want, item)
+	}
+	sort.Ints(want)
+	t.Equal(want, t.list(x))
+	t.Equal(len(want), x.Len())
+
+	for _, item := range want {
+		t.Require().True(x.delete(item))
+	}
+	t.Equal(0, x.Len())
+	t.Equal(1, x.level)
+}
+
+func (t *TestOrderedIndex) TestReverse() {
+	items := []int{1, 2, 3, 4}
+	reverse(items)
+	t.Equal([]int{4, 3, 2, 1}, items)
+	reverse(items[:0])
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+)
+
+const (
+	journalFileName = "journal.log"
+	// journalHeaderSize is the length and the crc32 of the payload,
+	// both little endian uint32.
+	journalHeaderSize = 8
+	// journalMaxRecord bounds the payload of a record. A longer length
+	// can't come from append, so it marks a corrupt header, not a torn one.
+	journalMaxRecord = 1 << 26
+)
+
+var errCorruptJournal = errors.New("corrupt journal")
+
+// journal is an append-only log of mutations. Every record is framed as
+//
+//	| length uint32 | crc32 uint32 | json payload |
+//
+// and synced to disk before the mutation is applied in memory.
+type journal struct {
+	f    *os.File
+	size int64
+}
+
+// openJournal opens the journal at path and calls replay for every record
+// in it. A torn record at the end of the file, left by a crash in the middle
+// of an append, is truncated away. A broken record followed by more data
+// is real corruption and fails the open.
+func openJournal(path string, replay func(m mutation) error) (*journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+
+	var offset int64
+	for int(offset) < len(b) {
+		m, n, err := decodeJournalRecord(b[offset:])
+		if err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				log.Printf("storage: truncate torn journal record at offset %d", offset)
+				break
+			}
+			f.Close()
+			return nil, fmt.Errorf("%w at offset %d: %v", errCorruptJournal, offset, err)
+		}
+		err = replay(m)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("replay journal at offset %d: %w", offset, err)
+		}
+		offset += int64(n)
+	}
+
+	if int(offset) < len(b) {
+		err = f.Truncate(offset)
+		if err == nil {
+			err = f.Sync()
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("truncate journal: %w", err)
+		}
+	}
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("seek journal: %w", err)
+	}
+
+	return &journal{f: f, size: offset}, nil
+}
+
+// decodeJournalRecord decodes the first record of b and returns its size.
+// io.ErrUnexpectedEOF reports a record cut short by the end of b: a partial
+// header, a payload of a sane length running past the end, or a last record
+// whose checksum does not match. A length no append could have written is
+// corruption, even when it runs past the end.
+func decodeJournalRecord(b []byte) (mutation, int, error) {
+	var m mutation
+	if len(b) < journalHeaderSize {
+		return m, 0, io.ErrUnexpectedEOF
+	}
+	l := int(binary.LittleEndian.Uint32(b[0:4]))
+	sum := binary.LittleEndian.Uint32(b[4:8])
+	if l > journalMaxRecord {
+		return m, 0, fmt.Errorf("record length %d out of range", l)
+	}
+	n := journalHeaderSize + l
+	if len(b) < n {
+		return m, 0, io.ErrUnexpectedEOF
+	}
+	payload := b[journalHeaderSize:n]
+	if crc32.ChecksumIEEE(payload) != sum {
+		if len(b) == n {
+			return m, 0, io.ErrUnexpectedEOF
+		}
+		return m, 0, errors.New("checksum mismatch")
+	}
+	err := json.Unmarshal(payload, &m)
+	if err != nil {
+		return m, 0, err
+	}
+
+	return m, n, nil
+}
+
+func (j *journal) append(m mutation) error {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("encode journal record: %w", err)
+	}
+	if len(payload) > journalMaxRecord {
+		return fmt.Errorf("encode journal record: %d bytes exceed the limit", len(payload))
+	}
+	b := make([]byte, journalHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(b[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(b[4:8], crc32.ChecksumIEEE(payload))
+	copy(b[journalHeaderSize:], payload)
+
+	n, err := j.f.Write(b)
+	j.size += int64(n)
+	if err == nil {
+		err = j.f.Sync()
+	}
+	if err != nil {
+		// drop a partial write so the next record starts on a boundary
+		_ = j.reset(j.size - int64(n))
+		return fmt.Errorf("write journal: %w", err)
+	}
+
+	return nil
+}
+
+// reset truncates the journal to size, which is 0 after a compaction.
+func (j *journal) reset(size int64) error {
+	err := j.f.Truncate(size)
+	if err != nil {
+		return fmt.Errorf("truncate journal: %w", err)
+	}
+	_, err = j.f.Seek(size, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("seek journal: %w", err)
+	}
+	j.size = size
+
+	return j.f.Sync()
+}
+
+func (j *journal) close() error {
+	return j.f.Close()
+}
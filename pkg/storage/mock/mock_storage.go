@@ -5,6 +5,7 @@
 package mock
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -35,143 +36,172 @@ func (m *MockIStorage) EXPECT() *MockIStorageMockRecorder {
 }
 
 // AddFile mocks base method.
-func (m *MockIStorage) AddFile(arg0, arg1, arg2, arg3 string) {
+func (m *MockIStorage) AddFile(arg0 context.Context, arg1, arg2, arg3, arg4 string) error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "AddFile", arg0, arg1, arg2, arg3)
+	ret := m.ctrl.Call(m, "AddFile", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // AddFile indicates an expected call of AddFile.
-func (mr *MockIStorageMockRecorder) AddFile(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+func (mr *MockIStorageMockRecorder) AddFile(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddFile", reflect.TypeOf((*MockIStorage)(nil).AddFile), arg0, arg1, arg2, arg3)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddFile", reflect.TypeOf((*MockIStorage)(nil).AddFile), arg0, arg1, arg2, arg3, arg4)
 }
 
 // AddFolder mocks base method.
-func (m *MockIStorage) AddFolder(arg0, arg1, arg2 string) {
+func (m *MockIStorage) AddFolder(arg0 context.Context, arg1, arg2, arg3 string) error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "AddFolder", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "AddFolder", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // AddFolder indicates an expected call of AddFolder.
-func (mr *MockIStorageMockRecorder) AddFolder(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockIStorageMockRecorder) AddFolder(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddFolder", reflect.TypeOf((*MockIStorage)(nil).AddFolder), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddFolder", reflect.TypeOf((*MockIStorage)(nil).AddFolder), arg0, arg1, arg2, arg3)
 }
 
 // AddUser mocks base method.
-func (m *MockIStorage) AddUser(arg0 string) {
+func (m *MockIStorage) AddUser(arg0 context.Context, arg1 string) error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "AddUser", arg0)
+	ret := m.ctrl.Call(m, "AddUser", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // AddUser indicates an expected call of AddUser.
-func (mr *MockIStorageMockRecorder) AddUser(arg0 interface{}) *gomock.Call {
+func (mr *MockIStorageMockRecorder) AddUser(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUser", reflect.TypeOf((*MockIStorage)(nil).AddUser), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUser", reflect.TypeOf((*MockIStorage)(nil).AddUser), arg0, arg1)
 }
 
 // DeleteFile mocks base method.
-func (m *MockIStorage) DeleteFile(arg0, arg1, arg2 string) {
+func (m *MockIStorage) DeleteFile(arg0 context.Context, arg1, arg2, arg3 string) error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "DeleteFile", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "DeleteFile", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // DeleteFile indicates an expected call of DeleteFile.
-func (mr *MockIStorageMockRecorder) DeleteFile(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockIStorageMockRecorder) DeleteFile(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFile", reflect.TypeOf((*MockIStorage)(nil).DeleteFile), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFile", reflect.TypeOf((*MockIStorage)(nil).DeleteFile), arg0, arg1, arg2, arg3)
 }
 
 // DeleteFolder mocks base method.
-func (m *MockIStorage) DeleteFolder(arg0, arg1 string) {
+func (m *MockIStorage) DeleteFolder(arg0 context.Context, arg1, arg2 string) error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "DeleteFolder", arg0, arg1)
+	ret := m.ctrl.Call(m, "DeleteFolder", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // DeleteFolder indicates an expected call of DeleteFolder.
-func (mr *MockIStorageMockRecorder) DeleteFolder(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockIStorageMockRecorder) DeleteFolder(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFolder", reflect.TypeOf((*MockIStorage)(nil).DeleteFolder), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFolder", reflect.TypeOf((*MockIStorage)(nil).DeleteFolder), arg0, arg1, arg2)
 }
 
 // IsExistFile mocks base method.
-func (m *MockIStorage) IsExistFile(arg0, arg1, arg2 string) bool {
+func (m *MockIStorage) IsExistFile(arg0 context.Context, arg1, arg2, arg3 string) bool {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "IsExistFile", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "IsExistFile", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(bool)
 	return ret0
 }
 
 // IsExistFile indicates an expected call of IsExistFile.
-func (mr *MockIStorageMockRecorder) IsExistFile(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockIStorageMockRecorder) IsExistFile(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsExistFile", reflect.TypeOf((*MockIStorage)(nil).IsExistFile), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsExistFile", reflect.TypeOf((*MockIStorage)(nil).IsExistFile), arg0, arg1, arg2, arg3)
 }
 
 // IsExistFolder mocks base method.
-func (m *MockIStorage) IsExistFolder(arg0, arg1 string) bool {
+func (m *MockIStorage) IsExistFolder(arg0 context.Context, arg1, arg2 string) bool {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "IsExistFolder", arg0, arg1)
+	ret := m.ctrl.Call(m, "IsExistFolder", arg0, arg1, arg2)
 	ret0, _ := ret[0].(bool)
 	return ret0
 }
 
 // IsExistFolder indicates an expected call of IsExistFolder.
-func (mr *MockIStorageMockRecorder) IsExistFolder(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockIStorageMockRecorder) IsExistFolder(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsExistFolder", reflect.TypeOf((*MockIStorage)(nil).IsExistFolder), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsExistFolder", reflect.TypeOf((*MockIStorage)(nil).IsExistFolder), arg0, arg1, arg2)
 }
 
 // IsExistUser mocks base method.
-func (m *MockIStorage) IsExistUser(arg0 string) bool {
+func (m *MockIStorage) IsExistUser(arg0 context.Context, arg1 string) bool {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "IsExistUser", arg0)
+	ret := m.ctrl.Call(m, "IsExistUser", arg0, arg1)
 	ret0, _ := ret[0].(bool)
 	return ret0
 }
 
 // IsExistUser indicates an expected call of IsExistUser.
-func (mr *MockIStorageMockRecorder) IsExistUser(arg0 interface{}) *gomock.Call {
+func (mr *MockIStorageMockRecorder) IsExistUser(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsExistUser", reflect.TypeOf((*MockIStorage)(nil).IsExistUser), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsExistUser", reflect.TypeOf((*MockIStorage)(nil).IsExistUser), arg0, arg1)
 }
 
 // ListFile mocks base method.
-func (m *MockIStorage) ListFile(arg0, arg1, arg2, arg3 string) []storage.VirtualFileSysFileEntity {
+func (m *MockIStorage) ListFile(arg0 context.Context, arg1, arg2, arg3, arg4 string) ([]storage.VirtualFileSysFileEntity, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ListFile", arg0, arg1, arg2, arg3)
+	ret := m.ctrl.Call(m, "ListFile", arg0, arg1, arg2, arg3, arg4)
 	ret0, _ := ret[0].([]storage.VirtualFileSysFileEntity)
-	return ret0
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // ListFile indicates an expected call of ListFile.
-func (mr *MockIStorageMockRecorder) ListFile(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+func (mr *MockIStorageMockRecorder) ListFile(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListFile", reflect.TypeOf((*MockIStorage)(nil).ListFile), arg0, arg1, arg2, arg3)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListFile", reflect.TypeOf((*MockIStorage)(nil).ListFile), arg0, arg1, arg2, arg3, arg4)
 }
 
 // ListFolder mocks base method.
-func (m *MockIStorage) ListFolder(arg0, arg1, arg2 string) []storage.VirtualFileSysEntity {
+func (m *MockIStorage) ListFolder(arg0 context.Context, arg1, arg2, arg3 string) ([]storage.VirtualFileSysEntity, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ListFolder", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "ListFolder", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].([]storage.VirtualFileSysEntity)
-	return ret0
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // ListFolder indicates an expected call of ListFolder.
-func (mr *MockIStorageMockRecorder) ListFolder(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockIStorageMockRecorder) ListFolder(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListFolder", reflect.TypeOf((*MockIStorage)(nil).ListFolder), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListFolder", reflect.TypeOf((*MockIStorage)(nil).ListFolder), arg0, arg1, arg2, arg3)
+}
+
+// ListUser mocks base method.
+func (m *MockIStorage) ListUser(arg0 context.Context) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUser", arg0)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUser indicates an expected call of ListUser.
+func (mr *MockIStorageMockRecorder) ListUser(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUser", reflect.TypeOf((*MockIStorage)(nil).ListUser), arg0)
 }
 
 // RenameFolder mocks base method.
-func (m *MockIStorage) RenameFolder(arg0, arg1, arg2 string) {
+func (m *MockIStorage) RenameFolder(arg0 context.Context, arg1, arg2, arg3 string) error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "RenameFolder", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "RenameFolder", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // RenameFolder indicates an expected call of RenameFolder.
-func (mr *MockIStorageMockRecorder) RenameFolder(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockIStorageMockRecorder) RenameFolder(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenameFolder", reflect.TypeOf((*MockIStorage)(nil).RenameFolder), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenameFolder", reflect.TypeOf((*MockIStorage)(nil).RenameFolder), arg0, arg1, arg2, arg3)
 }
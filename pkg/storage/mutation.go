@@ -0,0 +1,43 @@
+package storage
+
+const (
+	opAddUser      = "add-user"
+	opAddFolder    = "add-folder"
+	opDeleteFolder = "delete-folder"
+	opRenameFolder = "rename-folder"
+	opAddFile      = "add-file"
+	opDeleteFile   = "delete-file"
+	// opBatch applies all mutations of Batch or none of them
+	opBatch = "batch"
+)
+
+// mutation is one change of the virtual file system, as recorded in the
+// journal. It carries the creation time so that replaying it rebuilds the
+// exact same state.
+type mutation struct {
+	Seq           uint64 `json:"seq"`
+	Op            string `json:"op"`
+	UserName      string `json:"user"`
+	FolderName    string `json:"folder,omitempty"`
+	NewFolderName string `json:"newFolder,omitempty"`
+	FileName      string `json:"file,omitempty"`
+	Desc          string `json:"desc,omitempty"`
+	Time          int64  `json:"time,omitempty"`
+	// Actor and TraceID are taken from the request context, for auditing.
+	Actor   string `json:"actor,omitempty"`
+	TraceID string `json:"traceId,omitempty"`
+	// Batch holds the mutations of an opBatch, in order.
+	Batch []mutation `json:"batch,omitempty"`
+}
+
+// path names the user, folder or file m works on.
+func (m mutation) path() string {
+	p := m.UserName
+	if m.FolderName != "" {
+		p += "/" + m.FolderName
+	}
+	if m.FileName != "" {
+		p += "/" + m.FileName
+	}
+	return p
+}
@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"sort"
+
+	"github.com/reddtsai/goREPL/pkg/norm"
+)
+
+// NameKey is the key a user, folder or file is found by. The storages keep
+// a name as given and match it by its key, so names differing only in case,
+// as the Unicode case folding tells, or in their canonical forms are the same
+// name.
+func NameKey(name string) string {
+	return norm.Key(name)
+}
+
+// lessName orders names by their keys, then as given for the names of the
+// same key a case-sensitive host dir can hold side by side
+func lessName(a, b string) bool {
+	ka, kb := NameKey(a), NameKey(b)
+	if ka != kb {
+		return ka < kb
+	}
+	return a < b
+}
+
+// sortNames sorts names by lessName
+func sortNames(names []string) {
+	sort.Slice(names, func(i, j int) bool {
+		return lessName(names[i], names[j])
+	})
+}
@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// remoteRetries is how many times a read is tried again
+	remoteRetries = 3
+	// remoteBackoff is the wait before the first retry, doubled for
+	// each one after it
+	remoteBackoff = 50 * time.Millisecond
+)
+
+// remoteErrors maps the error codes of a goREPL server to the sentinels
+var remoteErrors = map[string]error{
+	"user_not_found":   ErrUserNotFound,
+	"user_exists":      ErrUserExists,
+	"folder_not_found": ErrFolderNotFound,
+	"folder_exists":    ErrFolderExists,
+	"file_not_found":   ErrFileNotFound,
+	"file_exists":      ErrFileExists,
+	"invalid_name":     ErrInvalidName,
+	"invalid_argument": ErrInvalidArgument,
+	"canceled":         context.Canceled,
+	"timeout":          context.DeadlineExceeded,
+}
+
+// RemoteStorage forwards every call to the REST API of a goREPL server
+// started with serve. The server keeps names as they are given, finds them
+// whatever their case, and checks them like the REPL commands do.
+//
+// Connections are reused between calls. Reads are retried when the server
+// can't be reached or is unavailable, changes are not, as they may have
+// been applied already.
+type RemoteStorage struct {
+	baseURL string
+	client  *http.Client
+}
+
+// remoteRequest is the body of a POST or PATCH request
+type remoteRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type remoteError struct {
+	Code    string `json:"code"`
+	Message string `json:"error"`
+}
+
+// NewRemoteStorage talks to the server at baseURL, e.g. http://host:8080.
+// Each call times out after timeout, 0 means no limit beyond ctx.
+func NewRemoteStorage(baseURL string, timeout time.Duration) (IStorage, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse remote url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("remote url %q isn't http(s)://host[:port]", baseURL)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 16
+	return &RemoteStorage{
+		baseURL: strings.TrimRight(u.String(), "/"),
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+	}, nil
+}
+
+// Close closes the idle connections
+func (s *RemoteStorage) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func (s *RemoteStorage) AddUser(ctx context.Context, userName string) error {
+	return s.do(ctx, http.MethodPost, remotePath(), remoteRequest{Name: userName}, nil)
+}
+
+func (s *RemoteStorage) IsExistUser(ctx context.Context, userName string) bool {
+	return s.do(ctx, http.MethodGet, remotePath(userName), nil, nil) == nil
+}
+
+func (s *RemoteStorage) ListUser(ctx context.Context) ([]string, error) {
+	var users []struct {
+		UserName string `json:"userName"`
+	}
+	err := s.do(ctx, http.MethodGet, remotePath(), nil, &users)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(users))
+	for _, u := range users {
+		names = append(names, u.UserName)
+	}
+	return names, nil
+}
+
+func (s *RemoteStorage) AddFolder(ctx context.Context, userName, folderName, folderDesc string) error {
+	return s.do(ctx, http.MethodPost, remotePath(userName, "folders"), remoteRequest{
+		Name:        folderName,
+		Description: folderDesc,
+	}, nil)
+}
+
+func (s *RemoteStorage) DeleteFolder(ctx context.Context, userName, folderName string) error {
+	return s.do(ctx, http.MethodDelete, remotePath(userName, "folders", folderName), nil, nil)
+}
+
+func (s *RemoteStorage) RenameFolder(ctx context.Context, userName, folderName, newFolderName string) error {
+	return s.do(ctx, http.MethodPatch, remotePath(userName, "folders", folderName), remoteRequest{Name: newFolderName}, nil)
+}
+
+func (s *RemoteStorage) IsExistFolder(ctx context.Context, userName, folderName string) bool {
+	return s.do(ctx, http.MethodGet, remotePath(userName, "folders", folderName), nil, nil) == nil
+}
+
+func (s *RemoteStorage) ListFolder(ctx context.Context, userName, sortName, orderBy string) ([]VirtualFileSysEntity, error) {
+	folders := []VirtualFileSysEntity{}
+	err := s.do(ctx, http.MethodGet, remotePath(userName, "folders")+remoteSortQuery(sortName, orderBy), nil, &folders)
+	if err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+func (s *RemoteStorage) IsExistFile(ctx context.Context, userName, folderName, fileName string) bool {
+	return s.do(ctx, http.MethodGet, remotePath(userName, "folders", folderName, "files", fileName), nil, nil) == nil
+}
+
+func (s *RemoteStorage) AddFile(ctx context.Context, userName, folderName, fileName, fileDesc string) error {
+	return s.do(ctx, http.MethodPost, remotePath(userName, "folders", folderName, "files"), remoteRequest{
+		Name:        fileName,
+		Description: fileDesc,
+	}, nil)
+}
+
+func (s *RemoteStorage) DeleteFile(ctx context.Context, userName, folderName, fileName string) error {
+	return s.do(ctx, http.MethodDelete, remotePath(userName, "folders", folderName, "files", fileName), nil, nil)
+}
+
+func (s *RemoteStorage) ListFile(ctx context.Context, userName, folderName, sortName, orderBy string) ([]VirtualFileSysFileEntity, error) {
+	files := []VirtualFileSysFileEntity{}
+	err := s.do(ctx, http.MethodGet, remotePath(userName, "folders", folderName, "files")+remoteSortQuery(sortName, orderBy), nil, &files)
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// do sends a request with body, unless nil, and decodes the response into
+// out, unless nil. A GET is tried again after a network error or a 502 or
+// 503 response.
+func (s *RemoteStorage) do(ctx context.Context, method, path string, body, out any) error {
+	var b []byte
+	if body != nil {
+		var err error
+		b, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	backoff := remoteBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := s.send(ctx, method, path, b, out)
+		if err == nil || !retry || method != http.MethodGet || attempt == remoteRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// send sends a request once and reports whether it's worth trying again
+func (s *RemoteStorage) send(ctx context.Context, method, path string, body []byte, out any) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if traceID := TraceIDFromContext(ctx); traceID != "" {
+		req.Header.Set("X-Trace-Id", traceID)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return false, ctxErr
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return true, fmt.Errorf("%w: %v", context.DeadlineExceeded, err)
+		}
+		return true, err
+	}
+	defer func() {
+		// drained, the connection can be reused
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if out == nil {
+			return false, nil
+		}
+		err = json.NewDecoder(resp.Body).Decode(out)
+		if err != nil {
+			return false, fmt.Errorf("decode response: %w", err)
+		}
+		return false, nil
+	}
+
+	retry := resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable
+	var apiErr remoteError
+	if json.NewDecoder(resp.Body).Decode(&apiErr) != nil || apiErr.Code == "" {
+		return retry, fmt.Errorf("remote: %s", resp.Status)
+	}
+	if sentinel, ok := remoteErrors[apiErr.Code]; ok {
+		return false, fmt.Errorf("%w: %s", sentinel, apiErr.Message)
+	}
+	return retry, fmt.Errorf("remote: %s", apiErr.Message)
+}
+
+// remotePath returns the escaped path of /users/names...
+func remotePath(names ...string) string {
+	var b strings.Builder
+	b.WriteString("/users")
+	for _, name := range names {
+		b.WriteString("/")
+		b.WriteString(url.PathEscape(name))
+	}
+	return b.String()
+}
+
+func remoteSortQuery(sortName, orderBy string) string {
+	if sortName == "create" {
+		return "?sort-created=" + url.QueryEscape(orderBy)
+	}
+	return "?sort-name=" + url.QueryEscape(orderBy)
+}
@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TestRemoteStorage struct {
+	suite.Suite
+
+	ctx context.Context
+	// calls and conns count the requests and connections served
+	calls   atomic.Int32
+	conns   atomic.Int32
+	handler http.HandlerFunc
+	srv     *httptest.Server
+}
+
+func TestRemoteStorageSuite(t *testing.T) {
+	suite.Run(t, new(TestRemoteStorage))
+}
+
+func (t *TestRemoteStorage) SetupTest() {
+	t.ctx = context.Background()
+	t.calls.Store(0)
+	t.conns.Store(0)
+	t.srv = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t.calls.Add(1)
+		t.handler(w, req)
+	}))
+	t.srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			t.conns.Add(1)
+		}
+	}
+	t.srv.Start()
+}
+
+func (t *TestRemoteStorage) TearDownTest() {
+	t.srv.Close()
+}
+
+func (t *TestRemoteStorage) open(timeout time.Duration) IStorage {
+	s, err := NewRemoteStorage(t.srv.URL+"/", timeout)
+	t.Require().NoError(err)
+	t.T().Cleanup(func() {
+		s.(*RemoteStorage).Close()
+	})
+	return s
+}
+
+func reply(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(body))
+}
+
+func (t *TestRemoteStorage) TestNewRemoteStorage() {
+	for _, u := range []string{"", "localhost:8080", "ftp://host", "http://", "http://host/%zz"} {
+		_, err := NewRemoteStorage(u, 0)
+		t.Error(err, u)
+	}
+}
+
+func (t *TestRemoteStorage) TestRequest() {
+	t.handler = func(w http.ResponseWriter, req *http.Request) {
+		t.Equal(http.MethodPatch, req.Method)
+		t.Equal("/users/test/folders/a%2Fb", req.URL.EscapedPath())
+		t.Equal("trace", req.Header.Get("X-Trace-Id"))
+		t.Equal("application/json", req.Header.Get("Content-Type"))
+		reply(w, http.StatusOK, `{}`)
+	}
+	ctx := WithTraceID(t.ctx, "trace")
+	t.NoError(t.open(0).RenameFolder(ctx, "test", "a/b", "c"))
+}
+
+func (t *TestRemoteStorage) TestList() {
+	t.handler = func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/users/test/folders":
+			t.Equal("sort-created=desc", req.URL.RawQuery)
+			reply(w, http.StatusOK, `[{"userName":"test","folderName":"b","folderCreateTime":2,"folderDesc":"desc"}]`)
+		default:
+			t.Equal("sort-name=asc", req.URL.RawQuery)
+			reply(w, http.StatusOK, `[]`)
+		}
+	}
+	s := t.open(0)
+	folders, err := s.ListFolder(t.ctx, "test", "create", "desc")
+	t.NoError(err)
+	t.Equal([]VirtualFileSysEntity{{UserName: "test", FolderName: "b", FolderCreateTime: 2, FolderDesc: "desc"}}, folders)
+	files, err := s.ListFile(t.ctx, "test", "b", "name", "asc")
+	t.NoError(err)
+	t.Equal([]VirtualFileSysFileEntity{}, files)
+}
+
+func (t *TestRemoteStorage) TestError() {
+	tests := []struct {
+		status int
+		body   string
+		want   error
+	}{
+		{http.StatusNotFound, `{"code":"user_not_found","error":"the [test] doesn't exist"}`, ErrUserNotFound},
+		{http.StatusConflict, `{"code":"folder_exists","error":"the [a] has already existed"}`, ErrFolderExists},
+		{http.StatusNotFound, `{"code":"file_not_found","error":"the [a] doesn't exist"}`, ErrFileNotFound},
+		{http.StatusBadRequest, `{"code":"invalid_argument","error":"the [a b] contain invalid chars"}`, ErrInvalidArgument},
+		{http.StatusBadRequest, `{"code":"invalid_name","error":"invalid name: .a"}`, ErrInvalidName},
+		{http.StatusGatewayTimeout, `{"code":"timeout","error":"the command timed out"}`, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.handler = func(w http.ResponseWriter, req *http.Request) {
+			reply(w, tt.status, tt.body)
+		}
+		err := t.open(0).AddFolder(t.ctx, "test", "a", "")
+		t.ErrorIs(err, tt.want)
+	}
+
+	// the message of the server is kept
+	t.handler = func(w http.ResponseWriter, req *http.Request) {
+		reply(w, http.StatusBadRequest, `{"code":"invalid_argument","error":"the [a b] contain invalid chars"}`)
+	}
+	err := t.open(0).AddFolder(t.ctx, "test", "a b", "")
+	t.EqualError(err, "invalid argument: the [a b] contain invalid chars")
+
+	t.handler = func(w http.ResponseWriter, req *http.Request) {
+		reply(w, http.StatusInternalServerError, `oops`)
+	}
+	err = t.open(0).AddUser(t.ctx, "test")
+	t.EqualError(err, "remote: 500 Internal Server Error")
+	t.False(t.open(0).IsExistUser(t.ctx, "test"))
+}
+
+func (t *TestRemoteStorage) TestRetryRead() {
+	t.handler = func(w http.ResponseWriter, req *http.Request) {
+		if t.calls.Load() < 3 {
+			reply(w, http.StatusServiceUnavailable, ``)
+			return
+		}
+		reply(w, http.StatusOK, `{"userName":"test"}`)
+	}
+	t.True(t.open(0).IsExistUser(t.ctx, "test"))
+	t.Equal(int32(3), t.calls.Load())
+
+	t.calls.Store(0)
+	t.handler = func(w http.ResponseWriter, req *http.Request) {
+		reply(w, http.StatusBadGateway, ``)
+	}
+	_, err := t.open(0).ListFolder(t.ctx, "test", "name", "asc")
+	t.EqualError(err, "remote: 502 Bad Gateway")
+	t.Equal(int32(remoteRetries+1), t.calls.Load())
+}
+
+func (t *TestRemoteStorage) TestNoRetryChange() {
+	t.handler = func(w http.ResponseWriter, req *http.Request) {
+		reply(w, http.StatusServiceUnavailable, ``)
+	}
+	s := t.open(0)
+	t.Error(s.AddUser(t.ctx, "test"))
+	t.Error(s.DeleteFolder(t.ctx, "test", "a"))
+	t.Error(s.RenameFolder(t.ctx, "test", "a", "b"))
+	t.Equal(int32(3), t.calls.Load())
+}
+
+func (t *TestRemoteStorage) TestRetryUnreachable() {
+	t.srv.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	t.Require().NoError(err)
+	addr := ln.Addr().String()
+	t.Require().NoError(ln.Close())
+
+	s, err := NewRemoteStorage("http://"+addr, 0)
+	t.Require().NoError(err)
+	start := time.Now()
+	t.False(s.IsExistUser(t.ctx, "test"))
+	// 50ms + 100ms + 200ms between the tries
+	t.GreaterOrEqual(time.Since(start), 350*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(t.ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = s.ListFolder(ctx, "test", "name", "asc")
+	t.ErrorIs(err, context.DeadlineExceeded)
+}
+
+func (t *TestRemoteStorage) TestTimeout() {
+	release := make(chan struct{})
+	defer close(release)
+	t.handler = func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}
+	err := t.open(20*time.Millisecond).AddUser(t.ctx, "test")
+	t.ErrorIs(err, context.DeadlineExceeded)
+
+	ctx, cancel := context.WithCancel(t.ctx)
+	time.AfterFunc(20*time.Millisecond, cancel)
+	err = t.open(0).AddUser(ctx, "test")
+	t.ErrorIs(err, context.Canceled)
+	t.Equal(int32(2), t.calls.Load())
+}
+
+func (t *TestRemoteStorage) TestReuseConnection() {
+	t.handler = func(w http.ResponseWriter, req *http.Request) {
+		reply(w, http.StatusNotFound, `{"code":"user_not_found","error":"the [test] doesn't exist"}`)
+	}
+	s := t.open(0)
+	for i := 0; i < 10; i++ {
+		t.False(s.IsExistUser(t.ctx, "test"))
+	}
+	t.Equal(int32(10), t.calls.Load())
+	t.Equal(int32(1), t.conns.Load())
+}
@@ -1,17 +1,69 @@
 package storage
 
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUserNotFound   = errors.New("user not found")
+	ErrUserExists     = errors.New("user already exists")
+	ErrFolderNotFound = errors.New("folder not found")
+	ErrFolderExists   = errors.New("folder already exists")
+	ErrFileNotFound   = errors.New("file not found")
+	ErrFileExists     = errors.New("file already exists")
+	// ErrInvalidName is returned by storages that can't keep a name,
+	// like one that isn't a valid path element on the host.
+	ErrInvalidName = errors.New("invalid name")
+	// ErrInvalidArgument is returned by RemoteStorage for the arguments
+	// the server rejects, along with the server's message.
+	ErrInvalidArgument = errors.New("invalid argument")
+)
+
+// InvalidNameError reports the name a storage can't keep, it matches
+// ErrInvalidName.
+type InvalidNameError struct {
+	Name string
+}
+
+func (e *InvalidNameError) Error() string {
+	return fmt.Sprintf("%v: %q", ErrInvalidName, e.Name)
+}
+
+func (e *InvalidNameError) Unwrap() error {
+	return ErrInvalidName
+}
+
+// IStorage is the virtual file system. The mutators check that the user,
+// folder or file they work on exists, or doesn't yet, under the same lock
+// as the change itself and report it with one of the Err sentinels.
+//
+// Every call fails with ctx.Err() once ctx is done, the IsExist
+// checks report false then.
 type IStorage interface {
-	AddUser(userName string)
-	IsExistUser(userName string) bool
-
-	AddFolder(userName, folderName, folderDesc string)
-	DeleteFolder(userName, folderName string)
-	RenameFolder(userName, folderName, newFolderName string)
-	IsExistFolder(userName, folderName string) bool
-	ListFolder(userName, sortName, orderBy string) []VirtualFileSysEntity
-
-	IsExistFile(userName, folderName, fileName string) bool
-	AddFile(userName, folderName, fileName, fileDesc string)
-	DeleteFile(userName, folderName, fileName string)
-	ListFile(userName, folderName, sortName, orderBy string) []VirtualFileSysFileEntity
+	AddUser(ctx context.Context, userName string) error
+	IsExistUser(ctx context.Context, userName string) bool
+	// ListUser returns the names of the users sorted
+	ListUser(ctx context.Context) ([]string, error)
+
+	AddFolder(ctx context.Context, userName, folderName, folderDesc string) error
+	DeleteFolder(ctx context.Context, userName, folderName string) error
+	RenameFolder(ctx context.Context, userName, folderName, newFolderName string) error
+	IsExistFolder(ctx context.Context, userName, folderName string) bool
+	ListFolder(ctx context.Context, userName, sortName, orderBy string) ([]VirtualFileSysEntity, error)
+
+	IsExistFile(ctx context.Context, userName, folderName, fileName string) bool
+	AddFile(ctx context.Context, userName, folderName, fileName, fileDesc string) error
+	DeleteFile(ctx context.Context, userName, folderName, fileName string) error
+	ListFile(ctx context.Context, userName, folderName, sortName, orderBy string) ([]VirtualFileSysFileEntity, error)
+}
+
+// Getter is implemented by the storages that look a user, a folder or a
+// file up by name directly, without listing the others. The names are
+// returned as kept, with the Err sentinels for the ones missing.
+type Getter interface {
+	GetUser(ctx context.Context, userName string) (string, error)
+	GetFolder(ctx context.Context, userName, folderName string) (VirtualFileSysEntity, error)
+	GetFile(ctx context.Context, userName, folderName, fileName string) (VirtualFileSysFileEntity, error)
 }
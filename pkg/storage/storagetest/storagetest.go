@@ -0,0 +1,592 @@
+// Package storagetest checks that an IStorage implementation behaves the
+// way the REPL expects, whatever keeps the data.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/reddtsai/goREPL/pkg/storage"
+)
+
+// Run runs the conformance suite against the storages made by newStorage,
+// which must return an empty storage on every call.
+func Run(t *testing.T, newStorage func(t *testing.T) storage.IStorage) {
+	suite.Run(t, &conformance{newStorage: newStorage})
+}
+
+type conformance struct {
+	suite.Suite
+	newStorage func(t *testing.T) storage.IStorage
+
+	s   storage.IStorage
+	ctx context.Context
+}
+
+func (t *conformance) SetupTest() {
+	t.ctx = context.Background()
+	t.s = t.newStorage(t.T())
+}
+
+// fill adds a user with two folders, the first holding two files.
+func (t *conformance) fill() {
+	t.Require().NoError(t.s.AddUser(t.ctx, "test"))
+	t.Require().NoError(t.s.AddFolder(t.ctx, "test", "folder1", "desc1"))
+	t.Require().NoError(t.s.AddFolder(t.ctx, "test", "folder2", "desc2"))
+	t.Require().NoError(t.s.AddFile(t.ctx, "test", "folder1", "file1", "desc1"))
+	t.Require().NoError(t.s.AddFile(t.ctx, "test", "folder1", "file2", "desc2"))
+}
+
+func (t *conformance) folderNames(userName, sortName, orderBy string) []string {
+	folders, err := t.s.ListFolder(t.ctx, userName, sortName, orderBy)
+	t.Require().NoError(err)
+	names := []string{}
+	for _, f := range folders {
+		names = append(names, f.FolderName)
+	}
+	return names
+}
+
+func (t *conformance) fileNames(userName, folderName, sortName, orderBy string) []string {
+	files, err := t.s.ListFile(t.ctx, userName, folderName, sortName, orderBy)
+	t.Require().NoError(err)
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.FileName)
+	}
+	return names
+}
+
+func (t *conformance) TestUser() {
+	t.False(t.s.IsExistUser(t.ctx, "test"))
+	t.NoError(t.s.AddUser(t.ctx, "test"))
+	t.True(t.s.IsExistUser(t.ctx, "test"))
+	t.ErrorIs(t.s.AddUser(t.ctx, "test"), storage.ErrUserExists)
+	folders, err := t.s.ListFolder(t.ctx, "test", "name", "asc")
+	t.NoError(err)
+	t.Equal(0, len(folders))
+}
+
+func (t *conformance) TestListUser() {
+	users, err := t.s.ListUser(t.ctx)
+	t.NoError(err)
+	t.Empty(users)
+	for _, userName := range []string{"user2", "user3", "user1"} {
+		t.Require().NoError(t.s.AddUser(t.ctx, userName))
+	}
+	users, err = t.s.ListUser(t.ctx)
+	t.NoError(err)
+	t.Equal([]string{"user1", "user2", "user3"}, users)
+}
+
+// TestCase checks that names are kept as given, while names differing only
+// in case are the same name.
+func (t *conformance) TestCase() {
+	t.fill()
+	t.True(t.s.IsExistUser(t.ctx, "Test"))
+	t.True(t.s.IsExistFolder(t.ctx, "test", "Folder1"))
+	t.True(t.s.IsExistFile(t.ctx, "TEST", "folder1", "FILE1"))
+	t.ErrorIs(t.s.AddUser(t.ctx, "TEST"), storage.ErrUserExists)
+	t.ErrorIs(t.s.AddFolder(t.ctx, "test", "FOLDER1", "desc"), storage.ErrFolderExists)
+	t.ErrorIs(t.s.AddFile(t.ctx, "test", "folder1", "File1", "desc"), storage.ErrFileExists)
+	t.ErrorIs(t.s.RenameFolder(t.ctx, "test", "folder2", "FOLDER1"), storage.ErrFolderExists)
+	t.NoError(t.s.DeleteFile(t.ctx, "test", "Folder1", "FILE1"))
+	t.Equal([]string{"folder1", "folder2"}, t.folderNames("test", "name", "asc"))
+	t.Equal([]string{"file2"}, t.fileNames("test", "folder1", "name", "asc"))
+
+	t.NoError(t.s.AddUser(t.ctx, "Alice"))
+	t.NoError(t.s.AddFolder(t.ctx, "alice", "MyProject", "desc"))
+	t.NoError(t.s.AddFile(t.ctx, "ALICE", "myproject", "ReadMe", "desc"))
+	users, err := t.s.ListUser(t.ctx)
+	t.NoError(err)
+	t.Equal([]string{"Alice", "test"}, users)
+	folders, err := t.s.ListFolder(t.ctx, "alice", "name", "asc")
+	t.Require().NoError(err)
+	t.Require().Len(folders, 1)
+	t.Equal("Alice", folders[0].UserName)
+	t.Equal("MyProject", folders[0].FolderName)
+	t.Equal([]string{"ReadMe"}, t.fileNames("alice", "MYPROJECT", "name", "asc"))
+}
+
+// TestRenameCase checks that a folder may be renamed to the same name in
+// another case, but not to the name it has.
+func (t *conformance) TestRenameCase() {
+	t.fill()
+	t.ErrorIs(t.s.RenameFolder(t.ctx, "test", "folder1", "folder1"), storage.ErrFolderExists)
+	t.ErrorIs(t.s.RenameFolder(t.ctx, "test", "FOLDER1", "folder1"), storage.ErrFolderExists)
+	t.NoError(t.s.RenameFolder(t.ctx, "test", "folder1", "Folder1"))
+	t.Equal([]string{"Folder1", "folder2"}, t.folderNames("test", "name", "asc"))
+	t.Equal([]string{"file1", "file2"}, t.fileNames("test", "folder1", "name", "asc"))
+	t.NoError(t.s.RenameFolder(t.ctx, "test", "FOLDER1", "FOLDER1"))
+	t.Equal([]string{"FOLDER1", "folder2"}, t.folderNames("test", "name", "asc"))
+}
+
+// TestUnicodeCase checks that names in any script are the same name whatever
+// their case or canonical form.
+func (t *conformance) TestUnicodeCase() {
+	t.NoError(t.s.AddUser(t.ctx, "Ђорђе"))
+	t.True(t.s.IsExistUser(t.ctx, "ЂОРЂЕ"))
+	t.NoError(t.s.AddFolder(t.ctx, "ђорђе", "Café", "desc"))
+	t.True(t.s.IsExistFolder(t.ctx, "ђорђе", "CAFÉ"))
+	t.True(t.s.IsExistFolder(t.ctx, "ђорђе", "cafe\u0301"))
+	t.ErrorIs(t.s.AddFolder(t.ctx, "ђорђе", "CAFE\u0301", "desc"), storage.ErrFolderExists)
+	t.NoError(t.s.AddFile(t.ctx, "ђорђе", "café", "Σίσυφος", "desc"))
+	t.True(t.s.IsExistFile(t.ctx, "ђорђе", "café", "ΣΊΣΥΦΟΣ"))
+	t.Equal([]string{"Café"}, t.folderNames("ђорђе", "name", "asc"))
+	t.Equal([]string{"Σίσυφος"}, t.fileNames("ЂОРЂЕ", "CAFÉ", "name", "asc"))
+}
+
+func (t *conformance) TestFolder() {
+	t.fill()
+	t.True(t.s.IsExistFolder(t.ctx, "test", "folder1"))
+	folders, err := t.s.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal(2, len(folders))
+	t.Equal("test", folders[0].UserName)
+	t.Equal("folder1", folders[0].FolderName)
+	t.Equal("desc1", folders[0].FolderDesc)
+	t.NotZero(folders[0].FolderCreateTime)
+
+	t.NoError(t.s.DeleteFolder(t.ctx, "test", "folder2"))
+	t.False(t.s.IsExistFolder(t.ctx, "test", "folder2"))
+	t.Equal([]string{"folder1"}, t.folderNames("test", "name", "asc"))
+}
+
+func (t *conformance) TestFolderError() {
+	t.fill()
+	t.ErrorIs(t.s.AddFolder(t.ctx, "nobody", "folder", "desc"), storage.ErrUserNotFound)
+	t.ErrorIs(t.s.AddFolder(t.ctx, "test", "folder1", "desc"), storage.ErrFolderExists)
+	t.ErrorIs(t.s.DeleteFolder(t.ctx, "nobody", "folder1"), storage.ErrUserNotFound)
+	t.ErrorIs(t.s.DeleteFolder(t.ctx, "test", "folder3"), storage.ErrFolderNotFound)
+	t.ErrorIs(t.s.RenameFolder(t.ctx, "nobody", "folder1", "folder3"), storage.ErrUserNotFound)
+	t.ErrorIs(t.s.RenameFolder(t.ctx, "test", "folder3", "folder4"), storage.ErrFolderNotFound)
+	t.ErrorIs(t.s.RenameFolder(t.ctx, "test", "folder1", "folder2"), storage.ErrFolderExists)
+	t.Equal([]string{"folder1", "folder2"}, t.folderNames("test", "name", "asc"))
+}
+
+func (t *conformance) TestFile() {
+	t.fill()
+	t.True(t.s.IsExistFile(t.ctx, "test", "folder1", "file1"))
+	t.False(t.s.IsExistFile(t.ctx, "test", "folder2", "file1"))
+	files, err := t.s.ListFile(t.ctx, "test", "folder1", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal(2, len(files))
+	t.Equal("file1", files[0].FileName)
+	t.Equal("desc1", files[0].FileDesc)
+	t.NotZero(files[0].FileCreateTime)
+
+	t.NoError(t.s.DeleteFile(t.ctx, "test", "folder1", "file1"))
+	t.False(t.s.IsExistFile(t.ctx, "test", "folder1", "file1"))
+	t.Equal([]string{"file2"}, t.fileNames("test", "folder1", "name", "asc"))
+	// the same name in another folder is another file
+	t.NoError(t.s.AddFile(t.ctx, "test", "folder2", "file2", "desc"))
+	t.True(t.s.IsExistFile(t.ctx, "test", "folder1", "file2"))
+}
+
+func (t *conformance) TestFileError() {
+	t.fill()
+	t.ErrorIs(t.s.AddFile(t.ctx, "nobody", "folder1", "file", "desc"), storage.ErrUserNotFound)
+	t.ErrorIs(t.s.AddFile(t.ctx, "test", "folder3", "file", "desc"), storage.ErrFolderNotFound)
+	t.ErrorIs(t.s.AddFile(t.ctx, "test", "folder1", "file1", "desc"), storage.ErrFileExists)
+	t.ErrorIs(t.s.DeleteFile(t.ctx, "nobody", "folder1", "file1"), storage.ErrUserNotFound)
+	t.ErrorIs(t.s.DeleteFile(t.ctx, "test", "folder3", "file1"), storage.ErrFolderNotFound)
+	t.ErrorIs(t.s.DeleteFile(t.ctx, "test", "folder2", "file1"), storage.ErrFileNotFound)
+	t.Equal([]string{"file1", "file2"}, t.fileNames("test", "folder1", "name", "asc"))
+}
+
+func (t *conformance) TestListError() {
+	t.fill()
+	_, err := t.s.ListFolder(t.ctx, "nobody", "name", "asc")
+	t.ErrorIs(err, storage.ErrUserNotFound)
+	_, err = t.s.ListFile(t.ctx, "nobody", "folder1", "name", "asc")
+	t.ErrorIs(err, storage.ErrUserNotFound)
+	_, err = t.s.ListFile(t.ctx, "test", "folder3", "name", "asc")
+	t.ErrorIs(err, storage.ErrFolderNotFound)
+	files, err := t.s.ListFile(t.ctx, "test", "folder2", "name", "asc")
+	t.NoError(err)
+	t.NotNil(files)
+	t.Equal(0, len(files))
+}
+
+// TestGetter checks that a storage.Getter finds what the lists hold.
+func (t *conformance) TestGetter() {
+	g, ok := t.s.(storage.Getter)
+	if !ok {
+		t.T().Skip("not a storage.Getter")
+	}
+	t.Require().NoError(t.s.AddUser(t.ctx, "Test"))
+	t.Require().NoError(t.s.AddFolder(t.ctx, "test", "Folder1", "desc1"))
+	t.Require().NoError(t.s.AddFile(t.ctx, "test", "folder1", "File1", "desc2"))
+
+	userName, err := g.GetUser(t.ctx, "TEST")
+	t.NoError(err)
+	t.Equal("Test", userName)
+	folders, err := t.s.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	folder, err := g.GetFolder(t.ctx, "test", "FOLDER1")
+	t.NoError(err)
+	t.Equal(folders[0], folder)
+	files, err := t.s.ListFile(t.ctx, "test", "folder1", "name", "asc")
+	t.Require().NoError(err)
+	file, err := g.GetFile(t.ctx, "test", "folder1", "FILE1")
+	t.NoError(err)
+	t.Equal(files[0], file)
+
+	_, err = g.GetUser(t.ctx, "nobody")
+	t.ErrorIs(err, storage.ErrUserNotFound)
+	_, err = g.GetFolder(t.ctx, "nobody", "folder1")
+	t.ErrorIs(err, storage.ErrUserNotFound)
+	_, err = g.GetFolder(t.ctx, "test", "folder2")
+	t.ErrorIs(err, storage.ErrFolderNotFound)
+	_, err = g.GetFile(t.ctx, "test", "folder2", "file1")
+	t.ErrorIs(err, storage.ErrFolderNotFound)
+	_, err = g.GetFile(t.ctx, "test", "folder1", "file2")
+	t.ErrorIs(err, storage.ErrFileNotFound)
+}
+
+func (t *conformance) TestRenameCascade() {
+	t.fill()
+	before, err := t.s.ListFile(t.ctx, "test", "folder1", "name", "asc")
+	t.Require().NoError(err)
+	t.NoError(t.s.RenameFolder(t.ctx, "test", "folder1", "folder3"))
+
+	t.False(t.s.IsExistFolder(t.ctx, "test", "folder1"))
+	t.True(t.s.IsExistFolder(t.ctx, "test", "folder3"))
+	t.False(t.s.IsExistFile(t.ctx, "test", "folder1", "file1"))
+	t.True(t.s.IsExistFile(t.ctx, "test", "folder3", "file1"))
+	after, err := t.s.ListFile(t.ctx, "test", "folder3", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal(before, after)
+	_, err = t.s.ListFile(t.ctx, "test", "folder1", "name", "asc")
+	t.ErrorIs(err, storage.ErrFolderNotFound)
+
+	// the old name is free again, and starts out empty
+	t.NoError(t.s.AddFolder(t.ctx, "test", "folder1", "desc"))
+	t.Equal([]string{}, t.fileNames("test", "folder1", "name", "asc"))
+	t.NoError(t.s.AddFile(t.ctx, "test", "folder3", "file3", "desc"))
+	t.ErrorIs(t.s.AddFile(t.ctx, "test", "folder3", "file1", "desc"), storage.ErrFileExists)
+	t.NoError(t.s.DeleteFile(t.ctx, "test", "folder3", "file2"))
+	t.Equal([]string{"file1", "file3"}, t.fileNames("test", "folder3", "name", "asc"))
+}
+
+func (t *conformance) TestRenameKeepFolder() {
+	t.fill()
+	before, err := t.s.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	t.NoError(t.s.RenameFolder(t.ctx, "test", "folder1", "folder3"))
+	after, err := t.s.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	t.Require().Equal(2, len(after))
+	t.Equal("folder3", after[1].FolderName)
+	t.Equal(before[0].FolderDesc, after[1].FolderDesc)
+	t.Equal(before[0].FolderCreateTime, after[1].FolderCreateTime)
+}
+
+func (t *conformance) TestDeleteCascade() {
+	t.fill()
+	t.NoError(t.s.DeleteFolder(t.ctx, "test", "folder1"))
+	t.False(t.s.IsExistFile(t.ctx, "test", "folder1", "file1"))
+	t.NoError(t.s.AddFolder(t.ctx, "test", "folder1", "desc"))
+	t.False(t.s.IsExistFile(t.ctx, "test", "folder1", "file1"))
+	t.Equal([]string{}, t.fileNames("test", "folder1", "name", "asc"))
+}
+
+func (t *conformance) TestUsersIndependent() {
+	t.fill()
+	t.NoError(t.s.AddUser(t.ctx, "other"))
+	t.False(t.s.IsExistFolder(t.ctx, "other", "folder1"))
+	t.NoError(t.s.AddFolder(t.ctx, "other", "folder1", "desc"))
+	t.NoError(t.s.RenameFolder(t.ctx, "other", "folder1", "folder3"))
+	t.Equal([]string{"folder1", "folder2"}, t.folderNames("test", "name", "asc"))
+	t.Equal([]string{"file1", "file2"}, t.fileNames("test", "folder1", "name", "asc"))
+}
+
+func (t *conformance) TestSortByName() {
+	// the case of the names doesn't change their order
+	names := []string{"b", "C", "a", "A1"}
+	want := []string{"a", "A1", "b", "C"}
+	reversed := []string{"C", "b", "A1", "a"}
+	t.Require().NoError(t.s.AddUser(t.ctx, "test"))
+	for _, name := range names {
+		t.Require().NoError(t.s.AddFolder(t.ctx, "test", name, "desc"))
+		t.Require().NoError(t.s.AddFile(t.ctx, "test", "b", name, "desc"))
+	}
+	t.Equal(want, t.folderNames("test", "name", "asc"))
+	t.Equal(want, t.fileNames("test", "b", "name", "asc"))
+	t.Equal(reversed, t.folderNames("test", "name", "desc"))
+	t.Equal(reversed, t.fileNames("test", "b", "name", "desc"))
+}
+
+// TestSortByCreate checks listing by creation time. Items created within
+// the same second tie, those are ordered by name.
+func (t *conformance) TestSortByCreate() {
+	t.Require().NoError(t.s.AddUser(t.ctx, "test"))
+	for _, name := range []string{"b", "c", "a"} {
+		t.Require().NoError(t.s.AddFolder(t.ctx, "test", name, "desc"))
+		t.Require().NoError(t.s.AddFile(t.ctx, "test", "b", name, "desc"))
+	}
+	folders, err := t.s.ListFolder(t.ctx, "test", "create", "asc")
+	t.Require().NoError(err)
+	for i := 1; i < len(folders); i++ {
+		a, b := folders[i-1], folders[i]
+		t.True(a.FolderCreateTime < b.FolderCreateTime ||
+			a.FolderCreateTime == b.FolderCreateTime && a.FolderName < b.FolderName,
+			"%s listed before %s", a.FolderName, b.FolderName)
+	}
+	files, err := t.s.ListFile(t.ctx, "test", "b", "create", "asc")
+	t.Require().NoError(err)
+	for i := 1; i < len(files); i++ {
+		a, b := files[i-1], files[i]
+		t.True(a.FileCreateTime < b.FileCreateTime ||
+			a.FileCreateTime == b.FileCreateTime && a.FileName < b.FileName,
+			"%s listed before %s", a.FileName, b.FileName)
+	}
+
+	asc := t.folderNames("test", "create", "asc")
+	desc := t.folderNames("test", "create", "desc")
+	for i, j := 0, len(desc)-1; i < j; i, j = i+1, j-1 {
+		desc[i], desc[j] = desc[j], desc[i]
+	}
+	t.Equal(asc, desc)
+	asc = t.fileNames("test", "b", "create", "asc")
+	desc = t.fileNames("test", "b", "create", "desc")
+	for i, j := 0, len(desc)-1; i < j; i, j = i+1, j-1 {
+		desc[i], desc[j] = desc[j], desc[i]
+	}
+	t.Equal(asc, desc)
+}
+
+// TestListIdempotent checks that listing changes nothing: neither sorting
+// one way nor changing the result shows in the next listing.
+func (t *conformance) TestListIdempotent() {
+	t.fill()
+	first, err := t.s.ListFolder(t.ctx, "test", "create", "asc")
+	t.Require().NoError(err)
+	firstFiles, err := t.s.ListFile(t.ctx, "test", "folder1", "create", "asc")
+	t.Require().NoError(err)
+	for _, orderBy := range []string{"desc", "asc"} {
+		_, err = t.s.ListFolder(t.ctx, "test", "name", orderBy)
+		t.Require().NoError(err)
+		_, err = t.s.ListFile(t.ctx, "test", "folder1", "name", orderBy)
+		t.Require().NoError(err)
+	}
+	first[0].FolderName = "changed"
+	firstFiles[0].FileName = "changed"
+
+	second, err := t.s.ListFolder(t.ctx, "test", "create", "asc")
+	t.Require().NoError(err)
+	secondFiles, err := t.s.ListFile(t.ctx, "test", "folder1", "create", "asc")
+	t.Require().NoError(err)
+	t.Equal(2, len(second))
+	t.NotEqual("changed", second[0].FolderName)
+	t.Equal(2, len(secondFiles))
+	t.NotEqual("changed", secondFiles[0].FileName)
+}
+
+func (t *conformance) TestCanceledContext() {
+	t.fill()
+	ctx, cancel := context.WithCancel(t.ctx)
+	cancel()
+	t.ErrorIs(t.s.AddUser(ctx, "other"), context.Canceled)
+	t.ErrorIs(t.s.AddFolder(ctx, "test", "folder3", "desc"), context.Canceled)
+	t.ErrorIs(t.s.DeleteFolder(ctx, "test", "folder1"), context.Canceled)
+	t.ErrorIs(t.s.RenameFolder(ctx, "test", "folder1", "folder3"), context.Canceled)
+	t.ErrorIs(t.s.AddFile(ctx, "test", "folder1", "file3", "desc"), context.Canceled)
+	t.ErrorIs(t.s.DeleteFile(ctx, "test", "folder1", "file1"), context.Canceled)
+	_, err := t.s.ListFolder(ctx, "test", "name", "asc")
+	t.ErrorIs(err, context.Canceled)
+	_, err = t.s.ListFile(ctx, "test", "folder1", "name", "asc")
+	t.ErrorIs(err, context.Canceled)
+	_, err = t.s.ListUser(ctx)
+	t.ErrorIs(err, context.Canceled)
+	t.False(t.s.IsExistUser(ctx, "test"))
+	t.False(t.s.IsExistFolder(ctx, "test", "folder1"))
+	t.False(t.s.IsExistFile(ctx, "test", "folder1", "file1"))
+
+	t.False(t.s.IsExistUser(t.ctx, "other"))
+	t.Equal([]string{"folder1", "folder2"}, t.folderNames("test", "name", "asc"))
+	t.Equal([]string{"file1", "file2"}, t.fileNames("test", "folder1", "name", "asc"))
+}
+
+// TestRandomOps runs random operations over a few names, so that most of
+// them collide, and checks every result against a reference model.
+func (t *conformance) TestRandomOps() {
+	const ops = 2000
+	seed := rand.Int63()
+	t.T().Logf("seed %d", seed)
+	rnd := rand.New(rand.NewSource(seed))
+	m := model{}
+	pick := func(names ...string) string {
+		return names[rnd.Intn(len(names))]
+	}
+
+	for i := 0; i < ops; i++ {
+		userName := pick("user1", "user2", "user3")
+		folderName := pick("f1", "f2", "f3", "f4")
+		fileName := pick("a", "b", "c")
+		desc := fmt.Sprintf("desc%d", i)
+		var op string
+		var err, want error
+		switch rnd.Intn(7) {
+		case 0:
+			op = fmt.Sprintf("AddUser(%s)", userName)
+			err, want = t.s.AddUser(t.ctx, userName), m.addUser(userName)
+		case 1, 2:
+			op = fmt.Sprintf("AddFolder(%s, %s)", userName, folderName)
+			err, want = t.s.AddFolder(t.ctx, userName, folderName, desc), m.addFolder(userName, folderName, desc)
+		case 3:
+			op = fmt.Sprintf("DeleteFolder(%s, %s)", userName, folderName)
+			err, want = t.s.DeleteFolder(t.ctx, userName, folderName), m.deleteFolder(userName, folderName)
+		case 4:
+			newFolderName := pick("f1", "f2", "f3", "f4")
+			op = fmt.Sprintf("RenameFolder(%s, %s, %s)", userName, folderName, newFolderName)
+			err, want = t.s.RenameFolder(t.ctx, userName, folderName, newFolderName), m.renameFolder(userName, folderName, newFolderName)
+		case 5:
+			op = fmt.Sprintf("AddFile(%s, %s, %s)", userName, folderName, fileName)
+			err, want = t.s.AddFile(t.ctx, userName, folderName, fileName, desc), m.addFile(userName, folderName, fileName, desc)
+		case 6:
+			op = fmt.Sprintf("DeleteFile(%s, %s, %s)", userName, folderName, fileName)
+			err, want = t.s.DeleteFile(t.ctx, userName, folderName, fileName), m.deleteFile(userName, folderName, fileName)
+		}
+		if want == nil {
+			t.Require().NoError(err, "op %d %s", i, op)
+		} else {
+			t.Require().ErrorIs(err, want, "op %d %s", i, op)
+		}
+		if i%100 == 0 || i == ops-1 {
+			t.checkModel(m, i)
+		}
+	}
+}
+
+// checkModel compares the whole storage with m.
+func (t *conformance) checkModel(m model, i int) {
+	for _, userName := range []string{"user1", "user2", "user3"} {
+		folders, ok := m[userName]
+		t.Require().Equal(ok, t.s.IsExistUser(t.ctx, userName), "op %d user %s", i, userName)
+		if !ok {
+			continue
+		}
+		list, err := t.s.ListFolder(t.ctx, userName, "name", "asc")
+		t.Require().NoError(err)
+		got := map[string]string{}
+		for _, f := range list {
+			got[f.FolderName] = f.FolderDesc
+		}
+		want := map[string]string{}
+		for folderName, f := range folders {
+			want[folderName] = f.desc
+		}
+		t.Require().Equal(want, got, "op %d folders of %s", i, userName)
+		t.Require().True(sort.SliceIsSorted(list, func(a, b int) bool {
+			return list[a].FolderName < list[b].FolderName
+		}), "op %d folders of %s", i, userName)
+
+		for folderName, f := range folders {
+			files, err := t.s.ListFile(t.ctx, userName, folderName, "name", "asc")
+			t.Require().NoError(err)
+			got := map[string]string{}
+			for _, file := range files {
+				got[file.FileName] = file.FileDesc
+			}
+			t.Require().Equal(f.files, got, "op %d files of %s/%s", i, userName, folderName)
+			for fileName := range f.files {
+				t.Require().True(t.s.IsExistFile(t.ctx, userName, folderName, fileName))
+			}
+		}
+	}
+}
+
+// model is the reference the storage is checked against,
+// folders by name per user.
+type model map[string]map[string]*modelFolder
+
+type modelFolder struct {
+	desc string
+	// files holds the descriptions by file name
+	files map[string]string
+}
+
+func (m model) addUser(userName string) error {
+	if _, ok := m[userName]; ok {
+		return storage.ErrUserExists
+	}
+	m[userName] = map[string]*modelFolder{}
+	return nil
+}
+
+func (m model) folder(userName, folderName string) (*modelFolder, error) {
+	folders, ok := m[userName]
+	if !ok {
+		return nil, storage.ErrUserNotFound
+	}
+	f, ok := folders[folderName]
+	if !ok {
+		return nil, storage.ErrFolderNotFound
+	}
+	return f, nil
+}
+
+func (m model) addFolder(userName, folderName, desc string) error {
+	_, err := m.folder(userName, folderName)
+	if err == nil {
+		return storage.ErrFolderExists
+	}
+	if !errors.Is(err, storage.ErrFolderNotFound) {
+		return err
+	}
+	m[userName][folderName] = &modelFolder{desc: desc, files: map[string]string{}}
+	return nil
+}
+
+func (m model) deleteFolder(userName, folderName string) error {
+	_, err := m.folder(userName, folderName)
+	if err != nil {
+		return err
+	}
+	delete(m[userName], folderName)
+	return nil
+}
+
+func (m model) renameFolder(userName, folderName, newFolderName string) error {
+	f, err := m.folder(userName, folderName)
+	if err != nil {
+		return err
+	}
+	if _, ok := m[userName][newFolderName]; ok {
+		return storage.ErrFolderExists
+	}
+	delete(m[userName], folderName)
+	m[userName][newFolderName] = f
+	return nil
+}
+
+func (m model) addFile(userName, folderName, fileName, desc string) error {
+	f, err := m.folder(userName, folderName)
+	if err != nil {
+		return err
+	}
+	if _, ok := f.files[fileName]; ok {
+		return storage.ErrFileExists
+	}
+	f.files[fileName] = desc
+	return nil
+}
+
+func (m model) deleteFile(userName, folderName, fileName string) error {
+	f, err := m.folder(userName, folderName)
+	if err != nil {
+		return err
+	}
+	if _, ok := f.files[fileName]; !ok {
+		return storage.ErrFileNotFound
+	}
+	delete(f.files, fileName)
+	return nil
+}
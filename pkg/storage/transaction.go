@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTxDone         = errors.New("transaction has already been committed or rolled back")
+	ErrTxNotSupported = errors.New("storage doesn't support transactions")
+)
+
+// applier is implemented by the storages a Tx can commit to. It applies
+// a mutation, including an opBatch, atomically, and copies a user as it is
+// at one point in time.
+type applier interface {
+	applyMutation(ctx context.Context, m mutation) error
+	// snapshotUser returns the name userName is kept as, with its folders
+	// and files, or ErrUserNotFound.
+	snapshotUser(ctx context.Context, userName string) (string, []VirtualFileSysEntity, error)
+}
+
+// Tx stages changes to a storage and applies them all at once on Commit,
+// or none of them if any can't be applied anymore.
+//
+// Tx is an IStorage itself. Reads see the staged changes, while the changes
+// stay invisible to other users of the storage until Commit. The users a
+// Tx touches are copied from the storage on first use, so changes committed
+// by others after that are not seen, but a conflicting one fails Commit.
+type Tx struct {
+	mu      sync.Mutex
+	base    IStorage
+	scratch *VirtualFileSysStorage
+	// loaded records the users copied into scratch by NameKey, true or
+	// false whether they exist in base or not
+	loaded map[string]bool
+	staged []mutation
+	done   bool
+}
+
+// Begin starts a transaction on s.
+func Begin(ctx context.Context, s IStorage) (*Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if _, ok := s.(applier); !ok {
+		return nil, ErrTxNotSupported
+	}
+	return &Tx{
+		base:    s,
+		scratch: newVirtualFileSysStorage(),
+		loaded:  make(map[string]bool),
+	}, nil
+}
+
+// Commit applies the staged changes to the storage.
+// The transaction is done afterwards, even if Commit fails.
+func (tx *Tx) Commit(ctx context.Context) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	if len(tx.staged) == 0 {
+		return nil
+	}
+	return tx.base.(applier).applyMutation(ctx, mutation{
+		Op:       opBatch,
+		UserName: tx.staged[0].UserName,
+		Batch:    tx.staged,
+	})
+}
+
+// Rollback discards the staged changes.
+func (tx *Tx) Rollback() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.staged = nil
+	return nil
+}
+
+// Len returns the number of staged changes.
+func (tx *Tx) Len() int {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	return len(tx.staged)
+}
+
+func (tx *Tx) AddUser(ctx context.Context, userName string) error {
+	return tx.stage(ctx, mutation{
+		Op:       opAddUser,
+		UserName: userName,
+	})
+}
+
+func (tx *Tx) IsExistUser(ctx context.Context, userName string) bool {
+	if tx.read(ctx, userName) != nil {
+		return false
+	}
+	return tx.scratch.IsExistUser(ctx, userName)
+}
+
+// ListUser lists the users of the storage along with the ones added by tx
+func (tx *Tx) ListUser(ctx context.Context) ([]string, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	users, err := tx.base.ListUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	added, err := tx.scratch.ListUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, userName := range added {
+		if !tx.loaded[NameKey(userName)] {
+			users = append(users, userName)
+		}
+	}
+	sortNames(users)
+	return users, nil
+}
+
+func (tx *Tx) AddFolder(ctx context.Context, userName, folderName, folderDesc string) error {
+	return tx.stage(ctx, mutation{
+		Op:         opAddFolder,
+		UserName:   userName,
+		FolderName: folderName,
+		Desc:       folderDesc,
+		Time:       time.Now().Unix(),
+	})
+}
+
+func (tx *Tx) DeleteFolder(ctx context.Context, userName, folderName string) error {
+	return tx.stage(ctx, mutation{
+		Op:         opDeleteFolder,
+		UserName:   userName,
+		FolderName: folderName,
+	})
+}
+
+func (tx *Tx) RenameFolder(ctx context.Context, userName, folderName, newFolderName string) error {
+	return tx.stage(ctx, mutation{
+		Op:            opRenameFolder,
+		UserName:      userName,
+		FolderName:    folderName,
+		NewFolderName: newFolderName,
+	})
+}
+
+func (tx *Tx) IsExistFolder(ctx context.Context, userName, folderName string) bool {
+	if tx.read(ctx, userName) != nil {
+		return false
+	}
+	return tx.scratch.IsExistFolder(ctx, userName, folderName)
+}
+
+func (tx *Tx) ListFolder(ctx context.Context, userName, sortName, orderBy string) ([]VirtualFileSysEntity, error) {
+	err := tx.read(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	return tx.scratch.ListFolder(ctx, userName, sortName, orderBy)
+}
+
+func (tx *Tx) IsExistFile(ctx context.Context, userName, folderName, fileName string) bool {
+	if tx.read(ctx, userName) != nil {
+		return false
+	}
+	return tx.scratch.IsExistFile(ctx, userName, folderName, fileName)
+}
+
+func (tx *Tx) AddFile(ctx context.Context, userName, folderName, fileName, fileDesc string) error {
+	return tx.stage(ctx, mutation{
+		Op:         opAddFile,
+		UserName:   userName,
+		FolderName: folderName,
+		FileName:   fileName,
+		Desc:       fileDesc,
+		Time:       time.Now().Unix(),
+	})
+}
+
+func (tx *Tx) DeleteFile(ctx context.Context, userName, folderName, fileName string) error {
+	return tx.stage(ctx, mutation{
+		Op:         opDeleteFile,
+		UserName:   userName,
+		FolderName: folderName,
+		FileName:   fileName,
+	})
+}
+
+func (tx *Tx) ListFile(ctx context.Context, userName, folderName, sortName, orderBy string) ([]VirtualFileSysFileEntity, error) {
+	err := tx.read(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	return tx.scratch.ListFile(ctx, userName, folderName, sortName, orderBy)
+}
+
+func (tx *Tx) GetUser(ctx context.Context, userName string) (string, error) {
+	err := tx.read(ctx, userName)
+	if err != nil {
+		return "", err
+	}
+	return tx.scratch.GetUser(ctx, userName)
+}
+
+func (tx *Tx) GetFolder(ctx context.Context, userName, folderName string) (VirtualFileSysEntity, error) {
+	err := tx.read(ctx, userName)
+	if err != nil {
+		return VirtualFileSysEntity{}, err
+	}
+	return tx.scratch.GetFolder(ctx, userName, folderName)
+}
+
+func (tx *Tx) GetFile(ctx context.Context, userName, folderName, fileName string) (VirtualFileSysFileEntity, error) {
+	err := tx.read(ctx, userName)
+	if err != nil {
+		return VirtualFileSysFileEntity{}, err
+	}
+	return tx.scratch.GetFile(ctx, userName, folderName, fileName)
+}
+
+// stage checks m against the state seen by the transaction and records it.
+func (tx *Tx) stage(ctx context.Context, m mutation) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	err := tx.load(ctx, m.UserName)
+	if err != nil {
+		return err
+	}
+	err = tx.scratch.apply(m)
+	if err != nil {
+		return err
+	}
+	tx.staged = append(tx.staged, m)
+	return nil
+}
+
+// read makes sure userName is loaded before scratch is read.
+func (tx *Tx) read(ctx context.Context, userName string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	return tx.load(ctx, userName)
+}
+
+// load copies userName, with all folders and files, from the storage into
+// scratch the first time the transaction touches it.
+// The caller must hold tx.mu.
+func (tx *Tx) load(ctx context.Context, userName string) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	key := NameKey(userName)
+	if _, ok := tx.loaded[key]; ok {
+		return nil
+	}
+
+	name, folders, err := tx.base.(applier).snapshotUser(ctx, userName)
+	if errors.Is(err, ErrUserNotFound) {
+		tx.loaded[key] = false
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	tx.scratch.restore(name, folders)
+	tx.loaded[key] = true
+	return nil
+}
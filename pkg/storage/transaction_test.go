@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TestTransaction struct {
+	suite.Suite
+
+	TestStorage IStorage
+	ctx         context.Context
+}
+
+func TestTransactionSuite(t *testing.T) {
+	suite.Run(t, new(TestTransaction))
+}
+
+func (t *TestTransaction) SetupTest() {
+	t.ctx = context.Background()
+	t.TestStorage = NewVirtualFileSysStorage()
+	t.Require().NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.Require().NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.Require().NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file", "desc"))
+}
+
+func (t *TestTransaction) begin() *Tx {
+	tx, err := Begin(t.ctx, t.TestStorage)
+	t.Require().NoError(err)
+	return tx
+}
+
+func (t *TestTransaction) TestReadYourWrites() {
+	tx := t.begin()
+	t.NoError(tx.AddFolder(t.ctx, "test", "folder2", "desc2"))
+	t.NoError(tx.AddFile(t.ctx, "test", "folder2", "file2", "desc2"))
+	t.NoError(tx.DeleteFile(t.ctx, "test", "folder", "file"))
+	t.True(tx.IsExistFolder(t.ctx, "test", "folder2"))
+	t.True(tx.IsExistFile(t.ctx, "test", "folder2", "file2"))
+	t.False(tx.IsExistFile(t.ctx, "test", "folder", "file"))
+	folders, err := tx.ListFolder(t.ctx, "test", "name", "asc")
+	t.NoError(err)
+	t.Equal(2, len(folders))
+	t.Equal(3, tx.Len())
+}
+
+func (t *TestTransaction) TestIsolation() {
+	tx := t.begin()
+	t.NoError(tx.AddUser(t.ctx, "other"))
+	t.NoError(tx.RenameFolder(t.ctx, "test", "folder", "newfolder"))
+	t.False(t.TestStorage.IsExistUser(t.ctx, "other"))
+	t.True(t.TestStorage.IsExistFolder(t.ctx, "test", "folder"))
+	t.False(t.TestStorage.IsExistFolder(t.ctx, "test", "newfolder"))
+}
+
+func (t *TestTransaction) TestCommit() {
+	tx := t.begin()
+	t.NoError(tx.AddUser(t.ctx, "other"))
+	t.NoError(tx.AddFolder(t.ctx, "other", "folder", "desc"))
+	t.NoError(tx.RenameFolder(t.ctx, "test", "folder", "newfolder"))
+	t.NoError(tx.Commit(t.ctx))
+
+	t.True(t.TestStorage.IsExistFolder(t.ctx, "other", "folder"))
+	t.False(t.TestStorage.IsExistFolder(t.ctx, "test", "folder"))
+	t.True(t.TestStorage.IsExistFile(t.ctx, "test", "newfolder", "file"))
+}
+
+func (t *TestTransaction) TestCommitKeepCreateTime() {
+	folders, err := t.TestStorage.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	tx := t.begin()
+	t.NoError(tx.AddFolder(t.ctx, "test", "folder2", "desc2"))
+	t.NoError(tx.Commit(t.ctx))
+
+	reload, err := t.TestStorage.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal(folders[0].FolderCreateTime, reload[0].FolderCreateTime)
+}
+
+func (t *TestTransaction) TestRollback() {
+	tx := t.begin()
+	t.NoError(tx.DeleteFolder(t.ctx, "test", "folder"))
+	t.NoError(tx.Rollback())
+	t.True(t.TestStorage.IsExistFile(t.ctx, "test", "folder", "file"))
+}
+
+func (t *TestTransaction) TestStageError() {
+	tx := t.begin()
+	t.ErrorIs(tx.AddFolder(t.ctx, "test", "folder", "desc"), ErrFolderExists)
+	t.ErrorIs(tx.AddFolder(t.ctx, "nobody", "folder", "desc"), ErrUserNotFound)
+	t.ErrorIs(tx.DeleteFile(t.ctx, "test", "folder", "nofile"), ErrFileNotFound)
+	t.Equal(0, tx.Len())
+}
+
+func (t *TestTransaction) TestCommitConflict() {
+	tx := t.begin()
+	t.NoError(tx.AddFolder(t.ctx, "test", "folder2", "desc2"))
+	t.NoError(tx.AddFile(t.ctx, "test", "folder", "file2", "desc2"))
+	// committed by someone else after the tx read the user
+	t.Require().NoError(t.TestStorage.DeleteFolder(t.ctx, "test", "folder"))
+
+	t.ErrorIs(tx.Commit(t.ctx), ErrFolderNotFound)
+	// nothing of the batch is applied
+	t.False(t.TestStorage.IsExistFolder(t.ctx, "test", "folder2"))
+}
+
+func (t *TestTransaction) TestCommitConflictKeepCase() {
+	tx := t.begin()
+	t.NoError(tx.RenameFolder(t.ctx, "test", "FOLDER", "Folder"))
+	t.NoError(tx.AddFolder(t.ctx, "test", "folder2", "desc2"))
+	t.Require().NoError(t.TestStorage.AddFolder(t.ctx, "test", "Folder2", "desc2"))
+
+	t.ErrorIs(tx.Commit(t.ctx), ErrFolderExists)
+	// the rename is undone to the name as kept
+	folders, err := t.TestStorage.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal("folder", folders[0].FolderName)
+}
+
+func (t *TestTransaction) TestLoadKeepUserCase() {
+	t.Require().NoError(t.TestStorage.AddUser(t.ctx, "Bob"))
+	tx := t.begin()
+	t.NoError(tx.AddFolder(t.ctx, "bob", "folder", "desc"))
+	// a user without folders is copied with the name as kept too
+	folders, err := tx.ListFolder(t.ctx, "BOB", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal("Bob", folders[0].UserName)
+}
+
+func (t *TestTransaction) TestDone() {
+	tx := t.begin()
+	t.NoError(tx.Commit(t.ctx))
+	t.ErrorIs(tx.Commit(t.ctx), ErrTxDone)
+	t.ErrorIs(tx.Rollback(), ErrTxDone)
+	t.ErrorIs(tx.AddUser(t.ctx, "other"), ErrTxDone)
+	_, err := tx.ListFolder(t.ctx, "test", "name", "asc")
+	t.ErrorIs(err, ErrTxDone)
+}
+
+func (t *TestTransaction) TestCanceledContext() {
+	ctx, cancel := context.WithCancel(t.ctx)
+	cancel()
+	_, err := Begin(ctx, t.TestStorage)
+	t.ErrorIs(err, context.Canceled)
+
+	tx := t.begin()
+	t.NoError(tx.AddUser(t.ctx, "other"))
+	t.ErrorIs(tx.Commit(ctx), context.Canceled)
+	t.False(t.TestStorage.IsExistUser(t.ctx, "other"))
+}
+
+func (t *TestTransaction) TestNotSupported() {
+	_, err := Begin(t.ctx, struct{ IStorage }{t.TestStorage})
+	t.ErrorIs(err, ErrTxNotSupported)
+}
+
+func (t *TestTransaction) TestFileSysStorageCommit() {
+	dir := t.T().TempDir()
+	s, err := openFileSysStorage(dir, defaultCompactThreshold)
+	t.Require().NoError(err)
+	t.Require().NoError(s.AddUser(t.ctx, "test"))
+	tx, err := Begin(t.ctx, s)
+	t.Require().NoError(err)
+	t.NoError(tx.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.NoError(tx.AddFile(t.ctx, "test", "folder", "file", "desc"))
+	t.NoError(tx.Commit(t.ctx))
+	s.journal.close()
+
+	s, err = openFileSysStorage(dir, defaultCompactThreshold)
+	t.Require().NoError(err)
+	defer s.journal.close()
+	t.True(s.IsExistFile(t.ctx, "test", "folder", "file"))
+}
+
+func (t *TestTransaction) TestFileSysStorageTornBatch() {
+	dir := t.T().TempDir()
+	s, err := openFileSysStorage(dir, defaultCompactThreshold)
+	t.Require().NoError(err)
+	t.Require().NoError(s.AddUser(t.ctx, "test"))
+	tx, err := Begin(t.ctx, s)
+	t.Require().NoError(err)
+	t.NoError(tx.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.NoError(tx.AddFile(t.ctx, "test", "folder", "file", "desc"))
+	t.NoError(tx.Commit(t.ctx))
+	size := s.journal.size
+	s.journal.close()
+	// a crash while writing the batch record loses the whole batch
+	t.Require().NoError(os.Truncate(filepath.Join(dir, journalFileName), size-5))
+
+	s, err = openFileSysStorage(dir, defaultCompactThreshold)
+	t.Require().NoError(err)
+	defer s.journal.close()
+	t.True(s.IsExistUser(t.ctx, "test"))
+	t.False(s.IsExistFolder(t.ctx, "test", "folder"))
+}
@@ -2,247 +2,779 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"sort"
-	"strings"
 	"sync"
 	"time"
 )
 
+// VirtualFileSysStorage keeps the virtual file system in memory.
+//
+// Users, folders and files are found through hash indexes, and every user
+// and folder keeps ordered indexes by name and by creation time, so lookups
+// take O(1), changes O(log n) and sorted listing needs no sort.
+//
+// Users, folders and files keep their names as given, and are indexed by
+// NameKey, so names differing only in case are the same.
+//
+// Every user has its own lock, so calls on different users run in parallel
+// while calls on the same user stay serialized. mu only guards the users map
+// and is never held while waiting for a user lock, except by a batch, which
+// takes the locks of its users in key order.
 type VirtualFileSysStorage struct {
-	mu        sync.RWMutex
-	Data      map[string][]VirtualFileSysEntity
-	FolderMap map[string]bool
-	FileMap   map[string]bool
+	mu sync.RWMutex
+	// users, like the folders and the files below, are keyed by NameKey
+	users map[string]*userNode
 }
 
 type VirtualFileSysEntity struct {
-	UserName         string
-	FolderName       string
-	FolderCreateTime int64
-	FolderDesc       string
-	Files            []VirtualFileSysFileEntity
+	UserName         string                     `json:"userName"`
+	FolderName       string                     `json:"folderName"`
+	FolderCreateTime int64                      `json:"folderCreateTime"`
+	FolderDesc       string                     `json:"folderDesc"`
+	Files            []VirtualFileSysFileEntity `json:"files,omitempty"`
 }
 
 type VirtualFileSysFileEntity struct {
-	FileName       string
-	FileCreateTime int64
-	FileDesc       string
+	FileName       string `json:"fileName"`
+	FileCreateTime int64  `json:"fileCreateTime"`
+	FileDesc       string `json:"fileDesc"`
+}
+
+// userNode indexes the folders of a user.
+type userNode struct {
+	mu       sync.RWMutex
+	name     string
+	folders  map[string]*folderNode
+	byName   *orderedIndex[*folderNode]
+	byCreate *orderedIndex[*folderNode]
+}
+
+// folderNode holds a folder, with Files left empty, and indexes its files.
+type folderNode struct {
+	entity   VirtualFileSysEntity
+	files    map[string]*VirtualFileSysFileEntity
+	byName   *orderedIndex[*VirtualFileSysFileEntity]
+	byCreate *orderedIndex[*VirtualFileSysFileEntity]
 }
 
 func NewVirtualFileSysStorage() IStorage {
+	return newVirtualFileSysStorage()
+}
+
+func newVirtualFileSysStorage() *VirtualFileSysStorage {
 	return &VirtualFileSysStorage{
-		Data:      make(map[string][]VirtualFileSysEntity),
-		FolderMap: make(map[string]bool),
-		FileMap:   make(map[string]bool),
+		users: make(map[string]*userNode),
 	}
 }
 
-func (v *VirtualFileSysStorage) AddUser(userName string) {
-	v.mu.Lock()
-	defer v.mu.Unlock()
+func newUserNode(userName string) *userNode {
+	return &userNode{
+		name:    userName,
+		folders: make(map[string]*folderNode),
+		byName: newOrderedIndex(func(a, b *folderNode) bool {
+			return lessName(a.entity.FolderName, b.entity.FolderName)
+		}),
+		// ties on the create time are broken by name,
+		// so the order is the same on every call
+		byCreate: newOrderedIndex(func(a, b *folderNode) bool {
+			if a.entity.FolderCreateTime != b.entity.FolderCreateTime {
+				return a.entity.FolderCreateTime < b.entity.FolderCreateTime
+			}
+			return lessName(a.entity.FolderName, b.entity.FolderName)
+		}),
+	}
+}
+
+func newFolderNode(entity VirtualFileSysEntity) *folderNode {
+	entity.Files = nil
+	return &folderNode{
+		entity: entity,
+		files:  make(map[string]*VirtualFileSysFileEntity),
+		byName: newOrderedIndex(func(a, b *VirtualFileSysFileEntity) bool {
+			return lessName(a.FileName, b.FileName)
+		}),
+		byCreate: newOrderedIndex(func(a, b *VirtualFileSysFileEntity) bool {
+			if a.FileCreateTime != b.FileCreateTime {
+				return a.FileCreateTime < b.FileCreateTime
+			}
+			return lessName(a.FileName, b.FileName)
+		}),
+	}
+}
 
-	v.Data[userName] = []VirtualFileSysEntity{}
+func (v *VirtualFileSysStorage) AddUser(ctx context.Context, userName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return v.apply(mutation{
+		Op:       opAddUser,
+		UserName: userName,
+	})
 }
 
-func (v *VirtualFileSysStorage) IsExistUser(userName string) bool {
+func (v *VirtualFileSysStorage) IsExistUser(ctx context.Context, userName string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
 	v.mu.RLock()
 	defer v.mu.RUnlock()
 
-	_, ok := v.Data[userName]
+	_, ok := v.users[NameKey(userName)]
 	return ok
 }
 
-func (v *VirtualFileSysStorage) AddFolder(userName, folderName, folderDesc string) {
-	v.mu.Lock()
-	defer v.mu.Unlock()
+func (v *VirtualFileSysStorage) ListUser(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
 
-	key := fmt.Sprintf("%s:%s", userName, folderName)
-	v.FolderMap[key] = true
-	v.Data[userName] = append(v.Data[userName], VirtualFileSysEntity{
-		UserName:         userName,
-		FolderName:       folderName,
-		FolderCreateTime: time.Now().Unix(),
-		FolderDesc:       folderDesc,
+	users := make([]string, 0, len(v.users))
+	for _, u := range v.users {
+		users = append(users, u.name)
+	}
+	sortNames(users)
+	return users, nil
+}
+
+func (v *VirtualFileSysStorage) AddFolder(ctx context.Context, userName, folderName, folderDesc string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return v.apply(mutation{
+		Op:         opAddFolder,
+		UserName:   userName,
+		FolderName: folderName,
+		Desc:       folderDesc,
+		Time:       time.Now().Unix(),
 	})
 }
 
-func (v *VirtualFileSysStorage) IsExistFolder(userName, folderName string) bool {
-	v.mu.RLock()
-	defer v.mu.RUnlock()
+func (v *VirtualFileSysStorage) IsExistFolder(ctx context.Context, userName, folderName string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	u := v.user(userName)
+	if u == nil {
+		return false
+	}
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return u.folders[NameKey(folderName)] != nil
+}
+
+func (v *VirtualFileSysStorage) DeleteFolder(ctx context.Context, userName, folderName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return v.apply(mutation{
+		Op:         opDeleteFolder,
+		UserName:   userName,
+		FolderName: folderName,
+	})
+}
 
-	key := fmt.Sprintf("%s:%s", userName, folderName)
-	_, ok := v.FolderMap[key]
+// ListFolder returns a copy of the user's folders, the caller may keep and
+// change it. Files is left empty, ListFile lists them.
+func (v *VirtualFileSysStorage) ListFolder(ctx context.Context, userName, sortName, orderBy string) ([]VirtualFileSysEntity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	u := v.user(userName)
+	if u == nil {
+		return nil, ErrUserNotFound
+	}
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	index := u.byName
+	if sortName == "create" {
+		index = u.byCreate
+	}
+	folders := make([]VirtualFileSysEntity, 0, index.Len())
+	index.ascend(func(f *folderNode) bool {
+		folders = append(folders, f.entity)
+		return true
+	})
+	if orderBy == "desc" {
+		reverse(folders)
+	}
+	return folders, nil
+}
+
+func (v *VirtualFileSysStorage) RenameFolder(ctx context.Context, userName, folderName, newFolderName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return v.apply(mutation{
+		Op:            opRenameFolder,
+		UserName:      userName,
+		FolderName:    folderName,
+		NewFolderName: newFolderName,
+	})
+}
+
+func (v *VirtualFileSysStorage) IsExistFile(ctx context.Context, userName, folderName, fileName string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	u := v.user(userName)
+	if u == nil {
+		return false
+	}
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	f := u.folders[NameKey(folderName)]
+	if f == nil {
+		return false
+	}
+	_, ok := f.files[NameKey(fileName)]
 	return ok
 }
 
-func (v *VirtualFileSysStorage) DeleteFolder(userName, folderName string) {
-	v.mu.Lock()
-	defer v.mu.Unlock()
+func (v *VirtualFileSysStorage) AddFile(ctx context.Context, userName, folderName, fileName, fileDesc string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return v.apply(mutation{
+		Op:         opAddFile,
+		UserName:   userName,
+		FolderName: folderName,
+		FileName:   fileName,
+		Desc:       fileDesc,
+		Time:       time.Now().Unix(),
+	})
+}
 
-	entities := v.Data[userName]
-	sort.Slice(entities, func(i, j int) bool {
-		return entities[i].FolderName < entities[j].FolderName
+func (v *VirtualFileSysStorage) DeleteFile(ctx context.Context, userName, folderName, fileName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return v.apply(mutation{
+		Op:         opDeleteFile,
+		UserName:   userName,
+		FolderName: folderName,
+		FileName:   fileName,
 	})
-	// 使用二分查找找到第一个符合条件的索引
-	index := sort.Search(len(entities), func(i int) bool {
-		return entities[i].FolderName >= folderName
+}
+
+// ListFile returns a copy of the files in a folder, the caller may keep and
+// change it.
+func (v *VirtualFileSysStorage) ListFile(ctx context.Context, userName, folderName, sortName, orderBy string) ([]VirtualFileSysFileEntity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	u := v.user(userName)
+	if u == nil {
+		return nil, ErrUserNotFound
+	}
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	f := u.folders[NameKey(folderName)]
+	if f == nil {
+		return nil, ErrFolderNotFound
+	}
+	index := f.byName
+	if sortName == "create" {
+		index = f.byCreate
+	}
+	files := make([]VirtualFileSysFileEntity, 0, index.Len())
+	index.ascend(func(file *VirtualFileSysFileEntity) bool {
+		files = append(files, *file)
+		return true
 	})
-	if index < len(entities) && entities[index].FolderName == folderName {
-		start := index
-		end := index
-		end++
-		v.Data[userName] = append(entities[:start], entities[end:]...)
+	if orderBy == "desc" {
+		reverse(files)
+	}
+	return files, nil
+}
+
+func (v *VirtualFileSysStorage) GetUser(ctx context.Context, userName string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	u := v.user(userName)
+	if u == nil {
+		return "", ErrUserNotFound
+	}
+	return u.name, nil
+}
+
+// GetFolder returns a copy of the folder, with Files left empty.
+func (v *VirtualFileSysStorage) GetFolder(ctx context.Context, userName, folderName string) (VirtualFileSysEntity, error) {
+	if err := ctx.Err(); err != nil {
+		return VirtualFileSysEntity{}, err
+	}
+	u := v.user(userName)
+	if u == nil {
+		return VirtualFileSysEntity{}, ErrUserNotFound
+	}
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	f := u.folders[NameKey(folderName)]
+	if f == nil {
+		return VirtualFileSysEntity{}, ErrFolderNotFound
 	}
-	key := fmt.Sprintf("%s:%s", userName, folderName)
-	delete(v.FolderMap, key)
+	return f.entity, nil
 }
 
-func (v *VirtualFileSysStorage) ListFolder(userName, sortName, orderBy string) []VirtualFileSysEntity {
+func (v *VirtualFileSysStorage) GetFile(ctx context.Context, userName, folderName, fileName string) (VirtualFileSysFileEntity, error) {
+	if err := ctx.Err(); err != nil {
+		return VirtualFileSysFileEntity{}, err
+	}
+	u := v.user(userName)
+	if u == nil {
+		return VirtualFileSysFileEntity{}, ErrUserNotFound
+	}
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	f := u.folders[NameKey(folderName)]
+	if f == nil {
+		return VirtualFileSysFileEntity{}, ErrFolderNotFound
+	}
+	file, ok := f.files[NameKey(fileName)]
+	if !ok {
+		return VirtualFileSysFileEntity{}, ErrFileNotFound
+	}
+	return *file, nil
+}
+
+// user looks a user up, holding mu only for the lookup. Users are never
+// removed, so the node stays valid after mu is released.
+func (v *VirtualFileSysStorage) user(userName string) *userNode {
 	v.mu.RLock()
 	defer v.mu.RUnlock()
-	entities := v.Data[userName]
 
-	switch sortName {
-	case "name":
-		sort.Slice(entities, func(i, j int) bool {
-			if orderBy == "desc" {
-				return entities[i].FolderName > entities[j].FolderName
+	return v.users[NameKey(userName)]
+}
+
+// apply checks m against the current state and applies it,
+// both under the lock of the user it changes.
+func (v *VirtualFileSysStorage) apply(m mutation) error {
+	return v.applyWith(m, nil)
+}
+
+// applyWith checks m against the current state, then calls before, if any,
+// and applies m once it succeeds, all under the locks of the users m works
+// on. An error of before leaves the state as it was.
+func (v *VirtualFileSysStorage) applyWith(m mutation, before func() error) error {
+	if before == nil {
+		before = func() error { return nil }
+	}
+	switch m.Op {
+	case opBatch:
+		unlock := v.lockBatch(m)
+		defer unlock()
+
+		undo, err := v.doBatch(m)
+		if err != nil {
+			return err
+		}
+		err = before()
+		if err != nil {
+			undo()
+			return err
+		}
+		return nil
+	case opAddUser:
+		v.mu.Lock()
+		defer v.mu.Unlock()
+
+		err := v.check(m)
+		if err == nil {
+			err = before()
+		}
+		if err != nil {
+			return err
+		}
+		v.do(m)
+		return nil
+	}
+
+	u := v.user(m.UserName)
+	if u == nil {
+		return checkOp(m, false)
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	err := u.check(m)
+	if err == nil {
+		err = before()
+	}
+	if err != nil {
+		return err
+	}
+	u.do(m)
+	return nil
+}
+
+// applyMutation lets a Tx commit to v.
+func (v *VirtualFileSysStorage) applyMutation(ctx context.Context, m mutation) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return v.apply(m)
+}
+
+// snapshotUser lets a Tx copy a user of v, under the lock of the user.
+func (v *VirtualFileSysStorage) snapshotUser(ctx context.Context, userName string) (string, []VirtualFileSysEntity, error) {
+	if err := ctx.Err(); err != nil {
+		return "", nil, err
+	}
+	u := v.user(userName)
+	if u == nil {
+		return "", nil, ErrUserNotFound
+	}
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return u.name, u.dump(), nil
+}
+
+// lockBatch takes the locks of the users a batch touches, in key order so
+// two batches can't deadlock, then mu, and returns a func releasing them.
+// mu isn't held while waiting for the users, so a busy user doesn't hold up
+// the lookups of the others. mu is only taken for writing if the batch adds
+// users, otherwise batches on other users run alongside.
+func (v *VirtualFileSysStorage) lockBatch(m mutation) func() {
+	keys := make([]string, 0, len(m.Batch))
+	seen := make(map[string]bool, len(m.Batch))
+	addsUser := false
+	for _, bm := range m.Batch {
+		key := NameKey(bm.UserName)
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+		addsUser = addsUser || bm.Op == opAddUser
+	}
+	sort.Strings(keys)
+	lock, unlock := v.mu.RLock, v.mu.RUnlock
+	if addsUser {
+		lock, unlock = v.mu.Lock, v.mu.Unlock
+	}
+
+	for {
+		v.mu.RLock()
+		nodes := make([]*userNode, len(keys))
+		for i, key := range keys {
+			nodes[i] = v.users[key]
+		}
+		v.mu.RUnlock()
+
+		for _, u := range nodes {
+			if u != nil {
+				u.mu.Lock()
 			}
-			return entities[i].FolderName < entities[j].FolderName
-		})
-	case "create":
-		sort.Slice(entities, func(i, j int) bool {
-			if orderBy == "desc" {
-				return entities[i].FolderCreateTime > entities[j].FolderCreateTime
+		}
+		release := func() {
+			unlock()
+			for _, u := range nodes {
+				if u != nil {
+					u.mu.Unlock()
+				}
 			}
-			return entities[i].FolderCreateTime < entities[j].FolderCreateTime
-		})
+		}
+		lock()
+		// a user added meanwhile must be locked too, start over then
+		added := false
+		for i, key := range keys {
+			added = added || v.users[key] != nodes[i]
+		}
+		if !added {
+			return release
+		}
+		release()
 	}
-
-	return entities
 }
 
-func (v *VirtualFileSysStorage) RenameFolder(userName, folderName, newFolderName string) {
-	v.mu.Lock()
-	defer v.mu.Unlock()
+// doBatch checks and applies the mutations of a batch one by one, each one
+// seeing the changes of those before it. If one fails, those before it are
+// undone. Otherwise it returns a func undoing the whole batch. The caller
+// must hold the locks taken by lockBatch.
+func (v *VirtualFileSysStorage) doBatch(m mutation) (func(), error) {
+	undos := make([]func(), 0, len(m.Batch))
+	undo := func() {
+		for i := len(undos) - 1; i >= 0; i-- {
+			undos[i]()
+		}
+	}
+	for _, bm := range m.Batch {
+		err := v.check(bm)
+		if err != nil {
+			undo()
+			return nil, fmt.Errorf("%s %s: %w", bm.Op, bm.path(), err)
+		}
+		undos = append(undos, v.undo(bm))
+		v.do(bm)
+	}
+	return undo, nil
+}
 
-	entities := v.Data[userName]
-	sort.Slice(entities, func(i, j int) bool {
-		return entities[i].FolderName < entities[j].FolderName
-	})
-	index := sort.Search(len(entities), func(i int) bool {
-		return entities[i].FolderName >= folderName
-	})
-	if index < len(entities) && entities[index].FolderName == folderName {
-		entities[index].FolderName = newFolderName
+// undo returns a func reverting a checked mutation once it is applied.
+// The caller must hold the locks of check.
+func (v *VirtualFileSysStorage) undo(m mutation) func() {
+	if m.Op == opAddUser {
+		return func() {
+			delete(v.users, NameKey(m.UserName))
+		}
 	}
-	key := fmt.Sprintf("%s:%s", userName, folderName)
-	delete(v.FolderMap, key)
-	key = fmt.Sprintf("%s:%s", userName, newFolderName)
-	v.FolderMap[key] = true
-	for k := range v.FileMap {
-		uf := fmt.Sprintf("%s:%s:", userName, folderName)
-		if strings.Contains(k, uf) {
-			newKey := fmt.Sprintf("%s:%s:%s", userName, newFolderName, k[len(userName)+len(folderName)+2:])
-			fmt.Println(newKey, k)
-			v.FileMap[newKey] = true
-			delete(v.FileMap, k)
+	u := v.users[NameKey(m.UserName)]
+	switch m.Op {
+	case opAddFolder:
+		return func() {
+			u.deleteFolder(m.FolderName)
+		}
+	case opDeleteFolder:
+		// the deleted folder keeps its files
+		f := u.folders[NameKey(m.FolderName)]
+		return func() {
+			u.insertFolder(f)
+		}
+	case opRenameFolder:
+		// the name as kept, not as given
+		folderName := u.folders[NameKey(m.FolderName)].entity.FolderName
+		return func() {
+			u.renameFolder(m.NewFolderName, folderName)
+		}
+	case opAddFile:
+		return func() {
+			u.deleteFile(m.FolderName, m.FileName)
+		}
+	case opDeleteFile:
+		file := u.folders[NameKey(m.FolderName)].files[NameKey(m.FileName)]
+		return func() {
+			u.insertFile(m.FolderName, file)
 		}
 	}
+	return func() {}
 }
 
-func (v *VirtualFileSysStorage) IsExistFile(userName, folderName, fileName string) bool {
+// dump returns all users by name with their folders and files, sorted by
+// name.
+func (v *VirtualFileSysStorage) dump() map[string][]VirtualFileSysEntity {
 	v.mu.RLock()
-	defer v.mu.RUnlock()
+	nodes := make(map[string]*userNode, len(v.users))
+	for _, u := range v.users {
+		nodes[u.name] = u
+	}
+	v.mu.RUnlock()
 
-	key := fmt.Sprintf("%s:%s:%s", userName, folderName, fileName)
-	_, ok := v.FileMap[key]
-	return ok
+	users := make(map[string][]VirtualFileSysEntity, len(nodes))
+	for userName, u := range nodes {
+		u.mu.RLock()
+		users[userName] = u.dump()
+		u.mu.RUnlock()
+	}
+	return users
 }
 
-func (v *VirtualFileSysStorage) AddFile(userName, folderName, fileName, fileDesc string) {
+// restore adds a user with its folders and files, as returned by dump.
+// The user must not exist yet.
+func (v *VirtualFileSysStorage) restore(userName string, folders []VirtualFileSysEntity) {
+	u := newUserNode(userName)
+	for _, e := range folders {
+		u.addFolder(e.FolderName, e.FolderDesc, e.FolderCreateTime)
+		for _, file := range e.Files {
+			u.addFile(e.FolderName, file.FileName, file.FileDesc, file.FileCreateTime)
+		}
+	}
+
 	v.mu.Lock()
 	defer v.mu.Unlock()
 
-	key := fmt.Sprintf("%s:%s:%s", userName, folderName, fileName)
-	v.FileMap[key] = true
-	entities := v.Data[userName]
-	sort.Slice(entities, func(i, j int) bool {
-		return entities[i].FolderName < entities[j].FolderName
-	})
-	index := sort.Search(len(entities), func(i int) bool {
-		return entities[i].FolderName >= folderName
-	})
-	if index < len(entities) && entities[index].FolderName == folderName {
-		entities[index].Files = append(entities[index].Files, VirtualFileSysFileEntity{
-			FileName:       fileName,
-			FileCreateTime: time.Now().Unix(),
-			FileDesc:       fileDesc,
-		})
+	v.users[NameKey(userName)] = u
+}
+
+// check reports why m can't be applied. The caller must hold mu and
+// the lock of the user m works on.
+func (v *VirtualFileSysStorage) check(m mutation) error {
+	u, ok := v.users[NameKey(m.UserName)]
+	if !ok || m.Op == opAddUser {
+		return checkOp(m, ok)
 	}
+	return u.check(m)
 }
 
-func (v *VirtualFileSysStorage) DeleteFile(userName, folderName, fileName string) {
-	v.mu.Lock()
-	defer v.mu.Unlock()
+// do applies a checked mutation, the caller must hold the locks of check.
+func (v *VirtualFileSysStorage) do(m mutation) {
+	if m.Op == opAddUser {
+		v.addUser(m.UserName)
+		return
+	}
+	v.users[NameKey(m.UserName)].do(m)
+}
 
-	entities := v.Data[userName]
-	sort.Slice(entities, func(i, j int) bool {
-		return entities[i].FolderName < entities[j].FolderName
-	})
-	index := sort.Search(len(entities), func(i int) bool {
-		return entities[i].FolderName >= folderName
-	})
-	if index < len(entities) && entities[index].FolderName == folderName {
-		files := entities[index].Files
-		sort.Slice(files, func(i, j int) bool {
-			return files[i].FileName < files[j].FileName
-		})
-		fileIndex := sort.Search(len(files), func(i int) bool {
-			return files[i].FileName >= fileName
-		})
-		if fileIndex < len(files) && files[fileIndex].FileName == fileName {
-			start := fileIndex
-			end := fileIndex
-			end++
-			entities[index].Files = append(files[:start], files[end:]...)
-		}
-	}
-	key := fmt.Sprintf("%s:%s:%s", userName, folderName, fileName)
-	delete(v.FileMap, key)
-}
-
-func (v *VirtualFileSysStorage) ListFile(userName, folderName, sortName, orderBy string) []VirtualFileSysFileEntity {
-	v.mu.RLock()
-	defer v.mu.RUnlock()
+// checkOp reports an unknown op, or ErrUserNotFound for an op working on
+// a user that doesn't exist.
+func checkOp(m mutation, userExist bool) error {
+	switch m.Op {
+	case opAddUser:
+		if userExist {
+			return ErrUserExists
+		}
+		return nil
+	case opAddFolder, opDeleteFolder, opRenameFolder, opAddFile, opDeleteFile:
+	default:
+		return fmt.Errorf("unknown op %q", m.Op)
+	}
+	if !userExist {
+		return ErrUserNotFound
+	}
+	return nil
+}
 
-	entities := v.Data[userName]
-	sort.Slice(entities, func(i, j int) bool {
-		return entities[i].FolderName < entities[j].FolderName
-	})
-	index := sort.Search(len(entities), func(i int) bool {
-		return entities[i].FolderName >= folderName
-	})
-	if index < len(entities) && entities[index].FolderName == folderName {
-		files := entities[index].Files
-		switch sortName {
-		case "name":
-			sort.Slice(files, func(i, j int) bool {
-				if orderBy == "desc" {
-					return files[i].FileName > files[j].FileName
-				}
-				return files[i].FileName < files[j].FileName
-			})
-		case "create":
-			sort.Slice(files, func(i, j int) bool {
-				if orderBy == "desc" {
-					return files[i].FileCreateTime > files[j].FileCreateTime
-				}
-				return files[i].FileCreateTime < files[j].FileCreateTime
-			})
+func (v *VirtualFileSysStorage) addUser(userName string) {
+	v.users[NameKey(userName)] = newUserNode(userName)
+}
+
+func (v *VirtualFileSysStorage) addFolder(userName, folderName, folderDesc string, createTime int64) {
+	v.users[NameKey(userName)].addFolder(folderName, folderDesc, createTime)
+}
+
+func (v *VirtualFileSysStorage) addFile(userName, folderName, fileName, fileDesc string, createTime int64) {
+	v.users[NameKey(userName)].addFile(folderName, fileName, fileDesc, createTime)
+}
+
+// check reports why m, working on this user, can't be applied.
+// The caller must hold u.mu.
+func (u *userNode) check(m mutation) error {
+	err := checkOp(m, true)
+	if err != nil {
+		return err
+	}
+
+	f := u.folders[NameKey(m.FolderName)]
+	if m.Op == opAddFolder {
+		if f != nil {
+			return ErrFolderExists
+		}
+		return nil
+	}
+	if f == nil {
+		return ErrFolderNotFound
+	}
+
+	_, fileExist := f.files[NameKey(m.FileName)]
+	switch m.Op {
+	case opRenameFolder:
+		// only the case of the folder itself may change
+		if g := u.folders[NameKey(m.NewFolderName)]; g != nil && (g != f || m.NewFolderName == f.entity.FolderName) {
+			return ErrFolderExists
+		}
+	case opAddFile:
+		if fileExist {
+			return ErrFileExists
+		}
+	case opDeleteFile:
+		if !fileExist {
+			return ErrFileNotFound
 		}
-		return files
 	}
-	return []VirtualFileSysFileEntity{}
+	return nil
+}
+
+// do applies a checked mutation, the caller must hold u.mu.
+func (u *userNode) do(m mutation) {
+	switch m.Op {
+	case opAddFolder:
+		u.addFolder(m.FolderName, m.Desc, m.Time)
+	case opDeleteFolder:
+		u.deleteFolder(m.FolderName)
+	case opRenameFolder:
+		u.renameFolder(m.FolderName, m.NewFolderName)
+	case opAddFile:
+		u.addFile(m.FolderName, m.FileName, m.Desc, m.Time)
+	case opDeleteFile:
+		u.deleteFile(m.FolderName, m.FileName)
+	}
+}
+
+// dump returns the folders of u with their files, sorted by name.
+// The caller must hold u.mu.
+func (u *userNode) dump() []VirtualFileSysEntity {
+	folders := make([]VirtualFileSysEntity, 0, u.byName.Len())
+	u.byName.ascend(func(f *folderNode) bool {
+		e := f.entity
+		if f.byName.Len() > 0 {
+			e.Files = make([]VirtualFileSysFileEntity, 0, f.byName.Len())
+			f.byName.ascend(func(file *VirtualFileSysFileEntity) bool {
+				e.Files = append(e.Files, *file)
+				return true
+			})
+		}
+		folders = append(folders, e)
+		return true
+	})
+	return folders
+}
+
+func (u *userNode) addFolder(folderName, folderDesc string, createTime int64) {
+	u.insertFolder(newFolderNode(VirtualFileSysEntity{
+		UserName:         u.name,
+		FolderName:       folderName,
+		FolderCreateTime: createTime,
+		FolderDesc:       folderDesc,
+	}))
+}
+
+func (u *userNode) insertFolder(f *folderNode) {
+	u.folders[NameKey(f.entity.FolderName)] = f
+	u.byName.insert(f)
+	u.byCreate.insert(f)
+}
+
+func (u *userNode) deleteFolder(folderName string) {
+	key := NameKey(folderName)
+	f := u.folders[key]
+	delete(u.folders, key)
+	u.byName.delete(f)
+	u.byCreate.delete(f)
+}
+
+func (u *userNode) renameFolder(folderName, newFolderName string) {
+	key := NameKey(folderName)
+	f := u.folders[key]
+	// the name is part of both index keys,
+	// take the folder out while it changes
+	u.byName.delete(f)
+	u.byCreate.delete(f)
+	delete(u.folders, key)
+	f.entity.FolderName = newFolderName
+	u.folders[NameKey(newFolderName)] = f
+	u.byName.insert(f)
+	u.byCreate.insert(f)
+}
+
+func (u *userNode) addFile(folderName, fileName, fileDesc string, createTime int64) {
+	u.insertFile(folderName, &VirtualFileSysFileEntity{
+		FileName:       fileName,
+		FileCreateTime: createTime,
+		FileDesc:       fileDesc,
+	})
+}
+
+func (u *userNode) insertFile(folderName string, file *VirtualFileSysFileEntity) {
+	f := u.folders[NameKey(folderName)]
+	f.files[NameKey(file.FileName)] = file
+	f.byName.insert(file)
+	f.byCreate.insert(file)
+}
+
+func (u *userNode) deleteFile(folderName, fileName string) {
+	f := u.folders[NameKey(folderName)]
+	key := NameKey(fileName)
+	file := f.files[key]
+	delete(f.files, key)
+	f.byName.delete(file)
+	f.byCreate.delete(file)
 }
@@ -1,8 +1,12 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/suite"
 )
@@ -11,238 +15,729 @@ type TestVirtualFileSysStorage struct {
 	suite.Suite
 
 	TestStorage *VirtualFileSysStorage
+	ctx         context.Context
 }
 
 func TestVirtualFileSysStorageSuite(t *testing.T) {
 	suite.Run(t, new(TestVirtualFileSysStorage))
 }
 
-func (t *TestVirtualFileSysStorage) SetupSuite() {
-	t.TestStorage = &VirtualFileSysStorage{
-		Data:      make(map[string][]VirtualFileSysEntity),
-		FolderMap: make(map[string]bool),
-		FileMap:   make(map[string]bool),
-	}
+func (t *TestVirtualFileSysStorage) SetupTest() {
+	t.ctx = context.Background()
+	t.TestStorage = newVirtualFileSysStorage()
 }
 
 func (t *TestVirtualFileSysStorage) TestAddUser() {
-	t.TestStorage.AddUser("test")
-	t.True(t.TestStorage.IsExistUser("test"))
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.True(t.TestStorage.IsExistUser(t.ctx, "test"))
 }
 
 func (t *TestVirtualFileSysStorage) TestAddFolder() {
-	t.TestStorage.AddUser("test")
-	t.TestStorage.AddFolder("test", "folder", "desc")
-	t.True(t.TestStorage.IsExistFolder("test", "folder"))
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.True(t.TestStorage.IsExistFolder(t.ctx, "test", "folder"))
 }
 
 func (t *TestVirtualFileSysStorage) TestDeleteFolder() {
-	t.TestStorage.AddUser("test")
-	t.TestStorage.AddFolder("test", "folder", "desc")
-	t.TestStorage.DeleteFolder("test", "folder")
-	t.False(t.TestStorage.IsExistFolder("test", "folder"))
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.NoError(t.TestStorage.DeleteFolder(t.ctx, "test", "folder"))
+	t.False(t.TestStorage.IsExistFolder(t.ctx, "test", "folder"))
 }
 
 func (t *TestVirtualFileSysStorage) TestDeleteFolders() {
-	t.TestStorage.AddUser("test")
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
 	n := 10
 	for i := 1; i <= n; i++ {
-		t.TestStorage.AddFolder("test", fmt.Sprintf("folder%d", i), "desc")
+		t.NoError(t.TestStorage.AddFolder(t.ctx, "test", fmt.Sprintf("folder%d", i), "desc"))
 	}
 	for j := n; j > 0; j-- {
-		t.TestStorage.DeleteFolder("test", fmt.Sprintf("folder%d", j))
-		t.False(t.TestStorage.IsExistFolder("test", fmt.Sprintf("folder%d", j)))
-		folders := t.TestStorage.ListFolder("test", "test", "desc")
+		t.NoError(t.TestStorage.DeleteFolder(t.ctx, "test", fmt.Sprintf("folder%d", j)))
+		t.False(t.TestStorage.IsExistFolder(t.ctx, "test", fmt.Sprintf("folder%d", j)))
+		folders, err := t.TestStorage.ListFolder(t.ctx, "test", "test", "desc")
+		t.NoError(err)
 		t.Equal(j-1, len(folders))
 	}
 }
 
 func (t *TestVirtualFileSysStorage) TestRenameFolder() {
-	t.TestStorage.AddUser("test")
-	t.TestStorage.AddFolder("test", "folder", "desc")
-	t.TestStorage.RenameFolder("test", "folder", "newFolder")
-	t.False(t.TestStorage.IsExistFolder("test", "folder"))
-	t.True(t.TestStorage.IsExistFolder("test", "newFolder"))
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.NoError(t.TestStorage.RenameFolder(t.ctx, "test", "folder", "newFolder"))
+	t.False(t.TestStorage.IsExistFolder(t.ctx, "test", "folder"))
+	t.True(t.TestStorage.IsExistFolder(t.ctx, "test", "newFolder"))
 }
 
 func (t *TestVirtualFileSysStorage) TestRenameFolderWithFile() {
-	t.TestStorage.AddUser("test")
-	t.TestStorage.AddFolder("test", "folder", "desc")
-	t.TestStorage.AddFile("test", "folder", "file", "desc")
-	t.TestStorage.RenameFolder("test", "folder", "newFolder")
-	t.False(t.TestStorage.IsExistFolder("test", "folder"))
-	t.True(t.TestStorage.IsExistFolder("test", "newFolder"))
-	t.True(t.TestStorage.IsExistFile("test", "newFolder", "file"))
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file", "desc"))
+	t.NoError(t.TestStorage.RenameFolder(t.ctx, "test", "folder", "newFolder"))
+	t.False(t.TestStorage.IsExistFolder(t.ctx, "test", "folder"))
+	t.True(t.TestStorage.IsExistFolder(t.ctx, "test", "newFolder"))
+	t.True(t.TestStorage.IsExistFile(t.ctx, "test", "newFolder", "file"))
 }
 
 func (t *TestVirtualFileSysStorage) TestListFolderByName() {
-	t.TestStorage.AddUser("test")
-	t.TestStorage.AddFolder("test", "folder1", "desc1")
-	t.TestStorage.AddFolder("test", "folder2", "desc2")
-	t.TestStorage.AddFolder("test", "folder3", "desc3")
-	folders := t.TestStorage.ListFolder("test", "name", "asc")
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder1", "desc1"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder2", "desc2"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder3", "desc3"))
+	folders, err := t.TestStorage.ListFolder(t.ctx, "test", "name", "asc")
+	t.NoError(err)
 	t.Equal(3, len(folders))
 	t.Equal("folder1", folders[0].FolderName)
 }
 
 func (t *TestVirtualFileSysStorage) TestListFolderByNameDesc() {
-	t.TestStorage.AddUser("test")
-	t.TestStorage.AddFolder("test", "folder1", "desc1")
-	t.TestStorage.AddFolder("test", "folder2", "desc2")
-	t.TestStorage.AddFolder("test", "folder3", "desc3")
-	folders := t.TestStorage.ListFolder("test", "name", "desc")
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder1", "desc1"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder2", "desc2"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder3", "desc3"))
+	folders, err := t.TestStorage.ListFolder(t.ctx, "test", "name", "desc")
+	t.NoError(err)
 	t.Equal(3, len(folders))
 	t.Equal("folder3", folders[0].FolderName)
 }
 
 func (t *TestVirtualFileSysStorage) TestListFolderByCreate() {
-	t.TestStorage.AddUser("test")
-	t.TestStorage.AddFolder("test", "folder1", "desc1")
-	t.TestStorage.AddFolder("test", "folder2", "desc2")
-	t.TestStorage.AddFolder("test", "folder3", "desc3")
-	folders := t.TestStorage.ListFolder("test", "create", "asc")
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder1", "desc1"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder2", "desc2"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder3", "desc3"))
+	folders, err := t.TestStorage.ListFolder(t.ctx, "test", "create", "asc")
+	t.NoError(err)
 	t.Equal(3, len(folders))
 	t.Equal("folder1", folders[0].FolderName)
 }
 
 func (t *TestVirtualFileSysStorage) TestListFolderByCreateDesc() {
-	t.TestStorage.AddUser("test")
-	t.TestStorage.AddFolder("test", "folder1", "desc1")
-	t.TestStorage.AddFolder("test", "folder2", "desc2")
-	t.TestStorage.AddFolder("test", "folder3", "desc3")
-	folders := t.TestStorage.ListFolder("test", "create", "desc")
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder1", "desc1"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder2", "desc2"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder3", "desc3"))
+	folders, err := t.TestStorage.ListFolder(t.ctx, "test", "create", "desc")
+	t.NoError(err)
 	t.Equal(3, len(folders))
 }
 
 func (t *TestVirtualFileSysStorage) TestAddFile() {
-	t.TestStorage.AddUser("test")
-	t.TestStorage.AddFolder("test", "folder", "desc")
-	t.TestStorage.AddFile("test", "folder", "file", "desc")
-	t.True(t.TestStorage.IsExistFile("test", "folder", "file"))
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file", "desc"))
+	t.True(t.TestStorage.IsExistFile(t.ctx, "test", "folder", "file"))
 }
 
 func (t *TestVirtualFileSysStorage) TestDeleteFile() {
-	t.TestStorage.AddUser("test")
-	t.TestStorage.AddFolder("test", "folder", "desc")
-	t.TestStorage.AddFile("test", "folder", "file", "desc")
-	t.TestStorage.DeleteFile("test", "folder", "file")
-	t.False(t.TestStorage.IsExistFile("test", "folder", "file"))
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file", "desc"))
+	t.NoError(t.TestStorage.DeleteFile(t.ctx, "test", "folder", "file"))
+	t.False(t.TestStorage.IsExistFile(t.ctx, "test", "folder", "file"))
 }
 
 func (t *TestVirtualFileSysStorage) TestDeleteFiles() {
-	t.TestStorage.AddUser("test")
-	t.TestStorage.AddFolder("test", "folder", "desc")
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
 	n := 10
 	for i := 1; i <= n; i++ {
-		t.TestStorage.AddFile("test", "folder", fmt.Sprintf("file%d", i), "desc")
+		t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", fmt.Sprintf("file%d", i), "desc"))
 	}
 	for j := n; j > 0; j-- {
-		t.TestStorage.DeleteFile("test", "folder", fmt.Sprintf("file%d", j))
-		t.False(t.TestStorage.IsExistFile("test", "folder", fmt.Sprintf("file%d", j)))
-		files := t.TestStorage.ListFile("test", "folder", "name", "asc")
+		t.NoError(t.TestStorage.DeleteFile(t.ctx, "test", "folder", fmt.Sprintf("file%d", j)))
+		t.False(t.TestStorage.IsExistFile(t.ctx, "test", "folder", fmt.Sprintf("file%d", j)))
+		files, err := t.TestStorage.ListFile(t.ctx, "test", "folder", "name", "asc")
+		t.NoError(err)
 		t.Equal(j-1, len(files))
 	}
 }
 
 func (t *TestVirtualFileSysStorage) TestListFileByNmae() {
-	t.TestStorage.AddUser("test")
-	t.TestStorage.AddFolder("test", "folder", "desc")
-	t.TestStorage.AddFile("test", "folder", "file1", "desc1")
-	t.TestStorage.AddFile("test", "folder", "file2", "desc2")
-	t.TestStorage.AddFile("test", "folder", "file3", "desc3")
-	files := t.TestStorage.ListFile("test", "folder", "name", "asc")
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file1", "desc1"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file2", "desc2"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file3", "desc3"))
+	files, err := t.TestStorage.ListFile(t.ctx, "test", "folder", "name", "asc")
+	t.NoError(err)
 	t.Equal(3, len(files))
 	t.Equal("file1", files[0].FileName)
 }
 
 func (t *TestVirtualFileSysStorage) TestListFileByNmaeDesc() {
-	t.TestStorage.AddUser("test")
-	t.TestStorage.AddFolder("test", "folder", "desc")
-	t.TestStorage.AddFile("test", "folder", "file1", "desc1")
-	t.TestStorage.AddFile("test", "folder", "file2", "desc2")
-	t.TestStorage.AddFile("test", "folder", "file3", "desc3")
-	files := t.TestStorage.ListFile("test", "folder", "name", "desc")
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file1", "desc1"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file2", "desc2"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file3", "desc3"))
+	files, err := t.TestStorage.ListFile(t.ctx, "test", "folder", "name", "desc")
+	t.NoError(err)
 	t.Equal(3, len(files))
 	t.Equal("file3", files[0].FileName)
 }
 
 func (t *TestVirtualFileSysStorage) TestListFileByCreate() {
-	t.TestStorage.AddUser("test")
-	t.TestStorage.AddFolder("test", "folder", "desc")
-	t.TestStorage.AddFile("test", "folder", "file1", "desc1")
-	t.TestStorage.AddFile("test", "folder", "file2", "desc2")
-	t.TestStorage.AddFile("test", "folder", "file3", "desc3")
-	files := t.TestStorage.ListFile("test", "folder", "create", "asc")
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file1", "desc1"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file2", "desc2"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file3", "desc3"))
+	files, err := t.TestStorage.ListFile(t.ctx, "test", "folder", "create", "asc")
+	t.NoError(err)
 	t.Equal(3, len(files))
 	t.Equal("file1", files[0].FileName)
 }
 
 func (t *TestVirtualFileSysStorage) TestListFileByCreateDesc() {
-	t.TestStorage.AddUser("test")
-	t.TestStorage.AddFolder("test", "folder", "desc")
-	t.TestStorage.AddFile("test", "folder", "file2", "desc1")
-	t.TestStorage.AddFile("test", "folder", "file2", "desc2")
-	t.TestStorage.AddFile("test", "folder", "file3", "desc3")
-	files := t.TestStorage.ListFile("test", "folder", "create", "desc")
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file1", "desc1"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file2", "desc2"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file3", "desc3"))
+	files, err := t.TestStorage.ListFile(t.ctx, "test", "folder", "create", "desc")
+	t.NoError(err)
 	t.Equal(3, len(files))
 }
 
-func BenchmarkAddUser(b *testing.B) {
-	storage := &VirtualFileSysStorage{
-		Data:      make(map[string][]VirtualFileSysEntity),
-		FolderMap: make(map[string]bool),
-		FileMap:   make(map[string]bool),
+func (t *TestVirtualFileSysStorage) TestAddUserExist() {
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.ErrorIs(t.TestStorage.AddUser(t.ctx, "test"), ErrUserExists)
+}
+
+func (t *TestVirtualFileSysStorage) TestAddFolderError() {
+	t.ErrorIs(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"), ErrUserNotFound)
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.ErrorIs(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"), ErrFolderExists)
+}
+
+func (t *TestVirtualFileSysStorage) TestDeleteFolderError() {
+	t.ErrorIs(t.TestStorage.DeleteFolder(t.ctx, "test", "folder"), ErrUserNotFound)
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.ErrorIs(t.TestStorage.DeleteFolder(t.ctx, "test", "folder"), ErrFolderNotFound)
+}
+
+func (t *TestVirtualFileSysStorage) TestDeleteFolderWithFile() {
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file", "desc"))
+	t.NoError(t.TestStorage.DeleteFolder(t.ctx, "test", "folder"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.False(t.TestStorage.IsExistFile(t.ctx, "test", "folder", "file"))
+}
+
+func (t *TestVirtualFileSysStorage) TestRenameFolderError() {
+	t.ErrorIs(t.TestStorage.RenameFolder(t.ctx, "test", "folder", "newfolder"), ErrUserNotFound)
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.ErrorIs(t.TestStorage.RenameFolder(t.ctx, "test", "folder", "newfolder"), ErrFolderNotFound)
+	t.False(t.TestStorage.IsExistFolder(t.ctx, "test", "newfolder"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "newfolder", "desc"))
+	t.ErrorIs(t.TestStorage.RenameFolder(t.ctx, "test", "folder", "newfolder"), ErrFolderExists)
+}
+
+func (t *TestVirtualFileSysStorage) TestAddFileError() {
+	t.ErrorIs(t.TestStorage.AddFile(t.ctx, "test", "folder", "file", "desc"), ErrUserNotFound)
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.ErrorIs(t.TestStorage.AddFile(t.ctx, "test", "folder", "file", "desc"), ErrFolderNotFound)
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file", "desc"))
+	t.ErrorIs(t.TestStorage.AddFile(t.ctx, "test", "folder", "file", "desc"), ErrFileExists)
+}
+
+func (t *TestVirtualFileSysStorage) TestDeleteFileError() {
+	t.ErrorIs(t.TestStorage.DeleteFile(t.ctx, "test", "folder", "file"), ErrUserNotFound)
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.ErrorIs(t.TestStorage.DeleteFile(t.ctx, "test", "folder", "file"), ErrFolderNotFound)
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.ErrorIs(t.TestStorage.DeleteFile(t.ctx, "test", "folder", "file"), ErrFileNotFound)
+}
+
+func (t *TestVirtualFileSysStorage) TestListError() {
+	_, err := t.TestStorage.ListFolder(t.ctx, "test", "name", "asc")
+	t.ErrorIs(err, ErrUserNotFound)
+	_, err = t.TestStorage.ListFile(t.ctx, "test", "folder", "name", "asc")
+	t.ErrorIs(err, ErrUserNotFound)
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	_, err = t.TestStorage.ListFile(t.ctx, "test", "folder", "name", "asc")
+	t.ErrorIs(err, ErrFolderNotFound)
+}
+
+func (t *TestVirtualFileSysStorage) TestCanceledContext() {
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	ctx, cancel := context.WithCancel(t.ctx)
+	cancel()
+	t.ErrorIs(t.TestStorage.AddFolder(ctx, "test", "folder2", "desc"), context.Canceled)
+	t.ErrorIs(t.TestStorage.DeleteFolder(ctx, "test", "folder"), context.Canceled)
+	t.False(t.TestStorage.IsExistFolder(ctx, "test", "folder"))
+	_, err := t.TestStorage.ListFolder(ctx, "test", "name", "asc")
+	t.ErrorIs(err, context.Canceled)
+	t.True(t.TestStorage.IsExistFolder(t.ctx, "test", "folder"))
+	t.False(t.TestStorage.IsExistFolder(t.ctx, "test", "folder2"))
+}
+
+func (t *TestVirtualFileSysStorage) TestListFolderCopy() {
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file", "desc"))
+	folders, err := t.TestStorage.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	folders[0].FolderName = "changed"
+	_ = append(folders, VirtualFileSysEntity{FolderName: "appended"})
+
+	reload, err := t.TestStorage.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal(1, len(reload))
+	t.Equal("folder", reload[0].FolderName)
+	t.True(t.TestStorage.IsExistFolder(t.ctx, "test", "folder"))
+}
+
+func (t *TestVirtualFileSysStorage) TestListFileCopy() {
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder", "file", "desc"))
+	files, err := t.TestStorage.ListFile(t.ctx, "test", "folder", "name", "asc")
+	t.Require().NoError(err)
+	files[0].FileName = "changed"
+
+	t.True(t.TestStorage.IsExistFile(t.ctx, "test", "folder", "file"))
+	reload, err := t.TestStorage.ListFile(t.ctx, "test", "folder", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal("file", reload[0].FileName)
+}
+
+func (t *TestVirtualFileSysStorage) TestListAfterRename() {
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	for _, name := range []string{"a", "b", "c"} {
+		t.TestStorage.addFolder("test", name, "desc", 1)
 	}
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "a", "file", "desc"))
+	t.NoError(t.TestStorage.RenameFolder(t.ctx, "test", "a", "d"))
+	folders, err := t.TestStorage.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal([]string{"b", "c", "d"}, []string{folders[0].FolderName, folders[1].FolderName, folders[2].FolderName})
+	folders, err = t.TestStorage.ListFolder(t.ctx, "test", "create", "asc")
+	t.Require().NoError(err)
+	t.Equal([]string{"b", "c", "d"}, []string{folders[0].FolderName, folders[1].FolderName, folders[2].FolderName})
+	t.True(t.TestStorage.IsExistFile(t.ctx, "test", "d", "file"))
+	t.False(t.TestStorage.IsExistFile(t.ctx, "test", "a", "file"))
+}
+
+func (t *TestVirtualFileSysStorage) TestListByCreateTie() {
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	for _, name := range []string{"c", "a", "b"} {
+		t.TestStorage.addFolder("test", name, "desc", 1)
+	}
+	for _, name := range []string{"c", "a", "b"} {
+		t.TestStorage.addFile("test", "a", name, "desc", 1)
+	}
+	folders, err := t.TestStorage.ListFolder(t.ctx, "test", "create", "asc")
+	t.Require().NoError(err)
+	t.Equal([]string{"a", "b", "c"}, []string{folders[0].FolderName, folders[1].FolderName, folders[2].FolderName})
+	files, err := t.TestStorage.ListFile(t.ctx, "test", "a", "create", "desc")
+	t.Require().NoError(err)
+	t.Equal([]string{"c", "b", "a"}, []string{files[0].FileName, files[1].FileName, files[2].FileName})
+}
+
+// TestConcurrentAccess is meant to run with -race, many readers list and
+// change their results while writers change the same folders.
+func (t *TestVirtualFileSysStorage) TestConcurrentAccess() {
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	const (
+		writers = 8
+		readers = 16
+		n       = 200
+	)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				folderName := fmt.Sprintf("folder%d-%d", w, i%10)
+				fileName := fmt.Sprintf("file%d-%d", w, i)
+				_ = t.TestStorage.AddFolder(t.ctx, "test", folderName, "desc")
+				_ = t.TestStorage.AddFile(t.ctx, "test", "folder", fileName, "desc")
+				_ = t.TestStorage.AddFile(t.ctx, "test", folderName, fileName, "desc")
+				_ = t.TestStorage.RenameFolder(t.ctx, "test", folderName, folderName+"-renamed")
+				_ = t.TestStorage.DeleteFolder(t.ctx, "test", folderName+"-renamed")
+				_ = t.TestStorage.DeleteFile(t.ctx, "test", "folder", fileName)
+			}
+		}(w)
+	}
+	sortNames := []string{"name", "create"}
+	orderBys := []string{"asc", "desc"}
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				sortName, orderBy := sortNames[(r+i)%2], orderBys[i%2]
+				folders, err := t.TestStorage.ListFolder(t.ctx, "test", sortName, orderBy)
+				if err != nil {
+					t.Fail(err.Error())
+					return
+				}
+				for j := range folders {
+					folders[j].FolderDesc = "changed"
+				}
+				files, err := t.TestStorage.ListFile(t.ctx, "test", "folder", sortName, orderBy)
+				if err != nil {
+					t.Fail(err.Error())
+					return
+				}
+				for j := range files {
+					files[j].FileDesc = "changed"
+				}
+				t.TestStorage.IsExistFile(t.ctx, "test", "folder", "file0-0")
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	folders, err := t.TestStorage.ListFolder(t.ctx, "test", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal(1, len(folders))
+	t.Equal("desc", folders[0].FolderDesc)
+	files, err := t.TestStorage.ListFile(t.ctx, "test", "folder", "name", "asc")
+	t.Require().NoError(err)
+	t.Equal(0, len(files))
+}
+
+func BenchmarkAddUser(b *testing.B) {
+	ctx := context.Background()
+	storage := newVirtualFileSysStorage()
 	for i := 0; i < b.N; i++ {
 		name := fmt.Sprintf("test%d", i)
-		storage.AddUser(name)
+		storage.AddUser(ctx, name)
 	}
 }
 
 func BenchmarkAddFolder(b *testing.B) {
-	storage := &VirtualFileSysStorage{
-		Data:      make(map[string][]VirtualFileSysEntity),
-		FolderMap: make(map[string]bool),
-		FileMap:   make(map[string]bool),
-	}
-	storage.AddUser("test")
+	ctx := context.Background()
+	storage := newVirtualFileSysStorage()
+	storage.AddUser(ctx, "test")
 	for i := 0; i < b.N; i++ {
 		name := fmt.Sprintf("folder%d", i)
 		desc := "desc01234567890123456789012345678901234567890123456789012345678901234567890123456789"
-		storage.AddFolder("test", name, desc)
+		storage.AddFolder(ctx, "test", name, desc)
 	}
 }
 
 func BenchmarkAddFile(b *testing.B) {
-	storage := &VirtualFileSysStorage{
-		Data:      make(map[string][]VirtualFileSysEntity),
-		FolderMap: make(map[string]bool),
-		FileMap:   make(map[string]bool),
-	}
-	storage.AddUser("test")
-	storage.AddFolder("test", "folder", "desc")
+	ctx := context.Background()
+	storage := newVirtualFileSysStorage()
+	storage.AddUser(ctx, "test")
+	storage.AddFolder(ctx, "test", "folder", "desc")
 	for i := 0; i < b.N; i++ {
 		name := fmt.Sprintf("file%d", i)
 		desc := "desc01234567890123456789012345678901234567890123456789012345678901234567890123456789"
-		storage.AddFile("test", "folder", name, desc)
+		storage.AddFile(ctx, "test", "folder", name, desc)
 	}
 }
 
 func BenchmarkRenameFolder(b *testing.B) {
-	storage := &VirtualFileSysStorage{
-		Data:      make(map[string][]VirtualFileSysEntity),
-		FolderMap: make(map[string]bool),
-		FileMap:   make(map[string]bool),
-	}
-	storage.AddUser("test")
+	ctx := context.Background()
+	storage := newVirtualFileSysStorage()
+	storage.AddUser(ctx, "test")
 	folderName := "folder"
 	newFolderName := "newfolder"
-	storage.AddFolder("test", folderName, "desc")
+	storage.AddFolder(ctx, "test", folderName, "desc")
 	for i := 0; i < b.N; i++ {
 		if i%2 == 0 {
-			storage.RenameFolder("test", folderName, newFolderName)
+			storage.RenameFolder(ctx, "test", folderName, newFolderName)
 		} else {
-			storage.RenameFolder("test", newFolderName, folderName)
+			storage.RenameFolder(ctx, "test", newFolderName, folderName)
+		}
+	}
+}
+
+func (t *TestVirtualFileSysStorage) TestUserLockIndependent() {
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddUser(t.ctx, "other"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder", "desc"))
+	// as if a long listing of test was running
+	u := t.TestStorage.user("test")
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	done := make(chan error, 1)
+	go func() {
+		err := t.TestStorage.AddFolder(t.ctx, "other", "folder", "desc")
+		if err == nil {
+			err = t.TestStorage.AddUser(t.ctx, "third")
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fail("a lock on one user blocked another")
+	}
+	t.True(t.TestStorage.IsExistFolder(t.ctx, "test", "folder"))
+}
+
+func (t *TestVirtualFileSysStorage) TestBatchWaitIndependent() {
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddUser(t.ctx, "other"))
+	// as if a long listing of test was running
+	u := t.TestStorage.user("test")
+	u.mu.RLock()
+
+	applied := make(chan error, 1)
+	go func() {
+		applied <- t.TestStorage.apply(mutation{Op: opBatch, Batch: []mutation{
+			{Op: opAddFolder, UserName: "test", FolderName: "folder", Time: 1},
+		}})
+	}()
+	done := make(chan error, 1)
+	go func() {
+		// give the batch the time to wait for test
+		time.Sleep(100 * time.Millisecond)
+		err := t.TestStorage.AddFolder(t.ctx, "other", "folder", "desc")
+		if err == nil && !t.TestStorage.IsExistUser(t.ctx, "other") {
+			err = ErrUserNotFound
 		}
+		if err == nil {
+			err = t.TestStorage.AddUser(t.ctx, "third")
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fail("a batch waiting for one user blocked another")
+	}
+	u.mu.RUnlock()
+	t.NoError(<-applied)
+	t.True(t.TestStorage.IsExistFolder(t.ctx, "test", "folder"))
+}
+
+func (t *TestVirtualFileSysStorage) TestBatchUndo() {
+	t.NoError(t.TestStorage.AddUser(t.ctx, "test"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder1", "desc"))
+	t.NoError(t.TestStorage.AddFolder(t.ctx, "test", "folder2", "desc"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder1", "file1", "desc"))
+	t.NoError(t.TestStorage.AddFile(t.ctx, "test", "folder2", "file2", "desc"))
+	before := t.TestStorage.dump()
+	batch := mutation{Op: opBatch, Batch: []mutation{
+		{Op: opDeleteFolder, UserName: "test", FolderName: "folder1"},
+		{Op: opRenameFolder, UserName: "test", FolderName: "folder2", NewFolderName: "folder1"},
+		{Op: opAddFile, UserName: "test", FolderName: "folder1", FileName: "file3", Time: 1},
+		{Op: opDeleteFile, UserName: "test", FolderName: "folder1", FileName: "file2"},
+		{Op: opAddUser, UserName: "other"},
+		{Op: opAddFolder, UserName: "other", FolderName: "folder", Time: 1},
+		{Op: opDeleteFolder, UserName: "test", FolderName: "folder2"},
+	}}
+
+	t.ErrorIs(t.TestStorage.applyWith(batch, func() error {
+		t.Fail("called for a batch that can't be applied")
+		return nil
+	}), ErrFolderNotFound)
+	t.Equal(before, t.TestStorage.dump())
+	t.ErrorIs(t.TestStorage.apply(batch), ErrFolderNotFound)
+	t.Equal(before, t.TestStorage.dump())
+	t.False(t.TestStorage.IsExistUser(t.ctx, "other"))
+
+	batch.Batch = batch.Batch[:len(batch.Batch)-1]
+	// a failing before undoes the batch
+	errBefore := errors.New("before")
+	t.ErrorIs(t.TestStorage.applyWith(batch, func() error {
+		return errBefore
+	}), errBefore)
+	t.Equal(before, t.TestStorage.dump())
+	t.NoError(t.TestStorage.apply(batch))
+	t.True(t.TestStorage.IsExistFile(t.ctx, "test", "folder1", "file3"))
+	t.False(t.TestStorage.IsExistFile(t.ctx, "test", "folder1", "file1"))
+	t.True(t.TestStorage.IsExistFolder(t.ctx, "other", "folder"))
+}
+
+// TestConcurrentBatches runs batches over overlapping users in opposite
+// orders, which deadlocks unless the user locks are taken in order.
+func (t *TestVirtualFileSysStorage) TestConcurrentBatches() {
+	users := []string{"a", "b", "c"}
+	for _, userName := range users {
+		t.NoError(t.TestStorage.AddUser(t.ctx, userName))
+	}
+	const n = 200
+	var wg sync.WaitGroup
+	for w := 0; w < 6; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				batch := []mutation{}
+				for k := range users {
+					userName := users[(w+k)%len(users)]
+					if w%2 == 1 {
+						userName = users[(w-k+len(users))%len(users)]
+					}
+					batch = append(batch, mutation{
+						Op:         opAddFolder,
+						UserName:   userName,
+						FolderName: fmt.Sprintf("folder%d-%d", w, i),
+					})
+				}
+				err := t.TestStorage.apply(mutation{Op: opBatch, Batch: batch})
+				if err != nil {
+					t.Fail(err.Error())
+					return
+				}
+				_ = t.TestStorage.DeleteFolder(t.ctx, users[i%len(users)], fmt.Sprintf("folder%d-%d", w, i))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, userName := range users {
+		folders, err := t.TestStorage.ListFolder(t.ctx, userName, "name", "asc")
+		t.Require().NoError(err)
+		total += len(folders)
+	}
+	t.Equal(6*n*(len(users)-1), total)
+}
+
+// BenchmarkParallelUsers runs writes and listings, each goroutine on its own
+// user, run it with -cpu 1,2,4,8 to see the calls on different users scale.
+func BenchmarkParallelUsers(b *testing.B) {
+	ctx := context.Background()
+	storage := newVirtualFileSysStorage()
+	var next int64
+	var mu sync.Mutex
+	b.RunParallel(func(pb *testing.PB) {
+		mu.Lock()
+		next++
+		userName := fmt.Sprintf("user%d", next)
+		mu.Unlock()
+		storage.AddUser(ctx, userName)
+		for i := 0; i < 1000; i++ {
+			storage.AddFolder(ctx, userName, fmt.Sprintf("folder%d", i), "desc")
+		}
+		i := 0
+		for pb.Next() {
+			storage.AddFile(ctx, userName, "folder0", "file", "desc")
+			storage.DeleteFile(ctx, userName, "folder0", "file")
+			if i%10 == 0 {
+				storage.ListFolder(ctx, userName, "create", "asc")
+			}
+			i++
+		}
+	})
+}
+
+// BenchmarkParallelSameUser is the baseline of BenchmarkParallelUsers with
+// every goroutine on the same user, which the user lock serializes.
+func BenchmarkParallelSameUser(b *testing.B) {
+	ctx := context.Background()
+	storage := newVirtualFileSysStorage()
+	storage.AddUser(ctx, "test")
+	for i := 0; i < 1000; i++ {
+		storage.AddFolder(ctx, "test", fmt.Sprintf("folder%d", i), "desc")
+	}
+	var next int64
+	var mu sync.Mutex
+	b.RunParallel(func(pb *testing.PB) {
+		mu.Lock()
+		next++
+		fileName := fmt.Sprintf("file%d", next)
+		mu.Unlock()
+		i := 0
+		for pb.Next() {
+			storage.AddFile(ctx, "test", "folder0", fileName, "desc")
+			storage.DeleteFile(ctx, "test", "folder0", fileName)
+			if i%10 == 0 {
+				storage.ListFolder(ctx, "test", "create", "asc")
+			}
+			i++
+		}
+	})
+}
+
+const (
+	largeFolders        = 100000
+	largeFilesPerFolder = 10
+)
+
+var largeStorage *VirtualFileSysStorage
+
+// newLargeStorage returns a user with 100k folders and 1M files, built once
+// and shared by the benchmarks, which must leave it as they found it.
+func newLargeStorage(b *testing.B) *VirtualFileSysStorage {
+	b.Helper()
+	if largeStorage != nil {
+		return largeStorage
+	}
+	storage := newVirtualFileSysStorage()
+	storage.addUser("test")
+	for i := 0; i < largeFolders; i++ {
+		folderName := fmt.Sprintf("folder%d", i)
+		storage.addFolder("test", folderName, "desc", int64(i))
+		for j := 0; j < largeFilesPerFolder; j++ {
+			storage.addFile("test", folderName, fmt.Sprintf("file%d", j), "desc", int64(j))
+		}
+	}
+	largeStorage = storage
+	return storage
+}
+
+func BenchmarkLargeAddDeleteFolder(b *testing.B) {
+	ctx := context.Background()
+	storage := newLargeStorage(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		storage.AddFolder(ctx, "test", "bench", "desc")
+		storage.DeleteFolder(ctx, "test", "bench")
+	}
+}
+
+func BenchmarkLargeRenameFolder(b *testing.B) {
+	ctx := context.Background()
+	storage := newLargeStorage(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		storage.RenameFolder(ctx, "test", "folder500", "bench")
+		storage.RenameFolder(ctx, "test", "bench", "folder500")
+	}
+}
+
+func BenchmarkLargeAddDeleteFile(b *testing.B) {
+	ctx := context.Background()
+	storage := newLargeStorage(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		storage.AddFile(ctx, "test", "folder500", "bench", "desc")
+		storage.DeleteFile(ctx, "test", "folder500", "bench")
+	}
+}
+
+func BenchmarkLargeIsExistFile(b *testing.B) {
+	ctx := context.Background()
+	storage := newLargeStorage(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		storage.IsExistFile(ctx, "test", "folder500", "file5")
+	}
+}
+
+func BenchmarkLargeListFile(b *testing.B) {
+	ctx := context.Background()
+	storage := newLargeStorage(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		storage.ListFile(ctx, "test", "folder500", "create", "desc")
+	}
+}
+
+func BenchmarkLargeListFolder(b *testing.B) {
+	ctx := context.Background()
+	storage := newLargeStorage(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		storage.ListFolder(ctx, "test", "create", "desc")
 	}
 }